@@ -24,6 +24,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
 	"github.com/tidwall/gjson"
 )
 
@@ -82,6 +84,25 @@ type Batch struct {
 	// invoke lifecycle then it is possible to receive the agent init request
 	// before extension invoke is registered.
 	currentlyExecutingRequestID string
+	// shutdownCount is the number of events held by the invocations
+	// finalized at shutdown, see OnShutdown.
+	shutdownCount int
+	// synthesizeTxns enables the synthesis of transactions for the
+	// invocations without agent transactions.
+	synthesizeTxns bool
+	// defaultMetadata is the metadata used if no agent reported metadata.
+	defaultMetadata []byte
+	// defaultMetadataUsed is true if the metadata of the batch is the
+	// default metadata, which is replaced by the metadata of an agent.
+	defaultMetadataUsed bool
+	// invoked is true once an invocation has been registered.
+	invoked bool
+	// xrayPropagation and xrayRootLabel define how the X-Ray trace context
+	// is recorded in the proxy and synthesized transactions.
+	xrayPropagation XRayPropagation
+	xrayRootLabel   bool
+	// monitor records the events created by the batch.
+	monitor *selfmonitor.Monitor
 }
 
 // NewBatch creates a new BatchData which can accept a
@@ -120,9 +141,84 @@ func (b *Batch) RegisterInvocation(
 	i.FunctionARN = functionARN
 	i.DeadlineMs = deadlineMs
 	i.Timestamp = timestamp
+	i.Coldstart = !b.invoked
+	if b.synthesizeTxns && i.SyntheticTransactionID == "" {
+		i.SyntheticTransactionID = model.NewID(8)
+		i.SyntheticTraceID = model.NewID(16)
+	}
+	b.invoked = true
 	b.currentlyExecutingRequestID = reqID
 }
 
+// EnableSyntheticTransactions enables the synthesis of a transaction for
+// every invocation for which no agent registered or reported a transaction.
+func (b *Batch) EnableSyntheticTransactions() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.synthesizeTxns = true
+}
+
+// SetDefaultMetadata sets the metadata used for the events created by the
+// extension, such as timeout errors, as long as no agent reports metadata.
+func (b *Batch) SetDefaultMetadata(metadata []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.defaultMetadata = metadata
+}
+
+// SetSelfMonitor sets the monitor recording the events created for the
+// invocations.
+func (b *Batch) SetSelfMonitor(monitor *selfmonitor.Monitor) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.monitor = monitor
+}
+
+// SetXRayPropagation sets how the X-Ray trace context of the invocations
+// is recorded in the proxy and synthesized transactions. If rootLabel is
+// true, the raw X-Ray trace ID is added as a label.
+func (b *Batch) SetXRayPropagation(propagation XRayPropagation, rootLabel bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.xrayPropagation = propagation
+	b.xrayRootLabel = rootLabel
+}
+
+// SetXRayTraceContext sets the X-Ray trace context propagated by the Lambda
+// service for the invocation.
+func (b *Batch) SetXRayTraceContext(reqID string, tc XRayTraceContext) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i, ok := b.invocations[reqID]
+	if !ok {
+		return
+	}
+	i.XRay = &tc
+	if b.xrayPropagation == XRayTraceID && i.SyntheticTransactionID != "" && tc.TraceID != "" {
+		i.SyntheticTraceID = tc.TraceID
+	}
+}
+
+// CurrentRequestID returns the request ID of the currently executing
+// invocation, if known.
+func (b *Batch) CurrentRequestID() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.currentlyExecutingRequestID
+}
+
+// TraceContext returns the trace ID and transaction ID registered by the
+// agent, or synthesized, for the invocation with the given request ID, if
+// any.
+func (b *Batch) TraceContext(reqID string) (traceID, transactionID string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if i, ok := b.invocations[reqID]; ok {
+		return i.TraceContext()
+	}
+	return "", ""
+}
+
 // OnAgentInit caches the transaction ID and the payload for the currently
 // executing invocation as reported by the agent. The payload can contain
 // metadata along with partial transaction. Metadata, if available, will
@@ -152,11 +248,8 @@ func (b *Batch) OnAgentInit(reqID, contentEncoding string, raw []byte) error {
 
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if b.metadataBytes == 0 && len(metadata) > 0 {
-		b.metadataBytes, err = b.buf.Write(metadata)
-		if err != nil {
-			return fmt.Errorf("failed to write metadata to buffer: %v", err)
-		}
+	if err := b.setAgentMetadata(metadata); err != nil {
+		return err
 	}
 	i, ok := b.invocations[reqID]
 	if !ok {
@@ -165,6 +258,7 @@ func (b *Batch) OnAgentInit(reqID, contentEncoding string, raw []byte) error {
 		b.invocations[reqID] = i
 	}
 	i.TransactionID, i.AgentPayload = txnID, txnData
+	i.TraceID = gjson.GetBytes(txnData, "transaction.trace_id").String()
 	b.currentlyExecutingRequestID = reqID
 	return nil
 }
@@ -199,11 +293,8 @@ func (b *Batch) AddAgentData(apmData APMData) error {
 	// A request body can either be empty or have a ndjson content with
 	// first line being metadata.
 	data, after, _ := bytes.Cut(raw, newLineSep)
-	if b.metadataBytes == 0 {
-		b.metadataBytes, err = b.buf.Write(data)
-		if err != nil {
-			return fmt.Errorf("failed to write data to buffer: %v", err)
-		}
+	if err := b.setAgentMetadata(data); err != nil {
+		return err
 	}
 	for {
 		data, after, _ = bytes.Cut(after, newLineSep)
@@ -212,6 +303,10 @@ func (b *Batch) AddAgentData(apmData APMData) error {
 			if res.Str != "" && inc.TransactionID == res.Str {
 				inc.TransactionObserved = true
 			}
+		} else if inc.TransactionID == "" && findEventType(data) == transactionEvent {
+			// Without a registered transaction, the transaction reported
+			// by the agent is assumed to be the root transaction.
+			inc.TransactionObserved = true
 		}
 		if err := b.addData(data); err != nil {
 			return err
@@ -232,11 +327,18 @@ func (b *Batch) OnLambdaLogRuntimeDone(reqID, status string, endTime time.Time)
 	return b.finalizeInvocation(reqID, status, endTime)
 }
 
-func (b *Batch) OnPlatformStart(reqID string) {
+func (b *Batch) OnPlatformStart(reqID string, ts time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.platformStartRequestID = reqID
+	if i, ok := b.invocations[reqID]; ok {
+		i.PlatformStart = ts
+	}
 }
 
 func (b *Batch) PlatformStartReqID() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	return b.platformStartRequestID
 }
 
@@ -253,39 +355,129 @@ func (b *Batch) OnPlatformReport(reqID string) (string, int64, time.Time, error)
 	if !ok {
 		return "", 0, time.Time{}, fmt.Errorf("invocation for requestID %s does not exist", reqID)
 	}
+	// Keep the events estimated at shutdown if they were not corrected.
+	for _, ev := range inc.shutdownEvents {
+		if err := b.addData(ev.data); err != nil {
+			return "", 0, time.Time{}, err
+		}
+	}
+	b.shutdownCount -= len(inc.shutdownEvents)
 	delete(b.invocations, reqID)
 	return inc.FunctionARN, inc.DeadlineMs, inc.Timestamp, nil
 }
 
+// OnRuntimeFailure adds an error event for an invocation that failed
+// because the runtime crashed or ran out of memory. No error is added if
+// the agent reported the transaction of the invocation, and thus its
+// error, or if no metadata is available. Without metadata from an agent
+// the default metadata is used. It must be called before OnPlatformReport
+// cleans up the invocation.
+func (b *Batch) OnRuntimeFailure(reqID string, failure RuntimeFailure) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	inc, ok := b.invocations[reqID]
+	if !ok {
+		return fmt.Errorf("invocation for requestID %s does not exist", reqID)
+	}
+	if inc.TransactionObserved {
+		return nil
+	}
+	runtimeErr, err := inc.CreateRuntimeError(failure)
+	if err != nil {
+		return err
+	}
+	return b.writeEvents([]invocationEvent{
+		{data: runtimeErr, metric: selfmonitor.InvocationErrors, optional: true},
+	})
+}
+
 // OnShutdown flushes the data for shipping to APM Server by finalizing all
 // the invocation in the batch. If we haven't received a platform.runtimeDone
 // event for an invocation so far we won't be able to receive it in time thus
-// the status needs to be guessed based on the available information.
+// the status needs to be guessed based on the available information. The
+// events of the invocations finalized with a guessed status are held by the
+// invocations, and shipped with the batch, until their platform.report
+// event, see OnPlatformReportMetrics.
 func (b *Batch) OnShutdown(status string) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	for _, inc := range b.invocations {
+		if inc.Finalized {
+			delete(b.invocations, inc.RequestID)
+			continue
+		}
 		// Assume that the transaction took all the function time.
-		// TODO: @lahsivjar Is it possible to tweak the extension lifecycle in
-		// a way that we receive the platform.report metric for a invocation
-		// consistently and enrich the metrics with reported values?
 		endTime := time.Unix(0, inc.DeadlineMs*int64(time.Millisecond))
-		if err := b.finalizeInvocation(inc.RequestID, status, endTime); err != nil {
+		incStatus := status
+		if !endTime.After(time.Now()) {
+			// The deadline of the invocation has been reached.
+			incStatus = "timeout"
+		}
+		events, err := b.invocationEvents(inc, incStatus, endTime)
+		if err != nil {
+			return err
+		}
+		if events, err = b.withMetadata(events); err != nil {
 			return err
 		}
-		delete(b.invocations, inc.RequestID)
+		for _, ev := range events {
+			b.monitor.Inc(ev.metric)
+		}
+		if b.count+b.shutdownCount == 0 && len(events) > 0 {
+			b.age = time.Now()
+		}
+		b.shutdownCount += len(events)
+		inc.shutdownEvents = events
+		inc.Finalized, inc.FinalizedAtShutdown = true, true
 	}
 	return nil
 }
 
+// OnPlatformReportMetrics corrects the events of an invocation finalized at
+// shutdown with the status and duration of its platform.report event. The
+// duration starts at the platform.start event of the invocation if any. If
+// the report has no status, as with the Logs API, the invocation is assumed
+// to have succeeded unless it lasted until its timeout. Other invocations
+// are not modified. It must be called before OnPlatformReport.
+func (b *Batch) OnPlatformReportMetrics(reqID, status string, duration time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	inc, ok := b.invocations[reqID]
+	if !ok {
+		return fmt.Errorf("invocation for requestID %s does not exist", reqID)
+	}
+	if !inc.FinalizedAtShutdown {
+		return nil
+	}
+	if status == "" {
+		status = "success"
+		if duration >= inc.Timeout() {
+			status = "timeout"
+		}
+	}
+	// Replace the events estimated at shutdown.
+	for _, ev := range inc.shutdownEvents {
+		b.monitor.Add(ev.metric, -1)
+	}
+	b.shutdownCount -= len(inc.shutdownEvents)
+	inc.shutdownEvents = nil
+	inc.Finalized, inc.FinalizedAtShutdown = false, false
+	return b.finalizeInvocation(reqID, status, inc.start().Add(duration))
+}
+
 // AddLambdaData adds a new entry to the batch. Returns ErrBatchFull
-// if batch has reached its maximum size.
+// if batch has reached its maximum size. The data is created by the
+// extension, so the default metadata is used if no agent reported
+// metadata.
 func (b *Batch) AddLambdaData(d []byte) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	if b.count >= b.maxSize {
 		return ErrBatchFull
 	}
+	if err := b.ensureMetadata(); err != nil {
+		return err
+	}
 	return b.addData(d)
 }
 
@@ -293,7 +485,7 @@ func (b *Batch) AddLambdaData(d []byte) error {
 func (b *Batch) Count() int {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
-	return b.count
+	return b.count + b.shutdownCount
 }
 
 // ShouldShip indicates when a batch is ready for sending.
@@ -304,7 +496,7 @@ func (b *Batch) Count() int {
 func (b *Batch) ShouldShip() bool {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
-	return (b.count >= int(float64(b.maxSize)*maxSizeThreshold)) ||
+	return (b.count+b.shutdownCount >= int(float64(b.maxSize)*maxSizeThreshold)) ||
 		(!b.age.IsZero() && time.Since(b.age) > b.maxAge)
 }
 
@@ -312,16 +504,40 @@ func (b *Batch) ShouldShip() bool {
 func (b *Batch) Reset() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.count, b.age = 0, zeroTime
+	b.count, b.shutdownCount, b.age = 0, 0, zeroTime
+	if b.defaultMetadataUsed {
+		// The next batch may get the metadata of an agent.
+		b.metadataBytes, b.defaultMetadataUsed = 0, false
+	}
 	b.buf.Truncate(b.metadataBytes)
+	// The events of the invocations finalized at shutdown are shipped and
+	// can no longer be corrected.
+	for reqID, inc := range b.invocations {
+		if inc.FinalizedAtShutdown {
+			delete(b.invocations, reqID)
+		}
+	}
 }
 
-// ToAPMData returns APMData with metadata and the accumulated batch
+// ToAPMData returns APMData with metadata and the accumulated batch,
+// including the events of the invocations finalized at shutdown.
 func (b *Batch) ToAPMData() APMData {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
+	if b.shutdownCount == 0 {
+		return APMData{
+			Data: b.buf.Bytes(),
+		}
+	}
+	data := append([]byte(nil), b.buf.Bytes()...)
+	for _, inc := range b.invocations {
+		for _, ev := range inc.shutdownEvents {
+			data = append(data, '\n')
+			data = append(data, ev.data...)
+		}
+	}
 	return APMData{
-		Data: b.buf.Bytes(),
+		Data: data,
 	}
 }
 
@@ -330,18 +546,129 @@ func (b *Batch) finalizeInvocation(reqID, status string, endTime time.Time) erro
 	if !ok {
 		return fmt.Errorf("invocation for requestID %s does not exist", reqID)
 	}
-	proxyTxn, err := inc.MaybeCreateProxyTxn(status, endTime)
+	events, err := b.invocationEvents(inc, status, endTime)
 	if err != nil {
 		return err
 	}
-	err = b.addData(proxyTxn)
-	if err != nil {
+	if err := b.writeEvents(events); err != nil {
 		return err
 	}
 	inc.Finalized = true
 	return nil
 }
 
+// invocationEvents creates the events of a finalized invocation: the proxy
+// transaction, the synthesized transaction and the timeout error, if any.
+func (b *Batch) invocationEvents(inc *Invocation, status string, endTime time.Time) ([]invocationEvent, error) {
+	var events []invocationEvent
+	proxyTxn, err := inc.MaybeCreateProxyTxn(status, endTime)
+	if err != nil {
+		return nil, err
+	}
+	proxyTxn, err = inc.addXRayContext(proxyTxn, true, b.xrayRootLabel)
+	if err != nil {
+		return nil, err
+	}
+	if len(proxyTxn) > 0 {
+		events = append(events, invocationEvent{data: proxyTxn, metric: selfmonitor.ProxyTransactions})
+	}
+	if inc.NeedSyntheticTransaction() {
+		syntheticTxn, err := inc.CreateSyntheticTxn(status, endTime)
+		if err != nil {
+			return nil, err
+		}
+		syntheticTxn, err = inc.addXRayContext(syntheticTxn, b.xrayPropagation == XRayLink, b.xrayRootLabel)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, invocationEvent{data: syntheticTxn, metric: selfmonitor.SyntheticTransactions})
+	}
+	// Timeouts are reported as errors unless the agent reported the
+	// transaction.
+	if status == "timeout" && !inc.Finalized && !inc.TransactionObserved {
+		timeoutErr, err := inc.CreateTimeoutError(endTime)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, invocationEvent{data: timeoutErr, metric: selfmonitor.InvocationErrors, optional: true})
+	}
+	return events, nil
+}
+
+// writeEvents adds the events created by the extension for an invocation
+// to the batch. The caller must hold the lock.
+func (b *Batch) writeEvents(events []invocationEvent) error {
+	events, err := b.withMetadata(events)
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		if err := b.addData(ev.data); err != nil {
+			return err
+		}
+		b.monitor.Inc(ev.metric)
+	}
+	return nil
+}
+
+// withMetadata makes sure that metadata is available for the events,
+// using the default metadata if no agent reported metadata. Without
+// metadata the optional events are dropped and ErrMetadataUnavailable is
+// returned for the others. The caller must hold the lock.
+func (b *Batch) withMetadata(events []invocationEvent) ([]invocationEvent, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+	if err := b.ensureMetadata(); err != nil {
+		return nil, err
+	}
+	if b.metadataBytes > 0 {
+		return events, nil
+	}
+	for _, ev := range events {
+		if !ev.optional {
+			return nil, ErrMetadataUnavailable
+		}
+	}
+	return nil, nil
+}
+
+// ensureMetadata writes the default metadata if no agent reported
+// metadata. The caller must hold the lock.
+func (b *Batch) ensureMetadata() error {
+	if b.metadataBytes > 0 || len(b.defaultMetadata) == 0 {
+		return nil
+	}
+	var err error
+	b.metadataBytes, err = b.buf.Write(b.defaultMetadata)
+	if err != nil {
+		return fmt.Errorf("failed to write metadata to buffer: %v", err)
+	}
+	b.defaultMetadataUsed = true
+	return nil
+}
+
+// setAgentMetadata sets the metadata reported by an agent as the metadata
+// of the batch, unless an agent already reported metadata. It replaces the
+// default metadata, the events of the batch are kept. The caller must hold
+// the lock.
+func (b *Batch) setAgentMetadata(metadata []byte) error {
+	if len(metadata) == 0 || (b.metadataBytes > 0 && !b.defaultMetadataUsed) {
+		return nil
+	}
+	events := append([]byte(nil), b.buf.Bytes()[b.metadataBytes:]...)
+	b.buf.Reset()
+	var err error
+	if b.metadataBytes, err = b.buf.Write(metadata); err != nil {
+		return fmt.Errorf("failed to write metadata to buffer: %v", err)
+	}
+	b.defaultMetadataUsed = false
+	if _, err := b.buf.Write(events); err != nil {
+		return fmt.Errorf("failed to write data to buffer: %v", err)
+	}
+	return nil
+}
+
 func (b *Batch) addData(data []byte) error {
 	if len(data) == 0 {
 		return nil
@@ -19,11 +19,13 @@ package accumulator
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
 
@@ -34,6 +36,12 @@ func TestAdd(t *testing.T) {
 		b := NewBatch(1, time.Hour)
 		assert.ErrorIs(t, b.AddLambdaData([]byte(`{"log":{}}`)), ErrMetadataUnavailable)
 	})
+	t.Run("default-metadata-without-agent", func(t *testing.T) {
+		b := NewBatch(1, time.Hour)
+		b.SetDefaultMetadata([]byte(metadata))
+		require.NoError(t, b.AddLambdaData([]byte(`{"log":{}}`)))
+		assert.Equal(t, metadata+"\n"+`{"log":{}}`, string(b.ToAPMData().Data))
+	})
 	t.Run("empty-with-metadata", func(t *testing.T) {
 		b := NewBatch(1, time.Hour)
 		b.RegisterInvocation("test", "arn", 500, time.Now())
@@ -96,6 +104,33 @@ func TestShouldShip_ReasonAge(t *testing.T) {
 	assert.True(t, b.ShouldShip())
 }
 
+func TestCurrentRequestID(t *testing.T) {
+	b := NewBatch(10, time.Hour)
+	assert.Empty(t, b.CurrentRequestID())
+
+	b.RegisterInvocation("test-1", "arn", 500, time.Now())
+	assert.Equal(t, "test-1", b.CurrentRequestID())
+	b.RegisterInvocation("test-2", "arn", 500, time.Now())
+	assert.Equal(t, "test-2", b.CurrentRequestID())
+}
+
+func TestTraceContext(t *testing.T) {
+	b := NewBatch(10, time.Hour)
+	b.RegisterInvocation("test-1", "arn", 500, time.Now())
+	traceID, txnID := b.TraceContext("test-1")
+	assert.Empty(t, traceID)
+	assert.Empty(t, txnID)
+
+	require.NoError(t, b.OnAgentInit("test-1", "", []byte(`{"transaction":{"id":"023d90ff77f13b9f","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`)))
+	traceID, txnID = b.TraceContext("test-1")
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", traceID)
+	assert.Equal(t, "023d90ff77f13b9f", txnID)
+
+	traceID, txnID = b.TraceContext("unknown")
+	assert.Empty(t, traceID)
+	assert.Empty(t, txnID)
+}
+
 func TestLifecycle(t *testing.T) {
 	reqID := "test-req-id"
 	fnARN := "test-fn-arn"
@@ -115,6 +150,9 @@ func TestLifecycle(t *testing.T) {
 		receiveAgentRootTxn     bool
 		receiveLambdaLogRuntime bool
 		expected                string
+		// timeoutError is true if an error event is expected after
+		// the expected data for the invocation timing out.
+		timeoutError bool
 	}{
 		{
 			name:                    "without_agent_init_without_root_txn",
@@ -127,6 +165,7 @@ func TestLifecycle(t *testing.T) {
 				metadata,
 				lambdaData,
 			),
+			timeoutError: true,
 		},
 		{
 			name:                    "without_agent_init_with_root_txn",
@@ -175,7 +214,7 @@ func TestLifecycle(t *testing.T) {
 				"%s\n%s\n%s",
 				metadata,
 				lambdaData,
-				generateCompleteTxn(t, txnData, "failure", "failure", txnDur),
+				generateProxyTxn(t, txnData, "failure", "failure", ts, txnDur),
 			),
 		},
 		{
@@ -189,7 +228,7 @@ func TestLifecycle(t *testing.T) {
 				"%s\n%s\n%s",
 				metadata,
 				lambdaData,
-				generateCompleteTxn(t, txnData, "failure", "failure", txnDur),
+				generateProxyTxn(t, txnData, "failure", "failure", ts, txnDur),
 			),
 		},
 		{
@@ -204,8 +243,9 @@ func TestLifecycle(t *testing.T) {
 				"%s\n%s\n%s",
 				metadata,
 				lambdaData,
-				generateCompleteTxn(t, txnData, "timeout", "failure", txnDur),
+				generateProxyTxn(t, txnData, "timeout", "failure", ts, txnDur),
 			),
+			timeoutError: true,
 		},
 		{
 			name:                    "with_meta_agent_init_without_root_txn",
@@ -219,8 +259,9 @@ func TestLifecycle(t *testing.T) {
 				"%s\n%s\n%s",
 				metadata,
 				lambdaData,
-				generateCompleteTxn(t, txnData, "timeout", "failure", txnDur),
+				generateProxyTxn(t, txnData, "timeout", "failure", ts, txnDur),
 			),
+			timeoutError: true,
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
@@ -257,7 +298,329 @@ func TestLifecycle(t *testing.T) {
 			}
 			// Instance shutdown
 			require.NoError(t, b.OnShutdown("timeout"))
-			assert.Equal(t, tc.expected, string(b.ToAPMData().Data))
+			data := string(b.ToAPMData().Data)
+			if tc.timeoutError {
+				var timeoutErr string
+				data, timeoutErr, _ = strings.Cut(data, "\n{\"error\"")
+				timeoutErr = `{"error"` + timeoutErr
+				assert.Equal(t, TimeoutErrorType, gjson.Get(timeoutErr, "error.exception.type").String())
+				assert.Equal(t, reqID, gjson.Get(timeoutErr, "error.context.tags.faas_execution").String())
+			}
+			assert.Equal(t, tc.expected, data)
+		})
+	}
+}
+
+func TestRuntimeDoneTimeout(t *testing.T) {
+	ts := time.Now()
+	b := NewBatch(100, time.Hour)
+	b.RegisterInvocation("test-req-id", "arn", ts.Add(time.Second).UnixMilli(), ts)
+	require.NoError(t, b.OnAgentInit(
+		"test-req-id", "",
+		[]byte(metadata+"\n"+`{"transaction":{"id":"023d90ff77f13b9f","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`),
+	))
+	require.NoError(t, b.OnLambdaLogRuntimeDone("test-req-id", "timeout", ts.Add(time.Second)))
+
+	lines := strings.Split(string(b.ToAPMData().Data), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "timeout", gjson.Get(lines[1], "transaction.result").String())
+	assert.Equal(t, TimeoutErrorType, gjson.Get(lines[2], "error.exception.type").String())
+	assert.Equal(t, "023d90ff77f13b9f", gjson.Get(lines[2], "error.transaction_id").String())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", gjson.Get(lines[2], "error.trace_id").String())
+
+	// The invocation is finalized, the timeout is reported once.
+	require.NoError(t, b.OnShutdown("timeout"))
+	assert.Len(t, strings.Split(string(b.ToAPMData().Data), "\n"), 3)
+
+	// Without an agent the error is sent with the default metadata.
+	b = NewBatch(100, time.Hour)
+	b.SetDefaultMetadata([]byte(metadata))
+	b.RegisterInvocation("test-req-id", "arn", ts.Add(time.Second).UnixMilli(), ts)
+	require.NoError(t, b.OnLambdaLogRuntimeDone("test-req-id", "timeout", ts.Add(time.Second)))
+	lines = strings.Split(string(b.ToAPMData().Data), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, metadata, lines[0])
+	assert.Equal(t, TimeoutErrorType, gjson.Get(lines[1], "error.exception.type").String())
+	assert.Equal(t, "test-req-id", gjson.Get(lines[1], "error.context.tags.faas_execution").String())
+}
+
+func TestRuntimeFailure(t *testing.T) {
+	ts := time.Now()
+	b := NewBatch(100, time.Hour)
+	b.RegisterInvocation("test-req-id", "arn", ts.Add(time.Minute).UnixMilli(), ts)
+	require.NoError(t, b.OnAgentInit(
+		"test-req-id", "",
+		[]byte(metadata+"\n"+`{"transaction":{"id":"023d90ff77f13b9f","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`),
+	))
+	require.NoError(t, b.OnLambdaLogRuntimeDone("test-req-id", "error", ts.Add(time.Second)))
+	require.NoError(t, b.OnRuntimeFailure("test-req-id", RuntimeFailure{
+		Status:          "error",
+		ErrorType:       ExitErrorType,
+		Time:            ts.Add(time.Second),
+		MaxMemoryUsedMB: 128,
+		MemorySizeMB:    128,
+	}))
+
+	lines := strings.Split(string(b.ToAPMData().Data), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "failure", gjson.Get(lines[1], "transaction.outcome").String())
+	assert.Equal(t, OutOfMemoryErrorType, gjson.Get(lines[2], "error.exception.type").String())
+	assert.Equal(t, "023d90ff77f13b9f", gjson.Get(lines[2], "error.transaction_id").String())
+
+	// No error is added if the agent reported the transaction.
+	b.RegisterInvocation("test-req-id-2", "arn", ts.Add(time.Minute).UnixMilli(), ts)
+	require.NoError(t, b.OnAgentInit("test-req-id-2", "", []byte(`{"transaction":{"id":"9d28f2d4a7c3e1b0","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`)))
+	require.NoError(t, b.AddAgentData(APMData{
+		Data:      []byte(metadata + "\n" + `{"transaction":{"id":"9d28f2d4a7c3e1b0","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`),
+		AgentInfo: "test-req-id-2",
+	}))
+	require.NoError(t, b.OnLambdaLogRuntimeDone("test-req-id-2", "error", ts.Add(time.Second)))
+	require.NoError(t, b.OnRuntimeFailure("test-req-id-2", RuntimeFailure{Status: "error", Time: ts.Add(time.Second)}))
+	assert.Len(t, strings.Split(string(b.ToAPMData().Data), "\n"), 4)
+
+	_, _, _, err := b.OnPlatformReport("test-req-id")
+	require.NoError(t, err)
+	assert.Error(t, b.OnRuntimeFailure("test-req-id", RuntimeFailure{Status: "error"}))
+
+	// Without agent data the error is sent with the default metadata.
+	b = NewBatch(100, time.Hour)
+	b.SetDefaultMetadata([]byte(metadata))
+	b.RegisterInvocation("test-req-id", "arn", ts.Add(time.Minute).UnixMilli(), ts)
+	require.NoError(t, b.OnRuntimeFailure("test-req-id", RuntimeFailure{
+		Status:          "error",
+		ErrorType:       ExitErrorType,
+		Time:            ts.Add(time.Second),
+		MaxMemoryUsedMB: 128,
+		MemorySizeMB:    128,
+	}))
+	lines = strings.Split(string(b.ToAPMData().Data), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, metadata, lines[0])
+	assert.Equal(t, OutOfMemoryErrorType, gjson.Get(lines[1], "error.exception.type").String())
+	assert.Equal(t, "test-req-id", gjson.Get(lines[1], "error.context.tags.faas_execution").String())
+}
+
+func TestProxyTxnPlatformStart(t *testing.T) {
+	ts := time.Date(2022, time.October, 1, 1, 1, 1, 0, time.UTC)
+	b := NewBatch(100, time.Hour)
+	b.RegisterInvocation("test-req-id", "arn", ts.Add(time.Minute).UnixMilli(), ts)
+	require.NoError(t, b.OnAgentInit(
+		"test-req-id", "",
+		[]byte(metadata+"\n"+`{"transaction":{"id":"023d90ff77f13b9f","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`),
+	))
+	// The platform.start event precedes the registration of the invocation.
+	b.OnPlatformStart("test-req-id", ts.Add(-20*time.Millisecond))
+	require.NoError(t, b.OnLambdaLogRuntimeDone("test-req-id", "success", ts.Add(100*time.Millisecond)))
+
+	lines := strings.Split(string(b.ToAPMData().Data), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, int64(120), gjson.Get(lines[1], "transaction.duration").Int())
+}
+
+func TestShutdownReportCorrection(t *testing.T) {
+	ts := time.Now().Truncate(time.Millisecond)
+	b := NewBatch(100, time.Hour)
+	for _, reqID := range []string{"req-1", "req-2"} {
+		b.RegisterInvocation(reqID, "arn", ts.Add(-time.Second).UnixMilli(), ts.Add(-10*time.Second))
+		require.NoError(t, b.OnAgentInit(
+			reqID, "",
+			[]byte(metadata+"\n"+`{"transaction":{"id":"023d90ff77f13b9f","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`),
+		))
+	}
+	// The invocations are finalized at shutdown without platform.runtimeDone
+	// events, the deadline has been reached.
+	require.NoError(t, b.OnShutdown("spindown"))
+	lines := strings.Split(string(b.ToAPMData().Data), "\n")
+	require.Len(t, lines, 5)
+	assert.Equal(t, 2, b.Size())
+	for _, line := range lines[1:] {
+		if gjson.Get(line, "transaction").Exists() {
+			assert.Equal(t, "timeout", gjson.Get(line, "transaction.result").String())
+			assert.Equal(t, int64(9000), gjson.Get(line, "transaction.duration").Int())
+		}
+	}
+	require.NoError(t, b.AddLambdaData([]byte(`{"log":{}}`)))
+
+	// The platform.report event of the first invocation corrects its
+	// transaction and removes its timeout error.
+	require.NoError(t, b.OnPlatformReportMetrics("req-1", "", 1500*time.Millisecond))
+	_, _, _, err := b.OnPlatformReport("req-1")
+	require.NoError(t, err)
+
+	lines = strings.Split(string(b.ToAPMData().Data), "\n")
+	require.Len(t, lines, 5)
+	var results []string
+	for _, line := range lines[1:] {
+		if txn := gjson.Get(line, "transaction"); txn.Exists() {
+			results = append(results, txn.Get("result").String())
+			if txn.Get("result").String() == "success" {
+				assert.Equal(t, int64(1500), txn.Get("duration").Int())
+				assert.False(t, txn.Get("outcome").Exists())
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{"timeout", "success"}, results)
+	assert.Contains(t, lines, `{"log":{}}`)
+	assert.Equal(t, 4, b.Count())
+
+	// The platform.report event of the second invocation corrects it too.
+	require.NoError(t, b.OnPlatformReportMetrics("req-2", "", 2500*time.Millisecond))
+	_, _, _, err = b.OnPlatformReport("req-2")
+	require.NoError(t, err)
+
+	lines = strings.Split(string(b.ToAPMData().Data), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, `{"log":{}}`, lines[1])
+	assert.Equal(t, int64(1500), gjson.Get(lines[2], "transaction.duration").Int())
+	assert.Equal(t, int64(2500), gjson.Get(lines[3], "transaction.duration").Int())
+	for _, line := range lines[2:] {
+		assert.Equal(t, "success", gjson.Get(line, "transaction.result").String())
+	}
+	assert.Equal(t, 3, b.Count())
+
+	// Once shipped the invocations can no longer be corrected.
+	b.RegisterInvocation("req-3", "arn", ts.Add(-time.Second).UnixMilli(), ts.Add(-10*time.Second))
+	require.NoError(t, b.OnShutdown("spindown"))
+	assert.Equal(t, 4, b.Count())
+	b.Reset()
+	assert.Equal(t, 0, b.Size())
+	assert.Equal(t, 0, b.Count())
+	assert.Error(t, b.OnPlatformReportMetrics("req-3", "", time.Second))
+}
+
+func TestSyntheticTransaction(t *testing.T) {
+	ts := time.Date(2022, time.October, 1, 1, 1, 1, 0, time.UTC)
+	fnARN := "arn:aws:lambda:us-east-1:123456789012:function:my-function"
+
+	b := NewBatch(100, time.Hour)
+	b.SetDefaultMetadata([]byte(metadata))
+	b.EnableSyntheticTransactions()
+	b.SetXRayPropagation(XRayTraceID, false)
+	b.RegisterInvocation("req-1", fnARN, ts.Add(time.Minute).UnixMilli(), ts)
+	b.SetXRayTraceContext("req-1", XRayTraceContext{
+		Root:     "1-5759e988-bd862e3fe1be46a994272793",
+		TraceID:  "5759e988bd862e3fe1be46a994272793",
+		ParentID: "53995c3f42cd8ad8",
+	})
+	b.OnPlatformStart("req-1", ts.Add(10*time.Millisecond))
+
+	traceID, txnID := b.TraceContext("req-1")
+	assert.Equal(t, "5759e988bd862e3fe1be46a994272793", traceID)
+	assert.Len(t, txnID, 16)
+
+	// Without an agent the default metadata is used.
+	require.NoError(t, b.AddLambdaData([]byte(`{"log":{}}`)))
+	require.NoError(t, b.OnLambdaLogRuntimeDone("req-1", "error", ts.Add(260*time.Millisecond)))
+
+	lines := strings.Split(string(b.ToAPMData().Data), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, metadata, lines[0])
+	txn := gjson.Get(lines[2], "transaction")
+	assert.Equal(t, txnID, txn.Get("id").String())
+	assert.Equal(t, traceID, txn.Get("trace_id").String())
+	assert.False(t, txn.Get("links").Exists())
+	assert.Equal(t, "my-function", txn.Get("name").String())
+	assert.Equal(t, ts.Add(10*time.Millisecond).UnixMicro(), txn.Get("timestamp").Int())
+	assert.Equal(t, 250.0, txn.Get("duration").Float())
+	assert.Equal(t, "error", txn.Get("result").String())
+	assert.Equal(t, "failure", txn.Get("outcome").String())
+	assert.Equal(t, fnARN, txn.Get("faas.id").String())
+	assert.Equal(t, "my-function", txn.Get("faas.name").String())
+	assert.Equal(t, "req-1", txn.Get("faas.execution").String())
+	assert.True(t, txn.Get("faas.coldstart").Bool())
+
+	// No transaction is synthesized for invocations registered by an agent.
+	b.Reset()
+	b.RegisterInvocation("req-2", fnARN, ts.Add(time.Minute).UnixMilli(), ts)
+	require.NoError(t, b.OnAgentInit("req-2", "", []byte(`{"transaction":{"id":"023d90ff77f13b9f","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`)))
+	require.NoError(t, b.AddAgentData(APMData{Data: []byte(metadata + "\n" + `{"transaction":{"id":"023d90ff77f13b9f"}}`)}))
+	require.NoError(t, b.OnLambdaLogRuntimeDone("req-2", "success", ts.Add(time.Second)))
+	lines = strings.Split(string(b.ToAPMData().Data), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "023d90ff77f13b9f", gjson.Get(lines[1], "transaction.id").String())
+}
+
+func TestDefaultMetadata(t *testing.T) {
+	agentMetadata := strings.Replace(metadata, "apm-lambda-extension", "python", 1)
+	fnARN := "arn:aws:lambda:us-east-1:123456789012:function:my-function"
+	ts := time.Date(2022, time.October, 1, 1, 1, 1, 0, time.UTC)
+
+	t.Run("agent-registers-after-platform-event", func(t *testing.T) {
+		b := NewBatch(100, time.Hour)
+		b.SetDefaultMetadata([]byte(metadata))
+		b.EnableSyntheticTransactions()
+		b.RegisterInvocation("req-1", fnARN, ts.Add(time.Minute).UnixMilli(), ts)
+		require.NoError(t, b.AddLambdaData([]byte(`{"log":{}}`)))
+		require.NoError(t, b.OnAgentInit("req-1", "", []byte(agentMetadata+"\n"+`{"transaction":{"id":"023d90ff77f13b9f"}}`)))
+
+		lines := strings.Split(string(b.ToAPMData().Data), "\n")
+		require.Len(t, lines, 2)
+		assert.Equal(t, agentMetadata, lines[0])
+		assert.Equal(t, `{"log":{}}`, lines[1])
+
+		// The agent metadata is kept for the next batches.
+		b.Reset()
+		require.NoError(t, b.AddLambdaData([]byte(`{"log":{}}`)))
+		lines = strings.Split(string(b.ToAPMData().Data), "\n")
+		require.Len(t, lines, 2)
+		assert.Equal(t, agentMetadata, lines[0])
+	})
+	t.Run("agent-data-after-shipped-batch", func(t *testing.T) {
+		b := NewBatch(100, time.Hour)
+		b.SetDefaultMetadata([]byte(metadata))
+		b.EnableSyntheticTransactions()
+		b.RegisterInvocation("req-1", fnARN, ts.Add(time.Minute).UnixMilli(), ts)
+		require.NoError(t, b.AddLambdaData([]byte(`{"log":{}}`)))
+		assert.Equal(t, metadata, strings.Split(string(b.ToAPMData().Data), "\n")[0])
+
+		b.Reset()
+		require.NoError(t, b.AddAgentData(APMData{Data: []byte(agentMetadata + "\n" + `{"transaction":{"id":"023d90ff77f13b9f"}}`)}))
+		lines := strings.Split(string(b.ToAPMData().Data), "\n")
+		require.Len(t, lines, 2)
+		assert.Equal(t, agentMetadata, lines[0])
+	})
+}
+
+func TestXRayLinks(t *testing.T) {
+	ts := time.Now()
+	xrayContext := XRayTraceContext{
+		Root:     "1-5759e988-bd862e3fe1be46a994272793",
+		TraceID:  "5759e988bd862e3fe1be46a994272793",
+		ParentID: "53995c3f42cd8ad8",
+	}
+
+	for name, tc := range map[string]struct {
+		agentInit bool
+		rootLabel bool
+	}{
+		"proxy transaction":                  {agentInit: true},
+		"proxy transaction with root label":  {agentInit: true, rootLabel: true},
+		"synthesized transaction":            {},
+		"synthesized transaction with label": {rootLabel: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := NewBatch(100, time.Hour)
+			b.SetDefaultMetadata([]byte(metadata))
+			b.EnableSyntheticTransactions()
+			b.SetXRayPropagation(XRayLink, tc.rootLabel)
+			b.RegisterInvocation("req-1", "arn", ts.Add(time.Minute).UnixMilli(), ts)
+			b.SetXRayTraceContext("req-1", xrayContext)
+			if tc.agentInit {
+				require.NoError(t, b.OnAgentInit("req-1", "", []byte(metadata+"\n"+`{"transaction":{"id":"023d90ff77f13b9f","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`)))
+			}
+			require.NoError(t, b.OnLambdaLogRuntimeDone("req-1", "success", ts.Add(time.Second)))
+
+			lines := strings.Split(string(b.ToAPMData().Data), "\n")
+			require.Len(t, lines, 2)
+			txn := gjson.Get(lines[1], "transaction")
+			assert.NotEqual(t, xrayContext.TraceID, txn.Get("trace_id").String())
+			assert.Equal(t, xrayContext.TraceID, txn.Get("links.0.trace_id").String())
+			assert.Equal(t, xrayContext.ParentID, txn.Get("links.0.span_id").String())
+			if tc.rootLabel {
+				assert.Equal(t, xrayContext.Root, txn.Get("context.tags.xray_trace_id").String())
+			} else {
+				assert.False(t, txn.Get("context.tags.xray_trace_id").Exists())
+			}
 		})
 	}
 }
@@ -277,6 +640,17 @@ func TestFindEventType(t *testing.T) {
 	}
 }
 
+// generateProxyTxn returns the proxy transaction created from the partial
+// transaction src for an invocation started at start.
+func generateProxyTxn(t *testing.T, src, result, outcome string, start time.Time, d time.Duration) string {
+	t.Helper()
+	tmp, err := sjson.SetBytes([]byte(src), "transaction.result", result)
+	require.NoError(t, err)
+	tmp, err = sjson.SetBytes(tmp, "transaction.timestamp", start.UnixMicro())
+	require.NoError(t, err)
+	return generateCompleteTxn(t, string(tmp), result, outcome, d)
+}
+
 func generateCompleteTxn(t *testing.T, src, result, outcome string, d time.Duration) string {
 	t.Helper()
 	tmp, err := sjson.SetBytes([]byte(src), "transaction.result", result)
@@ -18,11 +18,61 @@
 package accumulator
 
 import (
+	"fmt"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
 	"github.com/tidwall/sjson"
+	"go.elastic.co/fastjson"
 )
 
+// Exception types of the error events created for invocations that timed
+// out or failed without the agent reporting the error. They match the error
+// types reported by the Lambda platform.
+const (
+	TimeoutErrorType     = "Sandbox.Timedout"
+	OutOfMemoryErrorType = "Runtime.OutOfMemory"
+	ExitErrorType        = "Runtime.ExitError"
+)
+
+// RuntimeFailure describes an invocation that failed because the runtime
+// crashed or was killed, as reported by the `platform.runtimeDone` and
+// `platform.report` events.
+type RuntimeFailure struct {
+	// Status is the status of the invocation, error or failure.
+	Status string
+	// ErrorType is the error type reported by the Lambda platform, if any.
+	ErrorType string
+	// Time is the time of the `platform.report` event.
+	Time time.Time
+	// MaxMemoryUsedMB and MemorySizeMB are the memory used by the
+	// invocation and the memory configured for the function.
+	MaxMemoryUsedMB int
+	MemorySizeMB    int
+}
+
+// OutOfMemory returns true if the invocation used all the memory
+// configured for the function.
+func (f RuntimeFailure) OutOfMemory() bool {
+	return f.MemorySizeMB > 0 && f.MaxMemoryUsedMB >= f.MemorySizeMB
+}
+
+// Type returns the exception type of the failure. Running out of memory
+// takes precedence over the error type reported by the platform, which is
+// usually a generic exit error for runtimes killed by the OOM killer.
+func (f RuntimeFailure) Type() string {
+	switch {
+	case f.OutOfMemory():
+		return OutOfMemoryErrorType
+	case f.ErrorType != "":
+		return f.ErrorType
+	default:
+		return ExitErrorType
+	}
+}
+
 // Invocation holds data for each function invocation and finalizes
 // the data when `platform.report` type log is received for the
 // specific invocation identified by request ID.
@@ -39,6 +89,9 @@ type Invocation struct {
 	// TransactionID is the ID generated for a transaction for the
 	// current invocation. It is populated by the request from agent.
 	TransactionID string
+	// TraceID is the ID of the trace of the transaction for the current
+	// invocation. It is populated by the request from agent.
+	TraceID string
 	// AgentPayload is the partial transaction registered at agent init.
 	// It will be used to create a proxy transaction by enriching the
 	// payload with data from `platform.runtimeDone` event if agent fails
@@ -49,6 +102,151 @@ type Invocation struct {
 	TransactionObserved bool
 	// Finalized tracks if the invocation has been finalized or not.
 	Finalized bool
+	// SyntheticTransactionID and SyntheticTraceID are the IDs of the
+	// transaction synthesized for the invocation if no agent registered
+	// or reported a transaction. They are only set if the synthesis of
+	// transactions is enabled.
+	SyntheticTransactionID string
+	SyntheticTraceID       string
+	// XRay is the X-Ray trace context propagated by the Lambda service,
+	// if any.
+	XRay *XRayTraceContext
+	// PlatformStart is the time of the `platform.start` event of the
+	// invocation.
+	PlatformStart time.Time
+	// Coldstart is true for the first invocation of the execution
+	// environment.
+	Coldstart bool
+	// FinalizedAtShutdown is true if the invocation was finalized at
+	// shutdown without a `platform.runtimeDone` event. Its events are
+	// estimated and can be corrected by its `platform.report` event.
+	FinalizedAtShutdown bool
+	// shutdownEvents holds the events estimated for the invocation
+	// finalized at shutdown until they are shipped or corrected.
+	shutdownEvents []invocationEvent
+}
+
+// invocationEvent is an event created by the extension for an invocation.
+type invocationEvent struct {
+	data []byte
+	// metric is the self-monitoring counter of the event.
+	metric string
+	// optional events are dropped if no metadata is available.
+	optional bool
+}
+
+// start returns the start time of the invocation, the time of its
+// `platform.start` event if received, else the time of its invoke event.
+func (inc *Invocation) start() time.Time {
+	if !inc.PlatformStart.IsZero() {
+		return inc.PlatformStart
+	}
+	return inc.Timestamp
+}
+
+// XRayTraceContext is the X-Ray trace context propagated by the Lambda
+// service to an invocation, as found in the tracing value of invoke events.
+type XRayTraceContext struct {
+	// Root is the X-Ray trace ID, e.g. 1-5759e988-bd862e3fe1be46a994272793.
+	Root string
+	// TraceID is the W3C trace ID derived from the X-Ray trace ID.
+	TraceID string
+	// ParentID is the ID of the parent segment.
+	ParentID string
+}
+
+// XRayPropagation defines how the X-Ray trace context of an invocation is
+// recorded in the proxy and synthesized transactions.
+type XRayPropagation int
+
+const (
+	// XRayLink records the X-Ray trace context as a span link.
+	XRayLink XRayPropagation = iota
+	// XRayTraceID uses the W3C trace ID derived from the X-Ray trace ID as
+	// the trace ID of synthesized transactions. The trace of proxy
+	// transactions is chosen by the agent, they get a span link.
+	XRayTraceID
+)
+
+// xrayRootLabel is the label holding the raw X-Ray trace ID.
+const xrayRootLabel = "xray_trace_id"
+
+// addXRayContext records the X-Ray trace context of the invocation in the
+// transaction, as a span link and, if rootLabel is true, as a label.
+func (inc *Invocation) addXRayContext(txn []byte, link, rootLabel bool) ([]byte, error) {
+	if inc.XRay == nil || len(txn) == 0 {
+		return txn, nil
+	}
+	var err error
+	if link && inc.XRay.TraceID != "" && inc.XRay.ParentID != "" {
+		txn, err = sjson.SetBytes(txn, "transaction.links.-1", model.Link{
+			TraceID: inc.XRay.TraceID,
+			SpanID:  inc.XRay.ParentID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rootLabel {
+		txn, err = sjson.SetBytes(txn, "transaction.context.tags."+xrayRootLabel, inc.XRay.Root)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return txn, nil
+}
+
+// TraceContext returns the trace ID and transaction ID of the transaction
+// of the invocation, either registered by the agent or synthesized.
+func (inc *Invocation) TraceContext() (traceID, transactionID string) {
+	if inc.TransactionID == "" && inc.SyntheticTransactionID != "" {
+		return inc.SyntheticTraceID, inc.SyntheticTransactionID
+	}
+	return inc.TraceID, inc.TransactionID
+}
+
+// NeedSyntheticTransaction returns true if a transaction needs to be
+// synthesized as no agent registered or reported a transaction for the
+// invocation.
+func (inc *Invocation) NeedSyntheticTransaction() bool {
+	return !inc.Finalized && inc.SyntheticTransactionID != "" && inc.TransactionID == "" && !inc.TransactionObserved
+}
+
+// CreateSyntheticTxn creates a transaction for an invocation from the
+// invoke event and the `platform.start` and `platform.runtimeDone` events.
+func (inc *Invocation) CreateSyntheticTxn(status string, endTime time.Time) ([]byte, error) {
+	start := inc.start()
+	fnName := inc.FunctionARN
+	// The function ARN is of the form arn:aws:lambda:<region>:<account>:function:<name>[:<qualifier>].
+	if parts := strings.Split(inc.FunctionARN, ":"); len(parts) >= 7 {
+		fnName = parts[6]
+	}
+	coldstart := inc.Coldstart
+	txn := &model.Transaction{
+		ID:        inc.SyntheticTransactionID,
+		TraceID:   inc.SyntheticTraceID,
+		Name:      fnName,
+		Type:      "request",
+		Timestamp: model.Time(start),
+		Duration:  float64(endTime.Sub(start).Microseconds()) / 1e3,
+		Result:    status,
+		Outcome:   "success",
+		FAAS: &model.ExtendedFAAS{
+			ID:        inc.FunctionARN,
+			Name:      fnName,
+			Execution: inc.RequestID,
+			Coldstart: &coldstart,
+		},
+	}
+	if status != "success" {
+		txn.Outcome = "failure"
+	}
+
+	var w fastjson.Writer
+	if err := (&model.TransactionContainer{Transaction: txn}).MarshalFastJSON(&w); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
 }
 
 // NeedProxyTransaction returns true if a proxy transaction needs to be
@@ -73,9 +271,15 @@ func (inc *Invocation) MaybeCreateProxyTxn(status string, endTime time.Time) ([]
 	}
 	// Transaction duration cannot be known in partial transaction payload. Estimate
 	// the duration based on the time provided. Time can be based on the runtimeDone
-	// log record or function deadline.
-	duration := endTime.Sub(inc.Timestamp)
-	txn, err = sjson.SetBytes(txn, "transaction.duration", duration.Milliseconds())
+	// log record, the platform.report duration or function deadline. The timestamp
+	// is the start of the invocation the duration is measured from, rather than
+	// the time the agent registered the transaction.
+	start := inc.start()
+	txn, err = sjson.SetBytes(txn, "transaction.timestamp", start.UnixMicro())
+	if err != nil {
+		return nil, err
+	}
+	txn, err = sjson.SetBytes(txn, "transaction.duration", endTime.Sub(start).Milliseconds())
 	if err != nil {
 		return nil, err
 	}
@@ -87,3 +291,85 @@ func (inc *Invocation) MaybeCreateProxyTxn(status string, endTime time.Time) ([]
 	}
 	return txn, nil
 }
+
+// Timeout returns the configured timeout of the function. In AWS Lambda
+// the timeout is an integer number of seconds, it is derived from the
+// deadline and the start of the invocation.
+func (inc *Invocation) Timeout() time.Duration {
+	deadline := time.UnixMilli(inc.DeadlineMs)
+	return time.Duration(math.Ceil(deadline.Sub(inc.Timestamp).Seconds())) * time.Second
+}
+
+// CreateTimeoutError creates an error event for an invocation that timed
+// out, with the configured timeout and the elapsed time. The error is
+// linked to the transaction registered by the agent, which is also the
+// ID of the proxy transaction, or to the synthesized transaction.
+func (inc *Invocation) CreateTimeoutError(endTime time.Time) ([]byte, error) {
+	timeout := inc.Timeout()
+	elapsed := endTime.Sub(inc.start())
+	return inc.createError(
+		endTime,
+		TimeoutErrorType,
+		fmt.Sprintf("Task timed out after %.2f seconds", timeout.Seconds()),
+		model.Labels{
+			"faas_timeout_ms": timeout.Milliseconds(),
+			"faas_elapsed_ms": elapsed.Milliseconds(),
+		},
+	)
+}
+
+// CreateRuntimeError creates an error event for an invocation that failed
+// because the runtime crashed or ran out of memory, with the memory used
+// and the memory configured for the function. The error is linked to the
+// transaction of the invocation like timeout errors.
+func (inc *Invocation) CreateRuntimeError(failure RuntimeFailure) ([]byte, error) {
+	message := fmt.Sprintf("Runtime exited with status %s", failure.Status)
+	if failure.OutOfMemory() {
+		message = fmt.Sprintf(
+			"Runtime exited after running out of memory: %d MB used of %d MB",
+			failure.MaxMemoryUsedMB, failure.MemorySizeMB,
+		)
+	}
+	return inc.createError(
+		failure.Time,
+		failure.Type(),
+		message,
+		model.Labels{
+			"faas_status":         failure.Status,
+			"faas_memory_used_mb": failure.MaxMemoryUsedMB,
+			"faas_memory_size_mb": failure.MemorySizeMB,
+		},
+	)
+}
+
+// createError creates an unhandled error event for the invocation, with
+// the given labels in addition to the request ID and the function ARN.
+func (inc *Invocation) createError(ts time.Time, errorType, message string, labels model.Labels) ([]byte, error) {
+	traceID, transactionID := inc.TraceContext()
+	labels["faas_execution"] = inc.RequestID
+	labels["faas_id"] = inc.FunctionARN
+	handled := false
+	e := &model.Error{
+		ID:        model.NewID(16),
+		TraceID:   traceID,
+		Timestamp: model.Time(ts),
+		Culprit:   inc.FunctionARN,
+		Exception: &model.Exception{
+			Message: message,
+			Type:    errorType,
+			Handled: &handled,
+		},
+		Context: &model.Context{Labels: labels},
+	}
+	if transactionID != "" {
+		e.TransactionID = transactionID
+		e.ParentID = transactionID
+		e.Transaction = &model.ErrorTransaction{Sampled: true}
+	}
+
+	var w fastjson.Writer
+	if err := (&model.ErrorContainer{Error: e}).MarshalFastJSON(&w); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
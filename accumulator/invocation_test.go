@@ -24,9 +24,11 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 )
 
 func TestCreateProxyTransaction(t *testing.T) {
+	txnStart := time.Date(2022, time.October, 1, 1, 0, 0, 0, time.UTC)
 	txnDur := time.Second
 	for _, tc := range []struct {
 		name              string
@@ -53,7 +55,8 @@ func TestCreateProxyTransaction(t *testing.T) {
 			txnObserved:       false,
 			runtimeDoneStatus: "failure",
 			output: fmt.Sprintf(
-				`{"transaction":{"id":"test-txn-id","trace_id":"test-trace-id","result":"failure","outcome":"failure","duration":%d}}`,
+				`{"transaction":{"id":"test-txn-id","trace_id":"test-trace-id","result":"failure","outcome":"failure","timestamp":%d,"duration":%d}}`,
+				txnStart.UnixMicro(),
 				txnDur.Milliseconds(),
 			),
 		},
@@ -64,7 +67,8 @@ func TestCreateProxyTransaction(t *testing.T) {
 			txnObserved:       false,
 			runtimeDoneStatus: "timeout",
 			output: fmt.Sprintf(
-				`{"transaction":{"id":"test-txn-id","trace_id":"test-trace-id","result":"timeout","outcome":"failure","duration":%d}}`,
+				`{"transaction":{"id":"test-txn-id","trace_id":"test-trace-id","result":"timeout","outcome":"failure","timestamp":%d,"duration":%d}}`,
+				txnStart.UnixMicro(),
 				txnDur.Milliseconds(),
 			),
 		},
@@ -75,13 +79,14 @@ func TestCreateProxyTransaction(t *testing.T) {
 			txnObserved:       false,
 			runtimeDoneStatus: "success",
 			output: fmt.Sprintf(
-				`{"transaction":{"id":"test-txn-id","trace_id":"test-trace-id","result":"success","duration":%d}}`,
+				`{"transaction":{"id":"test-txn-id","trace_id":"test-trace-id","result":"success","timestamp":%d,"duration":%d}}`,
+				txnStart.UnixMicro(),
 				txnDur.Milliseconds(),
 			),
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			ts := time.Date(2022, time.October, 1, 1, 0, 0, 0, time.UTC)
+			ts := txnStart
 			inc := &Invocation{
 				Timestamp:           ts,
 				DeadlineMs:          ts.Add(time.Minute).UnixMilli(),
@@ -101,6 +106,110 @@ func TestCreateProxyTransaction(t *testing.T) {
 	}
 }
 
+func TestCreateProxyTransactionPlatformStart(t *testing.T) {
+	ts := time.Date(2022, time.October, 1, 1, 0, 0, 0, time.UTC)
+	platformStart := ts.Add(20 * time.Millisecond)
+	inc := &Invocation{
+		Timestamp:     ts,
+		PlatformStart: platformStart,
+		DeadlineMs:    ts.Add(time.Minute).UnixMilli(),
+		TransactionID: "test-txn-id",
+		AgentPayload:  []byte(fmt.Sprintf(`{"transaction":{"id":"test-txn-id","timestamp":%d}}`, ts.Add(50*time.Millisecond).UnixMicro())),
+	}
+	result, err := inc.MaybeCreateProxyTxn("success", platformStart.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, platformStart.UnixMicro(), gjson.GetBytes(result, "transaction.timestamp").Int())
+	assert.Equal(t, int64(1000), gjson.GetBytes(result, "transaction.duration").Int())
+}
+
+func TestCreateTimeoutError(t *testing.T) {
+	ts := time.Date(2022, time.October, 1, 1, 0, 0, 0, time.UTC)
+	inc := &Invocation{
+		RequestID:     "test-req-id",
+		Timestamp:     ts,
+		DeadlineMs:    ts.Add(3*time.Second - 5*time.Millisecond).UnixMilli(),
+		FunctionARN:   "test-fn-arn",
+		TransactionID: "test-txn-id",
+		TraceID:       "test-trace-id",
+	}
+	assert.Equal(t, 3*time.Second, inc.Timeout())
+
+	result, err := inc.CreateTimeoutError(ts.Add(3 * time.Second))
+	require.NoError(t, err)
+	e := gjson.GetBytes(result, "error")
+	assert.Equal(t, TimeoutErrorType, e.Get("exception.type").String())
+	assert.Equal(t, "Task timed out after 3.00 seconds", e.Get("exception.message").String())
+	assert.False(t, e.Get("exception.handled").Bool())
+	assert.Equal(t, "test-trace-id", e.Get("trace_id").String())
+	assert.Equal(t, "test-txn-id", e.Get("transaction_id").String())
+	assert.Equal(t, "test-txn-id", e.Get("parent_id").String())
+	assert.True(t, e.Get("transaction.sampled").Bool())
+	assert.Equal(t, int64(3000), e.Get("context.tags.faas_timeout_ms").Int())
+	assert.Equal(t, int64(3000), e.Get("context.tags.faas_elapsed_ms").Int())
+	assert.Equal(t, "test-req-id", e.Get("context.tags.faas_execution").String())
+
+	// Without a registered transaction the error is not linked.
+	inc.TransactionID, inc.TraceID = "", ""
+	result, err = inc.CreateTimeoutError(ts.Add(3 * time.Second))
+	require.NoError(t, err)
+	assert.False(t, gjson.GetBytes(result, "error.transaction_id").Exists())
+	assert.False(t, gjson.GetBytes(result, "error.transaction").Exists())
+}
+
+func TestCreateRuntimeError(t *testing.T) {
+	ts := time.Date(2022, time.October, 1, 1, 0, 0, 0, time.UTC)
+	inc := &Invocation{
+		RequestID:     "test-req-id",
+		Timestamp:     ts,
+		DeadlineMs:    ts.Add(time.Minute).UnixMilli(),
+		FunctionARN:   "test-fn-arn",
+		TransactionID: "test-txn-id",
+		TraceID:       "test-trace-id",
+	}
+
+	for _, tc := range []struct {
+		name            string
+		failure         RuntimeFailure
+		expectedType    string
+		expectedMessage string
+	}{
+		{
+			name:            "out_of_memory",
+			failure:         RuntimeFailure{Status: "error", ErrorType: "Runtime.ExitError", MaxMemoryUsedMB: 128, MemorySizeMB: 128},
+			expectedType:    OutOfMemoryErrorType,
+			expectedMessage: "Runtime exited after running out of memory: 128 MB used of 128 MB",
+		},
+		{
+			name:            "platform_error_type",
+			failure:         RuntimeFailure{Status: "failure", ErrorType: "Runtime.Unknown", MaxMemoryUsedMB: 64, MemorySizeMB: 128},
+			expectedType:    "Runtime.Unknown",
+			expectedMessage: "Runtime exited with status failure",
+		},
+		{
+			name:            "no_error_type",
+			failure:         RuntimeFailure{Status: "error", MaxMemoryUsedMB: 64, MemorySizeMB: 128},
+			expectedType:    ExitErrorType,
+			expectedMessage: "Runtime exited with status error",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.failure.Time = ts.Add(time.Second)
+			result, err := inc.CreateRuntimeError(tc.failure)
+			require.NoError(t, err)
+			e := gjson.GetBytes(result, "error")
+			assert.Equal(t, tc.expectedType, e.Get("exception.type").String())
+			assert.Equal(t, tc.expectedMessage, e.Get("exception.message").String())
+			assert.False(t, e.Get("exception.handled").Bool())
+			assert.Equal(t, tc.failure.Time.UnixMicro(), e.Get("timestamp").Int())
+			assert.Equal(t, "test-txn-id", e.Get("transaction_id").String())
+			assert.Equal(t, tc.failure.Status, e.Get("context.tags.faas_status").String())
+			assert.Equal(t, int64(tc.failure.MaxMemoryUsedMB), e.Get("context.tags.faas_memory_used_mb").Int())
+			assert.Equal(t, int64(tc.failure.MemorySizeMB), e.Get("context.tags.faas_memory_size_mb").Int())
+			assert.Equal(t, "test-req-id", e.Get("context.tags.faas_execution").String())
+		})
+	}
+}
+
 func BenchmarkMaybeCreateProxyTxn(b *testing.B) {
 	ts := time.Date(2022, time.October, 1, 1, 0, 0, 0, time.UTC)
 	txnDur := ts.Add(time.Second)
@@ -28,9 +28,12 @@ import (
 	"math"
 	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
 	"github.com/elastic/apm-aws-lambda/version"
 	"go.uber.org/zap"
 )
@@ -136,13 +139,21 @@ func (c *Client) PostToApmServer(ctx context.Context, apmData accumulator.APMDat
 		return errors.New("transport status is unhealthy")
 	}
 
+	c.recordOutput(apmData)
+
+	if c.output != nil {
+		return c.writeOutput(apmData)
+	}
+
 	endpointURI := "intake/v2/events"
 	encoding := apmData.ContentEncoding
 	agentInfo := apmData.AgentInfo
 
 	var r io.Reader
+	var size int
 	if apmData.ContentEncoding != "" {
 		r = bytes.NewReader(apmData.Data)
+		size = len(apmData.Data)
 	} else {
 		encoding = "gzip"
 		buf := c.bufferPool.Get().(*bytes.Buffer)
@@ -161,6 +172,7 @@ func (c *Client) PostToApmServer(ctx context.Context, apmData accumulator.APMDat
 			return fmt.Errorf("failed to write compressed data to buffer: %w", err)
 		}
 		r = buf
+		size = buf.Len()
 	}
 
 	req, err := http.NewRequest(http.MethodPost, c.serverURL+endpointURI, r)
@@ -177,8 +189,13 @@ func (c *Client) PostToApmServer(ctx context.Context, apmData accumulator.APMDat
 	}
 
 	c.logger.Debug("Sending data chunk to APM server")
+	c.monitor.Inc(selfmonitor.APMServerRequests)
+	c.monitor.Add(selfmonitor.APMServerBytesSent, float64(size))
+	start := time.Now()
 	resp, err := c.client.Do(req)
+	c.monitor.ObserveDuration(selfmonitor.APMServerLatency, time.Since(start))
 	if err != nil {
+		c.monitor.Inc(selfmonitor.APMServerRequestFailures)
 		c.UpdateStatus(ctx, Failing)
 		return fmt.Errorf("failed to post to APM server: %v", err)
 	}
@@ -189,6 +206,7 @@ func (c *Client) PostToApmServer(ctx context.Context, apmData accumulator.APMDat
 		c.UpdateStatus(ctx, Healthy)
 		return nil
 	}
+	c.monitor.Inc(selfmonitor.APMServerRequestFailures)
 
 	// RateLimited
 	if resp.StatusCode == http.StatusTooManyRequests {
@@ -222,6 +240,41 @@ func (c *Client) PostToApmServer(ctx context.Context, apmData accumulator.APMDat
 	return nil
 }
 
+// writeOutput writes the APM data as decompressed ndjson to the output
+// configured in dry-run mode.
+func (c *Client) writeOutput(apmData accumulator.APMData) error {
+	data, err := accumulator.GetUncompressedBytes(apmData.Data, apmData.ContentEncoding)
+	if err != nil {
+		return fmt.Errorf("failed to decompress data: %w", err)
+	}
+	c.outputMu.Lock()
+	defer c.outputMu.Unlock()
+	if _, err := c.output.Write(data); err != nil {
+		return fmt.Errorf("failed to write data to output: %w", err)
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		if _, err := c.output.Write([]byte("\n")); err != nil {
+			return fmt.Errorf("failed to write data to output: %w", err)
+		}
+	}
+	return nil
+}
+
+// recordOutput records the data sent to the APM Server, if recording is
+// enabled.
+func (c *Client) recordOutput(apmData accumulator.APMData) {
+	if c.recorder == nil {
+		return
+	}
+	data, err := accumulator.GetUncompressedBytes(apmData.Data, apmData.ContentEncoding)
+	if err == nil {
+		err = c.recorder.Record(recorder.APMServer, data)
+	}
+	if err != nil {
+		c.logger.Warnf("Failed to record APM Server data: %v", err)
+	}
+}
+
 func logBodyErrors(logger *zap.SugaredLogger, resp *http.Response) {
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -278,6 +331,7 @@ func (c *Client) UpdateStatus(ctx context.Context, status Status) {
 		}
 		c.Status = status
 		c.logger.Debugf("APM server Transport status set to %s", c.Status)
+		c.monitor.Inc(statusMetric(status))
 		c.ReconnectionCount = -1
 		c.mu.Unlock()
 	case RateLimited, ClientFailing:
@@ -286,14 +340,17 @@ func (c *Client) UpdateStatus(ctx context.Context, status Status) {
 		c.mu.Lock()
 		c.Status = status
 		c.logger.Debugf("APM server Transport status set to %s", c.Status)
+		c.monitor.Inc(statusMetric(status))
 		c.mu.Unlock()
 	case Failing:
 		c.mu.Lock()
 		c.Status = status
 		c.logger.Debugf("APM server Transport status set to %s", c.Status)
+		c.monitor.Inc(statusMetric(status))
 		c.ReconnectionCount++
 		gracePeriodTimer := time.NewTimer(c.ComputeGracePeriod())
 		c.logger.Debugf("Grace period entered, reconnection count : %d", c.ReconnectionCount)
+		c.monitor.Inc(selfmonitor.APMServerGracePeriods)
 		c.mu.Unlock()
 
 		go func() {
@@ -306,6 +363,7 @@ func (c *Client) UpdateStatus(ctx context.Context, status Status) {
 			c.mu.Lock()
 			c.Status = Started
 			c.logger.Debugf("APM server Transport status set to %s", c.Status)
+			c.monitor.Inc(statusMetric(Started))
 			c.mu.Unlock()
 		}()
 	default:
@@ -313,6 +371,12 @@ func (c *Client) UpdateStatus(ctx context.Context, status Status) {
 	}
 }
 
+// statusMetric returns the name of the self-monitoring counter of the
+// transitions to the status.
+func statusMetric(status Status) string {
+	return selfmonitor.APMServerStatusPrefix + strings.ToLower(string(status))
+}
+
 // ComputeGracePeriod https://github.com/elastic/apm/blob/main/specs/agents/transport.md#transport-errors
 func (c *Client) ComputeGracePeriod() time.Duration {
 	// If reconnectionCount is 0, returns a random number in an interval.
@@ -352,6 +416,7 @@ func (c *Client) WaitForFlush() <-chan struct{} {
 func (c *Client) ForwardAgentData(ctx context.Context, apmData accumulator.APMData) error {
 	if err := c.batch.AddAgentData(apmData); err != nil {
 		c.logger.Warnf("Dropping agent data due to error: %v", err)
+		c.recordBatchError(err)
 	}
 	if c.batch.ShouldShip() {
 		return c.sendBatch(ctx)
@@ -362,6 +427,7 @@ func (c *Client) ForwardAgentData(ctx context.Context, apmData accumulator.APMDa
 func (c *Client) ForwardLambdaData(ctx context.Context, data []byte) error {
 	if err := c.batch.AddLambdaData(data); err != nil {
 		c.logger.Warnf("Dropping lambda data due to error: %v", err)
+		c.recordBatchError(err)
 	}
 	if c.batch.ShouldShip() {
 		return c.sendBatch(ctx)
@@ -376,3 +442,14 @@ func (c *Client) sendBatch(ctx context.Context) error {
 	defer c.batch.Reset()
 	return c.PostToApmServer(ctx, c.batch.ToAPMData())
 }
+
+// recordBatchError counts the data dropped because the batch is full or
+// has no metadata.
+func (c *Client) recordBatchError(err error) {
+	switch {
+	case errors.Is(err, accumulator.ErrBatchFull):
+		c.monitor.Inc(selfmonitor.BatchFull)
+	case errors.Is(err, accumulator.ErrMetadataUnavailable):
+		c.monitor.Inc(selfmonitor.BatchMetadataUnavailable)
+	}
+}
@@ -33,9 +33,12 @@ import (
 
 	"github.com/elastic/apm-aws-lambda/accumulator"
 	"github.com/elastic/apm-aws-lambda/apmproxy"
+	"github.com/elastic/apm-aws-lambda/apmservertest"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest"
 )
@@ -132,6 +135,60 @@ func TestPostToApmServerDataNotCompressed(t *testing.T) {
 	require.NoError(t, apmClient.PostToApmServer(t.Context(), agentData))
 }
 
+func TestPostToApmServerSelfMonitoring(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusAccepted)
+	apmServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer apmServer.Close()
+
+	monitor := selfmonitor.New(0)
+	apmClient, err := apmproxy.NewClient(
+		apmproxy.WithURL(apmServer.URL),
+		apmproxy.WithLogger(zaptest.NewLogger(t).Sugar()),
+		apmproxy.WithSelfMonitor(monitor),
+	)
+	require.NoError(t, err)
+	data := []byte("compressed data")
+	require.NoError(t, apmClient.PostToApmServer(t.Context(), accumulator.APMData{Data: data, ContentEncoding: "gzip"}))
+	status.Store(http.StatusTooManyRequests)
+	require.NoError(t, apmClient.PostToApmServer(t.Context(), accumulator.APMData{Data: data, ContentEncoding: "gzip"}))
+
+	metricsets, err := monitor.Flush(time.Now())
+	require.NoError(t, err)
+	require.Len(t, metricsets, 1)
+	samples := gjson.GetBytes(metricsets[0], "metricset.samples")
+	assert.Equal(t, 2.0, samples.Get(`extension\.apm_server\.requests.value`).Float())
+	assert.Equal(t, 1.0, samples.Get(`extension\.apm_server\.request_failures.value`).Float())
+	assert.Equal(t, float64(2*len(data)), samples.Get(`extension\.apm_server\.bytes_sent.value`).Float())
+	assert.Equal(t, "histogram", samples.Get(`extension\.apm_server\.latency.type`).String())
+	assert.Equal(t, 1.0, samples.Get(`extension\.apm_server\.status\.healthy.value`).Float())
+	assert.Equal(t, 1.0, samples.Get(`extension\.apm_server\.status\.ratelimited.value`).Float())
+}
+
+func TestPostToApmServerOutput(t *testing.T) {
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err := gw.Write([]byte(`{"metadata":{}}` + "\n" + `{"transaction":{}}`))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	_, err = apmproxy.NewClient(apmproxy.WithLogger(zaptest.NewLogger(t).Sugar()))
+	require.Error(t, err)
+
+	// The APM Server URL is optional in dry-run mode.
+	var output bytes.Buffer
+	apmClient, err := apmproxy.NewClient(
+		apmproxy.WithLogger(zaptest.NewLogger(t).Sugar()),
+		apmproxy.WithOutput(&output),
+	)
+	require.NoError(t, err)
+	require.NoError(t, apmClient.PostToApmServer(t.Context(), accumulator.APMData{Data: compressed.Bytes(), ContentEncoding: "gzip"}))
+	require.NoError(t, apmClient.PostToApmServer(t.Context(), accumulator.APMData{Data: []byte(`{"metadata":{}}` + "\n" + `{"span":{}}` + "\n")}))
+	assert.Equal(t, `{"metadata":{}}`+"\n"+`{"transaction":{}}`+"\n"+`{"metadata":{}}`+"\n"+`{"span":{}}`+"\n", output.String())
+}
+
 func TestGracePeriod(t *testing.T) {
 	apmClient, err := apmproxy.NewClient(
 		apmproxy.WithURL("https://example.com"),
@@ -542,6 +599,71 @@ func TestAPMServerClientFail(t *testing.T) {
 	assert.Equal(t, apmproxy.Healthy, apmClient.Status)
 }
 
+func TestAPMServerFaults(t *testing.T) {
+	agentData := accumulator.APMData{Data: []byte(
+		`{"metadata":{"service":{"name":"svc","agent":{"name":"nodejs","version":"4.0.0"}}}}` + "\n" +
+			`{"transaction":{"id":"c5ea9ba7dbfcd6ee","trace_id":"0af7651916cd43dd8448eb211c80319c","type":"request","duration":1,"faas":{"execution":"req-1"},"span_count":{"started":0}}}`,
+	)}
+
+	for name, tc := range map[string]struct {
+		response     apmservertest.Response
+		expectErr    bool
+		expectStatus apmproxy.Status
+		accepted     int
+	}{
+		"accepted": {
+			response:     apmservertest.Response{},
+			expectStatus: apmproxy.Healthy,
+			accepted:     1,
+		},
+		"rate limited": {
+			response:     apmservertest.Response{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second},
+			expectStatus: apmproxy.RateLimited,
+		},
+		"document errors": {
+			response:     apmservertest.Response{Errors: []apmservertest.DocumentError{{Message: "invalid transaction"}}},
+			expectStatus: apmproxy.ClientFailing,
+		},
+		"unavailable": {
+			response:     apmservertest.Response{StatusCode: http.StatusServiceUnavailable},
+			expectStatus: apmproxy.Failing,
+		},
+		"connection reset": {
+			response:     apmservertest.Response{Reset: true},
+			expectErr:    true,
+			expectStatus: apmproxy.Failing,
+		},
+		"hangs": {
+			response:     apmservertest.Response{Latency: time.Minute},
+			expectErr:    true,
+			expectStatus: apmproxy.Failing,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			apmServer := apmservertest.NewServer()
+			defer apmServer.Close()
+			apmServer.Respond(tc.response)
+
+			apmClient, err := apmproxy.NewClient(
+				apmproxy.WithURL(apmServer.URL),
+				apmproxy.WithLogger(zaptest.NewLogger(t).Sugar()),
+				apmproxy.WithDataForwarderTimeout(500*time.Millisecond),
+			)
+			require.NoError(t, err)
+
+			err = apmClient.PostToApmServer(t.Context(), agentData)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectStatus, apmClient.Status)
+			apmServer.AssertRequests(t, 1)
+			apmServer.AssertTransactions(t, "req-1", tc.accepted)
+		})
+	}
+}
+
 func TestContinuedAPMServerFailure(t *testing.T) {
 	// Compress the data
 	pr, pw := io.Pipe()
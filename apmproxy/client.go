@@ -20,12 +20,15 @@ package apmproxy
 import (
 	"bytes"
 	"errors"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
 	"go.uber.org/zap"
 )
 
@@ -68,7 +71,14 @@ type Client struct {
 	flushMutex sync.Mutex
 	flushCh    chan struct{}
 
-	batch *accumulator.Batch
+	batch    *accumulator.Batch
+	monitor  *selfmonitor.Monitor
+	recorder *recorder.Recorder
+
+	// output replaces the APM Server in dry-run mode, the batches are
+	// written to it as ndjson.
+	outputMu sync.Mutex
+	output   io.Writer
 }
 
 func NewClient(opts ...Option) (*Client, error) {
@@ -99,7 +109,7 @@ func NewClient(opts ...Option) (*Client, error) {
 		opt(&c)
 	}
 
-	if c.serverURL == "" {
+	if c.serverURL == "" && c.output == nil {
 		return nil, errors.New("APM Server URL cannot be empty")
 	}
 
@@ -108,7 +118,7 @@ func NewClient(opts ...Option) (*Client, error) {
 	}
 
 	// normalize server URL
-	if !strings.HasSuffix(c.serverURL, "/") {
+	if c.serverURL != "" && !strings.HasSuffix(c.serverURL, "/") {
 		c.serverURL += "/"
 	}
 
@@ -20,10 +20,13 @@ package apmproxy
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
 	"go.uber.org/zap"
 )
 
@@ -98,6 +101,31 @@ func WithBatch(batch *accumulator.Batch) Option {
 	}
 }
 
+// WithSelfMonitor configures the monitor recording the self-monitoring
+// metrics of the client.
+func WithSelfMonitor(monitor *selfmonitor.Monitor) Option {
+	return func(c *Client) {
+		c.monitor = monitor
+	}
+}
+
+// WithRecorder configures the recorder of the agent requests and of the
+// data sent to the APM Server.
+func WithRecorder(rec *recorder.Recorder) Option {
+	return func(c *Client) {
+		c.recorder = rec
+	}
+}
+
+// WithOutput enables the dry-run mode: the batches are written to w as
+// decompressed ndjson instead of being sent to the APM Server, which makes
+// the APM Server URL optional.
+func WithOutput(w io.Writer) Option {
+	return func(c *Client) {
+		c.output = w
+	}
+}
+
 func WithRootCerts(certs string) Option {
 	return func(c *Client) {
 		EnsureTlSConfig(c)
@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmproxy
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/otlp"
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
+)
+
+// otlpTranslateFunc decodes an OTLP request and translates it to intake v2
+// payloads. It also reports if the request marks the end of the invocation.
+type otlpTranslateFunc func(body []byte, contentType string) ([][]byte, bool, error)
+
+// URL: http://server/v1/traces
+func (c *Client) handleOTLPTraces() func(w http.ResponseWriter, r *http.Request) {
+	return c.handleOTLP("traces", func(body []byte, contentType string) ([][]byte, bool, error) {
+		td, err := otlp.DecodeTraces(body, contentType)
+		if err != nil {
+			return nil, false, err
+		}
+		payloads, err := otlp.TracesToIntake(td)
+		if err != nil {
+			return nil, false, err
+		}
+		var reqID string
+		if c.batch != nil {
+			reqID = c.batch.CurrentRequestID()
+		}
+		return payloads, otlp.RootSpanEnded(td, reqID), nil
+	})
+}
+
+// URL: http://server/v1/metrics
+func (c *Client) handleOTLPMetrics() func(w http.ResponseWriter, r *http.Request) {
+	return c.handleOTLP("metrics", func(body []byte, contentType string) ([][]byte, bool, error) {
+		md, err := otlp.DecodeMetrics(body, contentType)
+		if err != nil {
+			return nil, false, err
+		}
+		payloads, err := otlp.MetricsToIntake(md)
+		return payloads, false, err
+	})
+}
+
+// URL: http://server/v1/logs
+func (c *Client) handleOTLPLogs() func(w http.ResponseWriter, r *http.Request) {
+	return c.handleOTLP("logs", func(body []byte, contentType string) ([][]byte, bool, error) {
+		ld, err := otlp.DecodeLogs(body, contentType)
+		if err != nil {
+			return nil, false, err
+		}
+		payloads, err := otlp.LogsToIntake(ld)
+		return payloads, false, err
+	})
+}
+
+func (c *Client) handleOTLP(signal string, translate otlpTranslateFunc) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.logger.Debugf("Handling OTLP %s intake", signal)
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		contentType, err := otlp.MediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			c.logger.Warnf("Rejecting OTLP %s request: %v", signal, err)
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		rawBytes, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			c.logger.Errorf("Could not read OTLP %s request body: %v", signal, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := c.recorder.RecordRequest(recorder.OTLP, r, rawBytes); err != nil {
+			c.logger.Warnf("Failed to record OTLP %s request: %v", signal, err)
+		}
+		body, err := accumulator.GetUncompressedBytes(rawBytes, r.Header.Get("Content-Encoding"))
+		if err != nil {
+			c.logger.Warnf("Could not decompress OTLP %s request body: %v", signal, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		payloads, ended, err := translate(body, contentType)
+		if err != nil {
+			c.logger.Warnf("Failed to translate OTLP %s request: %v", signal, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		for _, payload := range payloads {
+			select {
+			case c.AgentDataChannel <- accumulator.APMData{Data: payload, AgentInfo: r.UserAgent()}:
+			default:
+				c.logger.Warnf("Channel full: dropping a subset of OTLP %s data", signal)
+				c.monitor.Inc(selfmonitor.OTLPDataChannelDropped)
+			}
+		}
+
+		if ended {
+			c.signalFlush()
+		}
+
+		// An empty Export*ServiceResponse signals full success.
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		if contentType == otlp.ContentTypeJSON {
+			if _, err = w.Write([]byte("{}")); err != nil {
+				c.logger.Errorf("Failed to send OTLP %s response: %v", signal, err)
+			}
+		}
+	}
+}
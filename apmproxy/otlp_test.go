@@ -0,0 +1,140 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmproxy_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/apmproxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap/zaptest"
+)
+
+func otlpTraces(invocationID string) string {
+	return `{"resourceSpans":[{"scopeSpans":[{"spans":[{
+		"traceId":"5b8efff798038103d269b633813fc60c",
+		"spanId":"eee19b7ec3c1b174",
+		"name":"my-function",
+		"startTimeUnixNano":"1544712660000000000",
+		"endTimeUnixNano":"1544712661000000000",
+		"attributes":[{"key":"faas.invocation_id","value":{"stringValue":"` + invocationID + `"}}]
+	}]}]}]}`
+}
+
+func TestHandleOTLPTraces(t *testing.T) {
+	apmServer := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	defer apmServer.Close()
+
+	batch := accumulator.NewBatch(100, time.Minute)
+	batch.RegisterInvocation("req-1", "arn", 500, time.Now())
+
+	apmClient, err := apmproxy.NewClient(
+		apmproxy.WithURL(apmServer.URL),
+		apmproxy.WithReceiverAddress("127.0.0.1:1236"),
+		apmproxy.WithReceiverTimeout(15*time.Second),
+		apmproxy.WithLogger(zaptest.NewLogger(t).Sugar()),
+		apmproxy.WithBatch(batch),
+	)
+	require.NoError(t, err)
+	require.NoError(t, apmClient.StartReceiver())
+	defer func() {
+		require.NoError(t, apmClient.Shutdown())
+	}()
+
+	url := "http://127.0.0.1:1236/v1/traces"
+
+	// A root span of another invocation must not signal a flush.
+	resp, err := http.Post(url, "application/json", strings.NewReader(otlpTraces("req-0")))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "{}", string(body))
+
+	select {
+	case data := <-apmClient.AgentDataChannel:
+		metadata, txn, _ := bytes.Cut(data.Data, []byte("\n"))
+		assert.True(t, gjson.GetBytes(metadata, "metadata.service").Exists())
+		assert.Equal(t, "eee19b7ec3c1b174", gjson.GetBytes(txn, "transaction.id").String())
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for OTLP data")
+	}
+	select {
+	case <-apmClient.WaitForFlush():
+		t.Fatal("Unexpected flush signal")
+	default:
+	}
+
+	resp, err = http.Post(url, "application/json", strings.NewReader(otlpTraces("req-1")))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	select {
+	case <-apmClient.WaitForFlush():
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for server to send flush signal")
+	}
+}
+
+func TestHandleOTLPErrors(t *testing.T) {
+	apmServer := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	defer apmServer.Close()
+
+	apmClient, err := apmproxy.NewClient(
+		apmproxy.WithURL(apmServer.URL),
+		apmproxy.WithReceiverAddress("127.0.0.1:1236"),
+		apmproxy.WithReceiverTimeout(15*time.Second),
+		apmproxy.WithLogger(zaptest.NewLogger(t).Sugar()),
+	)
+	require.NoError(t, err)
+	require.NoError(t, apmClient.StartReceiver())
+	defer func() {
+		require.NoError(t, apmClient.Shutdown())
+	}()
+
+	for name, tc := range map[string]struct {
+		path        string
+		contentType string
+		body        string
+		expected    int
+	}{
+		"unsupported-content-type": {path: "/v1/metrics", contentType: "text/plain", body: "{}", expected: http.StatusUnsupportedMediaType},
+		"invalid-json":             {path: "/v1/logs", contentType: "application/json", body: "{", expected: http.StatusBadRequest},
+		"invalid-protobuf":         {path: "/v1/traces", contentType: "application/x-protobuf", body: "\xff", expected: http.StatusBadRequest},
+		"empty-protobuf":           {path: "/v1/logs", contentType: "application/x-protobuf", body: "", expected: http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Post("http://127.0.0.1:1236"+tc.path, tc.contentType, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tc.expected, resp.StatusCode)
+		})
+	}
+	assert.Empty(t, apmClient.AgentDataChannel)
+}
@@ -29,11 +29,18 @@ import (
 	"time"
 
 	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
 	"github.com/elastic/apm-aws-lambda/version"
 )
 
 const txnRegistrationContentType = "application/vnd.elastic.apm.transaction+ndjson"
 
+// dryRunServerInfo is the server information returned to the agents in
+// dry-run mode. A recent version is reported so that agents do not disable
+// features based on the server version.
+const dryRunServerInfo = `{"publish_ready":true,"version":"8.0.0"}`
+
 // StartReceiver starts the server listening for APM agent data.
 func (c *Client) StartReceiver() error {
 	mux := http.NewServeMux()
@@ -46,6 +53,9 @@ func (c *Client) StartReceiver() error {
 	mux.HandleFunc("/", handleInfoRequest)
 	mux.HandleFunc("/intake/v2/events", c.handleIntakeV2Events())
 	mux.HandleFunc("/register/transaction", c.handleTransactionRegistration())
+	mux.HandleFunc("/v1/traces", c.handleOTLPTraces())
+	mux.HandleFunc("/v1/metrics", c.handleOTLPMetrics())
+	mux.HandleFunc("/v1/logs", c.handleOTLPLogs())
 
 	c.receiver.Handler = mux
 
@@ -75,6 +85,23 @@ func (c *Client) Shutdown() error {
 
 // URL: http://server/
 func (c *Client) handleInfoRequest() (func(w http.ResponseWriter, r *http.Request), error) {
+	if c.serverURL == "" {
+		// Without APM Server in dry-run mode, agents get a static server
+		// information document. Other requests, such as central config
+		// requests, are not supported.
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			c.logger.Debug("Handling APM server Info Request in dry-run mode")
+			w.Header().Set("Content-Type", "application/json")
+			if _, err := w.Write([]byte(dryRunServerInfo)); err != nil {
+				c.logger.Errorf("Failed to send server information to APM agent : %v", err)
+			}
+		}, nil
+	}
+
 	// Init reverse proxy
 	parsedApmServerURL, err := url.Parse(c.serverURL)
 	if err != nil {
@@ -133,6 +160,9 @@ func (c *Client) handleIntakeV2Events() func(w http.ResponseWriter, r *http.Requ
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		if err := c.recorder.RecordRequest(recorder.Intake, r, rawBytes); err != nil {
+			c.logger.Warnf("Failed to record agent intake request: %v", err)
+		}
 
 		agentFlushed := r.URL.Query().Get("flushed") == "true"
 
@@ -147,28 +177,14 @@ func (c *Client) handleIntakeV2Events() func(w http.ResponseWriter, r *http.Requ
 			case c.AgentDataChannel <- agentData:
 			default:
 				c.logger.Warnf("Channel full: dropping a subset of agent data")
+				c.monitor.Inc(selfmonitor.AgentDataChannelDropped)
 			}
 		} else {
 			c.logger.Debugf("Received empy request from '%s'", r.UserAgent())
 		}
 
 		if agentFlushed {
-			c.flushMutex.Lock()
-
-			select {
-			case <-c.flushCh:
-				// the channel is closed.
-				// the extension received at least a flush request already but the
-				// data have not been flushed yet.
-				// We can reuse the closed channel.
-			default:
-				// no pending flush requests
-				// close the channel to signal a flush request has
-				// been received.
-				close(c.flushCh)
-			}
-
-			c.flushMutex.Unlock()
+			c.signalFlush()
 		}
 
 		w.WriteHeader(http.StatusAccepted)
@@ -178,6 +194,26 @@ func (c *Client) handleIntakeV2Events() func(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// signalFlush closes the flush channel to signal that the function has
+// completed and no more data is expected for the invocation.
+func (c *Client) signalFlush() {
+	c.flushMutex.Lock()
+	defer c.flushMutex.Unlock()
+
+	select {
+	case <-c.flushCh:
+		// the channel is closed.
+		// the extension received at least a flush request already but the
+		// data have not been flushed yet.
+		// We can reuse the closed channel.
+	default:
+		// no pending flush requests
+		// close the channel to signal a flush request has
+		// been received.
+		close(c.flushCh)
+	}
+}
+
 // URL: http://server/register/transaction
 func (c *Client) handleTransactionRegistration() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -197,6 +233,9 @@ func (c *Client) handleTransactionRegistration() func(w http.ResponseWriter, r *
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
+		if err := c.recorder.RecordRequest(recorder.Registration, r, rawBytes); err != nil {
+			c.logger.Warnf("Failed to record transaction registration: %v", err)
+		}
 
 		if err := c.batch.OnAgentInit(
 			reqID, r.Header.Get("Content-Encoding"), rawBytes,
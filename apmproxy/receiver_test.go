@@ -196,6 +196,37 @@ func TestInfoProxyUnreachable(t *testing.T) {
 	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
 }
 
+func TestInfoDryRun(t *testing.T) {
+	var output bytes.Buffer
+	apmClient, err := apmproxy.NewClient(
+		apmproxy.WithOutput(&output),
+		// Use ipv4 to avoid issues in CI
+		apmproxy.WithReceiverAddress("127.0.0.1:1234"),
+		apmproxy.WithReceiverTimeout(15*time.Second),
+		apmproxy.WithLogger(zaptest.NewLogger(t).Sugar()),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, apmClient.StartReceiver())
+	defer func() {
+		require.NoError(t, apmClient.Shutdown())
+	}()
+
+	resp, err := http.Get("http://127.0.0.1:1234/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `"version"`)
+
+	// Only the server information is available in dry-run mode.
+	resp, err = http.Get("http://127.0.0.1:1234/config/v1/agents?service.name=foo")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
 func Test_handleInfoRequest(t *testing.T) {
 	headers := map[string]string{"Authorization": "test-value"}
 	// Copied from https://github.com/elastic/apm-server/blob/master/testdata/intake-v2/transactions.ndjson.
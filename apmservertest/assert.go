@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmservertest
+
+import (
+	"testing"
+	"time"
+)
+
+// waitTick is the interval at which WaitFor checks its condition.
+const waitTick = 10 * time.Millisecond
+
+// AssertRequests checks that n intake requests were received.
+func (s *Server) AssertRequests(t testing.TB, n int) bool {
+	t.Helper()
+	if got := len(s.Requests()); got != n {
+		t.Errorf("expected %d intake requests, received %d", n, got)
+		return false
+	}
+	return true
+}
+
+// AssertTransactions checks that n transactions were accepted for the
+// request ID, or in total if the request ID is empty.
+func (s *Server) AssertTransactions(t testing.TB, requestID string, n int) bool {
+	t.Helper()
+	return assertCount(t, "transactions", requestID, n, len(s.Transactions(requestID)))
+}
+
+// AssertErrors checks that n errors were accepted for the request ID, or
+// in total if the request ID is empty.
+func (s *Server) AssertErrors(t testing.TB, requestID string, n int) bool {
+	t.Helper()
+	return assertCount(t, "errors", requestID, n, len(s.Errors(requestID)))
+}
+
+// AssertMetricsets checks that n metricsets were accepted for the request
+// ID, or in total if the request ID is empty.
+func (s *Server) AssertMetricsets(t testing.TB, requestID string, n int) bool {
+	t.Helper()
+	return assertCount(t, "metricsets", requestID, n, len(s.Metricsets(requestID)))
+}
+
+// AssertLogs checks that n log lines were accepted for the request ID, or
+// in total if the request ID is empty.
+func (s *Server) AssertLogs(t testing.TB, requestID string, n int) bool {
+	t.Helper()
+	return assertCount(t, "log lines", requestID, n, len(s.Logs(requestID)))
+}
+
+func assertCount(t testing.TB, what, requestID string, expected, got int) bool {
+	t.Helper()
+	if got == expected {
+		return true
+	}
+	if requestID == "" {
+		t.Errorf("expected %d %s, received %d", expected, what, got)
+	} else {
+		t.Errorf("expected %d %s for request ID %s, received %d", expected, what, requestID, got)
+	}
+	return false
+}
+
+// WaitFor waits until the condition on the server is true, and fails the
+// test if it is still false after the timeout.
+func (s *Server) WaitFor(t testing.TB, timeout time.Duration, condition func(*Server) bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		if condition(s) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("condition not met after %s", timeout)
+			return false
+		}
+		time.Sleep(waitTick)
+	}
+}
@@ -0,0 +1,259 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmservertest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+)
+
+// Request is an intake request received by the server.
+type Request struct {
+	Time   time.Time
+	Header http.Header
+	Query  url.Values
+	// Metadata is the metadata event of the request.
+	Metadata *model.Metadata
+	// Events are the events following the metadata.
+	Events []Event
+	// Response is the response the request was answered with.
+	Response Response
+	// Err is the error decoding the request, which is answered with
+	// 400 Bad Request.
+	Err error
+
+	// delivered is true once the response has been sent.
+	delivered bool
+}
+
+// Event is a decoded intake v2 event. One of its fields is set, depending
+// on the type of the event.
+type Event struct {
+	Transaction *model.Transaction
+	Span        *model.Span
+	Error       *model.Error
+	Metricset   *model.Metrics
+	Log         *model.LogLine
+	// Raw is the event as received.
+	Raw json.RawMessage
+}
+
+// Type returns the type of the event, as in the intake v2 protocol.
+func (e Event) Type() string {
+	switch {
+	case e.Transaction != nil:
+		return "transaction"
+	case e.Span != nil:
+		return "span"
+	case e.Error != nil:
+		return "error"
+	case e.Metricset != nil:
+		return "metricset"
+	case e.Log != nil:
+		return "log"
+	default:
+		return ""
+	}
+}
+
+// intakeEvent holds the decoded line of an intake request.
+type intakeEvent struct {
+	Metadata    *model.Metadata    `json:"metadata"`
+	Transaction *model.Transaction `json:"transaction"`
+	Span        *model.Span        `json:"span"`
+	Error       *model.Error       `json:"error"`
+	Metricset   *model.Metrics     `json:"metricset"`
+	Log         *model.LogLine     `json:"log"`
+}
+
+func decodeRequest(r *http.Request) *Request {
+	req := &Request{
+		Time:   time.Now(),
+		Header: r.Header.Clone(),
+		Query:  r.URL.Query(),
+	}
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		req.Err = fmt.Errorf("failed to read request body: %w", err)
+		return req
+	}
+	body, err := accumulator.GetUncompressedBytes(raw, r.Header.Get("Content-Encoding"))
+	if err != nil {
+		req.Err = fmt.Errorf("failed to decompress request body: %w", err)
+		return req
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, 10*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var decoded intakeEvent
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			req.Err = fmt.Errorf("failed to decode line %d: %w", line, err)
+			return req
+		}
+		if decoded.Metadata != nil {
+			if req.Metadata != nil || len(req.Events) > 0 {
+				req.Err = fmt.Errorf("unexpected metadata on line %d", line)
+				return req
+			}
+			req.Metadata = decoded.Metadata
+			continue
+		}
+		if req.Metadata == nil {
+			req.Err = errors.New("missing metadata on the first line")
+			return req
+		}
+		event := Event{
+			Transaction: decoded.Transaction,
+			Span:        decoded.Span,
+			Error:       decoded.Error,
+			Metricset:   decoded.Metricset,
+			Log:         decoded.Log,
+			Raw:         append(json.RawMessage(nil), data...),
+		}
+		if event.Type() == "" {
+			req.Err = fmt.Errorf("unknown event type on line %d", line)
+			return req
+		}
+		req.Events = append(req.Events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		req.Err = fmt.Errorf("failed to read request body: %w", err)
+	}
+	return req
+}
+
+// Requests returns the intake requests received.
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+// InfoRequests returns the number of server information requests.
+func (s *Server) InfoRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.infoRequests
+}
+
+// Events returns the events of the intake requests that were answered
+// with an accepted response, in the order they were received.
+func (s *Server) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []Event
+	for _, req := range s.requests {
+		if req.Err == nil && req.delivered && req.Response.accepted() {
+			events = append(events, req.Events...)
+		}
+	}
+	return events
+}
+
+// Transactions returns the accepted transactions of the request ID, or
+// all of them if the request ID is empty.
+func (s *Server) Transactions(requestID string) []*model.Transaction {
+	var txns []*model.Transaction
+	for _, event := range s.Events() {
+		if txn := event.Transaction; txn != nil {
+			if requestID == "" || (txn.FAAS != nil && txn.FAAS.Execution == requestID) {
+				txns = append(txns, txn)
+			}
+		}
+	}
+	return txns
+}
+
+// Spans returns the accepted spans.
+func (s *Server) Spans() []*model.Span {
+	var spans []*model.Span
+	for _, event := range s.Events() {
+		if event.Span != nil {
+			spans = append(spans, event.Span)
+		}
+	}
+	return spans
+}
+
+// Errors returns the accepted errors of the request ID, or all of them if
+// the request ID is empty. Errors belong to a request ID through their
+// faas_execution label or through their transaction.
+func (s *Server) Errors(requestID string) []*model.Error {
+	events := s.Events()
+	txnIDs := make(map[string]bool)
+	for _, event := range events {
+		if txn := event.Transaction; txn != nil && txn.FAAS != nil && txn.FAAS.Execution == requestID {
+			txnIDs[txn.ID] = true
+		}
+	}
+	var errs []*model.Error
+	for _, event := range events {
+		e := event.Error
+		if e == nil {
+			continue
+		}
+		if requestID == "" || txnIDs[e.TransactionID] ||
+			(e.Context != nil && e.Context.Labels["faas_execution"] == requestID) {
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+// Metricsets returns the accepted metricsets of the request ID, or all of
+// them if the request ID is empty.
+func (s *Server) Metricsets(requestID string) []*model.Metrics {
+	var metricsets []*model.Metrics
+	for _, event := range s.Events() {
+		if ms := event.Metricset; ms != nil {
+			if requestID == "" || (ms.FAAS != nil && ms.FAAS.Execution == requestID) {
+				metricsets = append(metricsets, ms)
+			}
+		}
+	}
+	return metricsets
+}
+
+// Logs returns the accepted log lines of the request ID, or all of them if
+// the request ID is empty.
+func (s *Server) Logs(requestID string) []*model.LogLine {
+	var logs []*model.LogLine
+	for _, event := range s.Events() {
+		if log := event.Log; log != nil {
+			if requestID == "" || (log.FAAS != nil && log.FAAS.Execution == requestID) {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs
+}
@@ -0,0 +1,278 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package apmservertest provides a mock APM Server for tests. It decodes
+// the intake v2 requests it receives into typed events, answers them with
+// scripted responses to inject faults, and offers assertion helpers on the
+// received events.
+package apmservertest
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IntakePath is the path of the intake v2 events endpoint.
+const IntakePath = "/intake/v2/events"
+
+// Response is a scripted response to an intake request.
+type Response struct {
+	// StatusCode is the status of the response, 202 Accepted if it is
+	// zero, or 400 Bad Request if Errors is not empty.
+	StatusCode int
+	// RetryAfter sets the Retry-After header, in seconds, if not zero.
+	RetryAfter time.Duration
+	// Latency delays the response. The response is not sent if the
+	// request is canceled in the meantime, which emulates a hanging
+	// server for a latency longer than the client timeout.
+	Latency time.Duration
+	// Errors are the per-document errors of the response body.
+	Errors []DocumentError
+	// Reset resets the connection instead of sending a response.
+	Reset bool
+}
+
+// DocumentError is an error of a document of an intake request, as
+// reported in the response body.
+type DocumentError struct {
+	Message  string `json:"message"`
+	Document string `json:"document,omitempty"`
+}
+
+func (r Response) statusCode() int {
+	switch {
+	case r.StatusCode != 0:
+		return r.StatusCode
+	case len(r.Errors) > 0:
+		return http.StatusBadRequest
+	default:
+		return http.StatusAccepted
+	}
+}
+
+// accepted returns true if the response accepts the events of the
+// request.
+func (r Response) accepted() bool {
+	return !r.Reset && r.statusCode() < http.StatusMultipleChoices
+}
+
+// Server is a mock APM Server. Intake requests are answered with the
+// queued responses, in order, then with the default response.
+type Server struct {
+	*httptest.Server
+
+	version       string
+	authorization string
+	closed        chan struct{}
+	closeOnce     sync.Once
+
+	mu              sync.Mutex
+	responses       []Response
+	defaultResponse Response
+	requests        []*Request
+	infoRequests    int
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithVersion sets the version of the server information document.
+func WithVersion(version string) Option {
+	return func(s *Server) {
+		s.version = version
+	}
+}
+
+// WithSecretToken requires the requests to authenticate with the secret
+// token. Other requests are answered with 401 Unauthorized.
+func WithSecretToken(token string) Option {
+	return func(s *Server) {
+		s.authorization = "Bearer " + token
+	}
+}
+
+// WithAPIKey requires the requests to authenticate with the API key.
+// Other requests are answered with 401 Unauthorized.
+func WithAPIKey(key string) Option {
+	return func(s *Server) {
+		s.authorization = "ApiKey " + key
+	}
+}
+
+// NewServer starts a Server. It must be closed with Close.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		version: "8.0.0",
+		closed:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(IntakePath, s.handleIntake)
+	mux.HandleFunc("/", s.handleInfo)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Close unblocks the delayed responses and shuts down the server.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	s.Server.Close()
+}
+
+// Respond queues responses to the next intake requests.
+func (s *Server) Respond(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append(s.responses, responses...)
+}
+
+// SetDefaultResponse sets the response to the intake requests once the
+// queued responses are exhausted.
+func (s *Server) SetDefaultResponse(response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultResponse = response
+}
+
+// Reset forgets the received requests and the queued responses.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = nil
+	s.requests = nil
+	s.infoRequests = 0
+}
+
+func (s *Server) nextResponse() Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.responses) == 0 {
+		return s.defaultResponse
+	}
+	response := s.responses[0]
+	s.responses = s.responses[1:]
+	return response
+}
+
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if s.authorization == "" || r.Header.Get("Authorization") == s.authorization {
+		return true
+	}
+	writeResponse(w, http.StatusUnauthorized, []DocumentError{{Message: "authentication failed"}})
+	return false
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+	s.mu.Lock()
+	s.infoRequests++
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"publish_ready": true,
+		"version":       s.version,
+	})
+}
+
+func (s *Server) handleIntake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+
+	req := decodeRequest(r)
+	var response Response
+	if req.Err != nil {
+		response = Response{Errors: []DocumentError{{Message: req.Err.Error()}}}
+	} else {
+		response = s.nextResponse()
+	}
+	req.Response = response
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	if response.Latency > 0 {
+		timer := time.NewTimer(response.Latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		}
+	}
+
+	if response.Reset {
+		resetConnection(w)
+		return
+	}
+	if response.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(response.RetryAfter.Seconds()))))
+	}
+	writeResponse(w, response.statusCode(), response.Errors)
+	s.mu.Lock()
+	req.delivered = true
+	s.mu.Unlock()
+}
+
+func writeResponse(w http.ResponseWriter, status int, errs []DocumentError) {
+	if len(errs) == 0 {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": errs})
+}
+
+// resetConnection closes the connection of the request without a
+// response, with a TCP reset where possible.
+func resetConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic("apmservertest: connection cannot be hijacked")
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
@@ -0,0 +1,238 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmservertest_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/apmservertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const metadata = `{"metadata":{"service":{"name":"svc","agent":{"name":"nodejs","version":"4.0.0"}}}}`
+
+func post(t *testing.T, s *apmservertest.Server, body string, gzipped bool) (*http.Response, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	if gzipped {
+		gw := gzip.NewWriter(&buf)
+		_, err := gw.Write([]byte(body))
+		require.NoError(t, err)
+		require.NoError(t, gw.Close())
+	} else {
+		buf.WriteString(body)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL+apmservertest.IntakePath, &buf)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	client := &http.Client{Timeout: 500 * time.Millisecond}
+	return client.Do(req)
+}
+
+func TestDecodeEvents(t *testing.T) {
+	s := apmservertest.NewServer()
+	defer s.Close()
+
+	body := strings.Join([]string{
+		metadata,
+		`{"transaction":{"id":"t1","trace_id":"tr1","type":"request","timestamp":1704067200000000,"duration":12.5,"faas":{"execution":"req-1","coldstart":true}}}`,
+		`{"span":{"id":"s1","transaction_id":"t1","trace_id":"tr1","parent_id":"t1","name":"query","type":"db"}}`,
+		`{"error":{"id":"e1","transaction_id":"t1","exception":{"type":"Runtime.ExitError"}}}`,
+		`{"error":{"id":"e2","context":{"tags":{"faas_execution":"req-2"}}}}`,
+		`{"metricset":{"faas":{"execution":"req-1"},"samples":{"faas.duration":{"value":12.5}}}}`,
+		`{"log":{"message":"hello","@timestamp":1704067200001000,"faas":{"execution":"req-1"}}}`,
+	}, "\n")
+	resp, err := post(t, s, body, true)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	requests := s.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "svc", requests[0].Metadata.Service.Name)
+	require.Len(t, requests[0].Events, 6)
+	assert.Equal(t, "transaction", requests[0].Events[0].Type())
+	assert.JSONEq(t, `{"span":{"id":"s1","transaction_id":"t1","trace_id":"tr1","parent_id":"t1","name":"query","type":"db"}}`, string(requests[0].Events[1].Raw))
+
+	txns := s.Transactions("req-1")
+	require.Len(t, txns, 1)
+	assert.Equal(t, 12.5, txns[0].Duration)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Time(txns[0].Timestamp))
+	require.NotNil(t, txns[0].FAAS.Coldstart)
+	assert.True(t, *txns[0].FAAS.Coldstart)
+
+	assert.Len(t, s.Spans(), 1)
+	s.AssertErrors(t, "req-1", 1)
+	s.AssertErrors(t, "req-2", 1)
+	s.AssertErrors(t, "", 2)
+	s.AssertMetricsets(t, "req-1", 1)
+	s.AssertLogs(t, "req-1", 1)
+	s.AssertTransactions(t, "req-2", 0)
+	assert.Equal(t, 12.5, s.Metricsets("req-1")[0].Samples["faas.duration"].Value)
+	assert.Equal(t, "hello", s.Logs("")[0].Message)
+}
+
+func TestInvalidRequests(t *testing.T) {
+	s := apmservertest.NewServer()
+	defer s.Close()
+
+	for _, body := range []string{
+		`{"transaction":{"id":"t1"}}`,
+		metadata + "\n" + `{"unknown":{}}`,
+		metadata + "\nnot json",
+	} {
+		resp, err := post(t, s, body, false)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Contains(t, string(b), `"errors"`)
+	}
+	s.AssertRequests(t, 3)
+	assert.Empty(t, s.Events())
+	for _, req := range s.Requests() {
+		assert.Error(t, req.Err)
+	}
+}
+
+func TestScriptedResponses(t *testing.T) {
+	s := apmservertest.NewServer()
+	defer s.Close()
+	s.Respond(
+		apmservertest.Response{StatusCode: http.StatusServiceUnavailable, RetryAfter: 1500 * time.Millisecond},
+		apmservertest.Response{Errors: []apmservertest.DocumentError{{Message: "invalid", Document: "{}"}}},
+		apmservertest.Response{Reset: true},
+		apmservertest.Response{Latency: time.Minute},
+		apmservertest.Response{Latency: 50 * time.Millisecond},
+	)
+	s.SetDefaultResponse(apmservertest.Response{StatusCode: http.StatusTooManyRequests})
+	body := metadata + "\n" + `{"transaction":{"id":"t1","faas":{"execution":"req-1"}}}`
+
+	resp, err := post(t, s, body, false)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+
+	resp, err = post(t, s, body, false)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.JSONEq(t, `{"errors":[{"message":"invalid","document":"{}"}]}`, string(b))
+
+	_, err = post(t, s, body, false)
+	assert.Error(t, err, "connection reset")
+
+	_, err = post(t, s, body, false)
+	assert.Error(t, err, "hanging response")
+
+	start := time.Now()
+	resp, err = post(t, s, body, false)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	resp, err = post(t, s, body, false)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	s.AssertRequests(t, 6)
+	s.AssertTransactions(t, "req-1", 1)
+}
+
+func TestAuthorization(t *testing.T) {
+	s := apmservertest.NewServer(apmservertest.WithSecretToken("secret"), apmservertest.WithVersion("8.15.0"))
+	defer s.Close()
+
+	resp, err := http.Get(s.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(b), `"version":"8.15.0"`)
+	assert.Equal(t, 1, s.InfoRequests())
+
+	resp, err = post(t, s, metadata, false)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	s.AssertRequests(t, 0)
+}
+
+// recordingTB records the failures of the assertions.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertions(t *testing.T) {
+	s := apmservertest.NewServer()
+	defer s.Close()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		resp, err := post(t, s, metadata+"\n"+`{"transaction":{"id":"t1","faas":{"execution":"req-1"}}}`, false)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	assert.True(t, s.WaitFor(t, 5*time.Second, func(s *apmservertest.Server) bool {
+		return len(s.Transactions("req-1")) == 1
+	}))
+
+	tb := &recordingTB{TB: t}
+	assert.False(t, s.AssertTransactions(tb, "req-1", 2))
+	assert.False(t, s.AssertLogs(tb, "", 1))
+	assert.False(t, s.WaitFor(tb, 20*time.Millisecond, func(*apmservertest.Server) bool { return false }))
+	assert.Equal(t, []string{
+		"expected 2 transactions for request ID req-1, received 1",
+		"expected 1 log lines, received 0",
+		"condition not met after 20ms",
+	}, tb.errors)
+}
@@ -20,7 +20,9 @@ package app
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -30,6 +32,10 @@ import (
 	"github.com/elastic/apm-aws-lambda/extension"
 	"github.com/elastic/apm-aws-lambda/logger"
 	"github.com/elastic/apm-aws-lambda/logsapi"
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
+	"github.com/elastic/apm-aws-lambda/statsd"
+	"github.com/elastic/apm-aws-lambda/xray"
 
 	"go.elastic.co/ecszap"
 	"go.uber.org/zap"
@@ -38,6 +44,9 @@ import (
 const (
 	defaultMaxBatchSize = 50
 	defaultMaxBatchAge  = 2 * time.Second
+	// defaultOutputFile is the file written by the file output of the
+	// dry-run mode. /tmp is the only writable directory in Lambda.
+	defaultOutputFile = "/tmp/elastic-apm-lambda-output.ndjson"
 )
 
 // App is the main application.
@@ -46,14 +55,25 @@ type App struct {
 	extensionClient *extension.Client
 	logsClient      *logsapi.Client
 	apmClient       *apmproxy.Client
+	xrayListener    *xray.Listener
+	statsdListener  *statsd.Listener
 	logger          *zap.SugaredLogger
 	batch           *accumulator.Batch
+	monitor         *selfmonitor.Monitor
+	// outputFile is the file written in dry-run mode, if any.
+	outputFile *os.File
+	// recorder records the inputs of the extension to recordFile, if
+	// recording is enabled.
+	recorder   *recorder.Recorder
+	recordFile *os.File
 }
 
 // New returns an App or an error if the creation failed.
 //
 //nolint:govet
 func New(ctx context.Context, opts ...ConfigOption) (*App, error) {
+	// The extension init phase starts with the extension process.
+	startTime := time.Now()
 	c := appConfig{}
 
 	for _, opt := range opts {
@@ -70,11 +90,80 @@ func New(ctx context.Context, opts ...ConfigOption) (*App, error) {
 	if app.logger, err = buildLogger(c.logLevel); err != nil {
 		return nil, err
 	}
+	if c.extensionName != "" {
+		// Naming the logger allows to recognize the log lines of this
+		// extension in the extension log stream.
+		app.logger = app.logger.Named(c.extensionName)
+	}
 
 	apmServerAPIKey, apmServerSecretToken := loadAWSOptions(ctx, c.awsConfig, app.logger)
 
+	xrayPropagation := accumulator.XRayLink
+	switch rawPropagation := os.Getenv("ELASTIC_APM_LAMBDA_XRAY_PROPAGATION"); rawPropagation {
+	case "", "link":
+	case "trace":
+		xrayPropagation = accumulator.XRayTraceID
+	default:
+		return nil, fmt.Errorf("unknown ELASTIC_APM_LAMBDA_XRAY_PROPAGATION %q, expected link or trace", rawPropagation)
+	}
+	xrayRootLabel, _, err := parseBoolEnv("ELASTIC_APM_LAMBDA_XRAY_ROOT_LABEL")
+	if err != nil {
+		return nil, err
+	}
+	app.batch.SetXRayPropagation(xrayPropagation, xrayRootLabel)
+
+	monitoringInterval, _, err := parseDurationEnv("ELASTIC_APM_LAMBDA_SELF_MONITORING_INTERVAL")
+	if err != nil {
+		return nil, err
+	}
+	if monitoringInterval > 0 {
+		app.monitor = selfmonitor.New(monitoringInterval)
+		app.batch.SetSelfMonitor(app.monitor)
+	}
+
+	if recordPath := os.Getenv("ELASTIC_APM_LAMBDA_RECORD_FILE"); recordPath != "" {
+		f, err := os.OpenFile(recordPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open record file: %w", err)
+		}
+		app.logger.Infof("Recording the extension inputs to %s", recordPath)
+		app.recordFile = f
+		app.recorder = recorder.New(f)
+		if err := app.recorder.RecordConfig(recorder.ExtensionConfig{
+			FunctionLogs:  c.enableFunctionLogSubscription,
+			ExtensionLogs: c.enableExtensionLogSubscription,
+			Env:           recorder.Environ(),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata, err := extensionMetadata()
+	if err != nil {
+		return nil, err
+	}
+	app.batch.SetDefaultMetadata(metadata)
+
+	synthesize, _, err := parseBoolEnv("ELASTIC_APM_LAMBDA_SYNTHESIZE_TRANSACTIONS")
+	if err != nil {
+		return nil, err
+	}
+	if synthesize {
+		app.batch.EnableSyntheticTransactions()
+	}
+
 	app.extensionClient = extension.NewClient(c.awsLambdaRuntimeAPI, app.logger)
 
+	if addr := os.Getenv("ELASTIC_APM_LAMBDA_STATSD_LISTENER_ADDRESS"); addr != "" {
+		if app.statsdListener, err = statsd.NewListener(
+			statsd.WithListenerAddress(addr),
+			statsd.WithRecorder(app.recorder),
+			statsd.WithLogger(app.logger),
+		); err != nil {
+			return nil, err
+		}
+	}
+
 	if !c.disableLogsAPI {
 		addr := "sandbox.localdomain:0"
 		if c.logsapiAddr != "" {
@@ -85,15 +174,79 @@ func New(ctx context.Context, opts ...ConfigOption) (*App, error) {
 		if c.enableFunctionLogSubscription {
 			subscriptionLogStreams = append(subscriptionLogStreams, logsapi.Function)
 		}
+		if c.enableExtensionLogSubscription {
+			subscriptionLogStreams = append(subscriptionLogStreams, logsapi.Extension)
+		}
 
-		app.logsClient, err = logsapi.NewClient(
-			logsapi.WithLogsAPIBaseURL("http://"+c.awsLambdaRuntimeAPI),
+		logsOpts := []logsapi.ClientOption{
+			logsapi.WithLogsAPIBaseURL("http://" + c.awsLambdaRuntimeAPI),
 			logsapi.WithListenerAddress(addr),
 			logsapi.WithLogBuffer(100),
 			logsapi.WithLogger(app.logger),
 			logsapi.WithSubscriptionTypes(subscriptionLogStreams...),
 			logsapi.WithInvocationLifecycler(app.batch),
-		)
+			logsapi.WithExtensionStartTime(startTime),
+			logsapi.WithExtensionName(c.extensionName),
+			logsapi.WithRecorder(app.recorder),
+		}
+		if app.statsdListener != nil {
+			logsOpts = append(logsOpts, logsapi.WithMetricsCollector(app.statsdListener))
+		}
+		if app.monitor != nil {
+			logsOpts = append(logsOpts,
+				logsapi.WithSelfMonitor(app.monitor),
+				logsapi.WithMetricsCollector(app.monitor),
+			)
+		}
+		forward, ok, err := parseBoolEnv("ELASTIC_APM_LAMBDA_EMF_LOG_FORWARDING")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			logsOpts = append(logsOpts, logsapi.WithEMFLogForwarding(forward))
+		}
+
+		telemetry, ok, err := parseBoolEnv("ELASTIC_APM_LAMBDA_TELEMETRY_API")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			logsOpts = append(logsOpts, logsapi.WithTelemetryAPI(telemetry))
+		}
+
+		interval, ok, err := parseDurationEnv("ELASTIC_APM_LAMBDA_METRICS_AGGREGATION_INTERVAL")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			logsOpts = append(logsOpts, logsapi.WithMetricsAggregation(interval))
+		}
+
+		invocationMetrics, ok, err := parseBoolEnv("ELASTIC_APM_LAMBDA_INVOCATION_METRICS")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			logsOpts = append(logsOpts, logsapi.WithInvocationMetrics(invocationMetrics))
+		}
+
+		if level := os.Getenv("ELASTIC_APM_LAMBDA_LOG_MIN_LEVEL"); level != "" {
+			logsOpts = append(logsOpts, logsapi.WithMinimumLogLevel(level))
+		}
+
+		multilineOpts, err := parseMultilineOptions()
+		if err != nil {
+			return nil, err
+		}
+		logsOpts = append(logsOpts, multilineOpts...)
+
+		logLimitOpts, err := parseLogLimitOptions()
+		if err != nil {
+			return nil, err
+		}
+		logsOpts = append(logsOpts, logLimitOpts...)
+
+		app.logsClient, err = logsapi.NewClient(logsOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -132,11 +285,11 @@ func New(ctx context.Context, opts ...ConfigOption) (*App, error) {
 		apmOpts = append(apmOpts, apmproxy.WithAgentDataBufferSize(size))
 	}
 
-	if verifyCertsString := os.Getenv("ELASTIC_APM_LAMBDA_VERIFY_SERVER_CERT"); verifyCertsString != "" {
-		verifyCerts, err := strconv.ParseBool(verifyCertsString)
-		if err != nil {
-			return nil, err
-		}
+	verifyCerts, ok, err := parseBoolEnv("ELASTIC_APM_LAMBDA_VERIFY_SERVER_CERT")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
 		if !verifyCerts {
 			app.logger.Infof("Ignoring Certificates.")
 		}
@@ -167,12 +320,25 @@ func New(ctx context.Context, opts ...ConfigOption) (*App, error) {
 		apmOpts = append(apmOpts, apmproxy.WithRootCerts(*cert))
 	}
 
+	if rawOutput := os.Getenv("ELASTIC_APM_LAMBDA_OUTPUT"); rawOutput != "" {
+		output, err := app.openOutput(rawOutput, os.Getenv("ELASTIC_APM_LAMBDA_OUTPUT_FILE"))
+		if err != nil {
+			return nil, err
+		}
+		if output != nil {
+			app.logger.Infof("Dry-run mode: writing APM data to %s instead of the APM Server", rawOutput)
+			apmOpts = append(apmOpts, apmproxy.WithOutput(output))
+		}
+	}
+
 	apmOpts = append(apmOpts,
 		apmproxy.WithURL(os.Getenv("ELASTIC_APM_LAMBDA_APM_SERVER")),
 		apmproxy.WithLogger(app.logger),
 		apmproxy.WithAPIKey(apmServerAPIKey),
 		apmproxy.WithSecretToken(apmServerSecretToken),
 		apmproxy.WithBatch(app.batch),
+		apmproxy.WithSelfMonitor(app.monitor),
+		apmproxy.WithRecorder(app.recorder),
 	)
 
 	ac, err := apmproxy.NewClient(apmOpts...)
@@ -183,17 +349,34 @@ func New(ctx context.Context, opts ...ConfigOption) (*App, error) {
 
 	app.apmClient = ac
 
+	if addr := os.Getenv("ELASTIC_APM_LAMBDA_XRAY_LISTENER_ADDRESS"); addr != "" {
+		xrayOpts := []xray.Option{
+			xray.WithListenerAddress(addr),
+			xray.WithLambdaDataChannel(ac.LambdaDataChannel),
+			xray.WithRecorder(app.recorder),
+			xray.WithLogger(app.logger),
+		}
+		relay, ok, err := parseBoolEnv("ELASTIC_APM_LAMBDA_XRAY_RELAY")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			relay = true
+		}
+		if daemonAddr := xray.DaemonAddress(os.Getenv("AWS_XRAY_DAEMON_ADDRESS")); relay && daemonAddr != "" && daemonAddr != addr {
+			xrayOpts = append(xrayOpts, xray.WithRelayAddress(daemonAddr))
+		}
+		if app.xrayListener, err = xray.NewListener(xrayOpts...); err != nil {
+			return nil, err
+		}
+	}
+
 	return app, nil
 }
 
 func parseDurationTimeout(l *zap.SugaredLogger, flag, deprecatedFlag string) (time.Duration, bool, error) {
-	if strValue, ok := os.LookupEnv(flag); ok {
-		d, err := time.ParseDuration(strValue)
-		if err != nil {
-			return 0, false, fmt.Errorf("failed to parse %s: %w", flag, err)
-		}
-
-		return d, true, nil
+	if d, ok, err := parseDurationEnv(flag); err != nil || ok {
+		return d, ok, err
 	}
 
 	if strValueSeconds, ok := os.LookupEnv(deprecatedFlag); ok {
@@ -210,6 +393,96 @@ func parseDurationTimeout(l *zap.SugaredLogger, flag, deprecatedFlag string) (ti
 	return 0, false, nil
 }
 
+// parseBoolEnv returns the boolean value of the environment variable key.
+// The returned bool is false if the variable is not set.
+func parseBoolEnv(key string) (bool, bool, error) {
+	rawValue := os.Getenv(key)
+	if rawValue == "" {
+		return false, false, nil
+	}
+	value, err := strconv.ParseBool(rawValue)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to parse %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// parseDurationEnv returns the duration value of the environment variable
+// key. The returned bool is false if the variable is not set.
+func parseDurationEnv(key string) (time.Duration, bool, error) {
+	rawValue := os.Getenv(key)
+	if rawValue == "" {
+		return 0, false, nil
+	}
+	value, err := time.ParseDuration(rawValue)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// parseMultilineOptions returns the options for the multiline grouping
+// of function logs. Grouping is disabled unless explicitly enabled.
+func parseMultilineOptions() ([]logsapi.ClientOption, error) {
+	enabled, _, err := parseBoolEnv("ELASTIC_APM_LAMBDA_LOG_MULTILINE")
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	var pattern logsapi.MultilinePattern
+	if start := os.Getenv("ELASTIC_APM_LAMBDA_LOG_MULTILINE_START"); start != "" {
+		if pattern.Start, err = regexp.Compile(start); err != nil {
+			return nil, fmt.Errorf("failed to parse ELASTIC_APM_LAMBDA_LOG_MULTILINE_START: %w", err)
+		}
+	}
+	if continuation := os.Getenv("ELASTIC_APM_LAMBDA_LOG_MULTILINE_CONTINUATION"); continuation != "" {
+		if pattern.Continuation, err = regexp.Compile(continuation); err != nil {
+			return nil, fmt.Errorf("failed to parse ELASTIC_APM_LAMBDA_LOG_MULTILINE_CONTINUATION: %w", err)
+		}
+	}
+
+	opts := []logsapi.ClientOption{
+		logsapi.WithMultilineGrouping(logsapi.DefaultMultilineMaxLines, logsapi.DefaultMultilineMaxDuration),
+	}
+	if pattern.Start != nil || pattern.Continuation != nil {
+		opts = append(opts, logsapi.WithMultilinePattern(pattern))
+	}
+	return opts, nil
+}
+
+// parseLogLimitOptions returns the options for the per invocation limits
+// of function logs. The limits are disabled unless a cap is set.
+func parseLogLimitOptions() ([]logsapi.ClientOption, error) {
+	limits := map[string]int{}
+	for _, name := range []string{
+		"ELASTIC_APM_LAMBDA_LOG_MAX_LINES",
+		"ELASTIC_APM_LAMBDA_LOG_MAX_BYTES",
+		"ELASTIC_APM_LAMBDA_LOG_MAX_ERROR_LINES",
+		"ELASTIC_APM_LAMBDA_LOG_SAMPLING",
+	} {
+		if rawValue := os.Getenv(name); rawValue != "" {
+			value, err := strconv.Atoi(rawValue)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+			limits[name] = value
+		}
+	}
+
+	maxLines, maxBytes := limits["ELASTIC_APM_LAMBDA_LOG_MAX_LINES"], limits["ELASTIC_APM_LAMBDA_LOG_MAX_BYTES"]
+	if maxLines <= 0 && maxBytes <= 0 {
+		return nil, nil
+	}
+	opts := []logsapi.ClientOption{
+		logsapi.WithInvocationLogLimits(maxLines, maxBytes),
+		logsapi.WithLogSampling(limits["ELASTIC_APM_LAMBDA_LOG_SAMPLING"]),
+	}
+	if maxErrorLines, ok := limits["ELASTIC_APM_LAMBDA_LOG_MAX_ERROR_LINES"]; ok {
+		opts = append(opts, logsapi.WithErrorLogLimit(maxErrorLines))
+	}
+	return opts, nil
+}
+
 func parseStrategy(value string) (apmproxy.SendStrategy, bool) {
 	switch strings.ToLower(value) {
 	case "background":
@@ -236,3 +509,47 @@ func buildLogger(level string) (*zap.SugaredLogger, error) {
 		logger.WithLevel(l),
 	)
 }
+
+// openOutput returns the writer of the dry-run mode for a comma separated
+// list of outputs, stdout or file, or nil for the apm_server output. The
+// apm_server output cannot be combined with the dry-run outputs.
+func (app *App) openOutput(rawOutput, path string) (io.Writer, error) {
+	outputs := strings.Split(rawOutput, ",")
+	for i, output := range outputs {
+		outputs[i] = strings.TrimSpace(output)
+		switch outputs[i] {
+		case "apm_server":
+			if len(outputs) > 1 {
+				return nil, fmt.Errorf("invalid ELASTIC_APM_LAMBDA_OUTPUT %q, apm_server cannot be combined with stdout or file", rawOutput)
+			}
+		case "stdout", "file":
+		default:
+			return nil, fmt.Errorf("unknown ELASTIC_APM_LAMBDA_OUTPUT %q, expected apm_server, stdout or file", output)
+		}
+	}
+	var writers []io.Writer
+	for _, output := range outputs {
+		switch output {
+		case "stdout":
+			writers = append(writers, os.Stdout)
+		case "file":
+			if path == "" {
+				path = defaultOutputFile
+			}
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open output file: %w", err)
+			}
+			app.outputFile = f
+			writers = append(writers, f)
+		}
+	}
+	switch len(writers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return writers[0], nil
+	default:
+		return io.MultiWriter(writers...), nil
+	}
+}
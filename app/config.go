@@ -22,13 +22,14 @@ import (
 )
 
 type appConfig struct {
-	awsLambdaRuntimeAPI           string
-	awsConfig                     aws.Config
-	extensionName                 string
-	disableLogsAPI                bool
-	enableFunctionLogSubscription bool
-	logLevel                      string
-	logsapiAddr                   string
+	awsLambdaRuntimeAPI            string
+	awsConfig                      aws.Config
+	extensionName                  string
+	disableLogsAPI                 bool
+	enableFunctionLogSubscription  bool
+	enableExtensionLogSubscription bool
+	logLevel                       string
+	logsapiAddr                    string
 }
 
 // ConfigOption is used to configure the lambda extension
@@ -66,6 +67,15 @@ func WithFunctionLogSubscription() ConfigOption {
 	}
 }
 
+// WithExtensionLogSubscription enables the logs api subscription
+// to extension log stream. This option will only work if LogsAPI
+// is not disabled by the WithoutLogsAPI config option.
+func WithExtensionLogSubscription() ConfigOption {
+	return func(c *appConfig) {
+		c.enableExtensionLogSubscription = true
+	}
+}
+
 // WithLogLevel sets the log level.
 func WithLogLevel(level string) ConfigOption {
 	return func(c *appConfig) {
@@ -0,0 +1,72 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package app
+
+import (
+	"os"
+	"strings"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"github.com/elastic/apm-aws-lambda/version"
+	"go.elastic.co/fastjson"
+)
+
+// extensionAgentName is the agent name of the data produced by the
+// extension itself.
+const extensionAgentName = "apm-lambda-extension"
+
+// lambdaMetadata describes the function using the environment of the
+// execution environment. It is used for data that is not reported by
+// an APM agent, the agent field is left to the caller.
+func lambdaMetadata() model.Metadata {
+	metadata := model.Metadata{
+		Service: model.Service{
+			Name:        os.Getenv("ELASTIC_APM_SERVICE_NAME"),
+			Version:     os.Getenv("ELASTIC_APM_SERVICE_VERSION"),
+			Environment: os.Getenv("ELASTIC_APM_ENVIRONMENT"),
+		},
+		Cloud: &model.Cloud{
+			Provider: "aws",
+			Region:   os.Getenv("AWS_REGION"),
+			Service:  &model.CloudService{Name: "lambda"},
+		},
+	}
+	if metadata.Service.Name == "" {
+		metadata.Service.Name = os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	}
+	if metadata.Service.Version == "" {
+		metadata.Service.Version = os.Getenv("AWS_LAMBDA_FUNCTION_VERSION")
+	}
+	// AWS_EXECUTION_ENV is of the form AWS_Lambda_<runtime>, e.g. AWS_Lambda_python3.12.
+	if runtime, ok := strings.CutPrefix(os.Getenv("AWS_EXECUTION_ENV"), "AWS_Lambda_"); ok {
+		metadata.Service.Runtime = &model.Runtime{Name: runtime}
+	}
+	return metadata
+}
+
+// extensionMetadata returns the intake v2 metadata event describing the
+// function, for the data produced by the extension without an APM agent.
+func extensionMetadata() ([]byte, error) {
+	metadata := lambdaMetadata()
+	metadata.Service.Agent = model.Agent{Name: extensionAgentName, Version: version.Version}
+	var w fastjson.Writer
+	if err := (&model.MetadataContainer{Metadata: &metadata}).MarshalFastJSON(&w); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
@@ -19,11 +19,15 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/elastic/apm-aws-lambda/accumulator"
 	"github.com/elastic/apm-aws-lambda/extension"
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/elastic/apm-aws-lambda/xray"
 )
 
 // Run runs the app.
@@ -55,6 +59,22 @@ func (app *App) Run(ctx context.Context) error {
 		}
 	}()
 
+	if app.outputFile != nil {
+		defer func() {
+			if err := app.outputFile.Close(); err != nil {
+				app.logger.Warnf("Error while closing the output file: %v", err)
+			}
+		}()
+	}
+
+	if app.recordFile != nil {
+		defer func() {
+			if err := app.recordFile.Close(); err != nil {
+				app.logger.Warnf("Error while closing the record file: %v", err)
+			}
+		}()
+	}
+
 	// Flush all data before shutting down.
 	defer func() {
 		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -63,6 +83,17 @@ func (app *App) Run(ctx context.Context) error {
 		app.apmClient.FlushAPMData(flushCtx)
 	}()
 
+	if app.xrayListener != nil {
+		if err := app.xrayListener.Start(); err != nil {
+			return fmt.Errorf("failed to start the X-Ray listener : %w", err)
+		}
+		defer func() {
+			if err := app.xrayListener.Shutdown(); err != nil {
+				app.logger.Warnf("Error while shutting down the X-Ray listener: %v", err)
+			}
+		}()
+	}
+
 	if app.logsClient != nil {
 		if err := app.logsClient.StartService(app.extensionClient.ExtensionID); err != nil {
 			app.logger.Warnf("Error while subscribing to the Logs API: %v", err)
@@ -79,6 +110,19 @@ func (app *App) Run(ctx context.Context) error {
 		}
 	}
 
+	// The collected StatsD metrics are flushed on Logs API events, after
+	// each invocation without the Logs API, and at shutdown.
+	if app.statsdListener != nil {
+		if err := app.statsdListener.Start(); err != nil {
+			return fmt.Errorf("failed to start the StatsD listener : %w", err)
+		}
+		defer func() {
+			if err := app.statsdListener.Shutdown(); err != nil {
+				app.logger.Warnf("Error while shutting down the StatsD listener: %v", err)
+			}
+		}()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -122,8 +166,20 @@ func (app *App) Run(ctx context.Context) error {
 				if err := app.batch.OnShutdown(event.ShutdownReason); err != nil {
 					app.logger.Errorf("Error finalizing invocation on shutdown: %v", err)
 				}
+				if app.logsClient != nil {
+					// The platform.report events received in the meantime
+					// correct the invocations finalized on shutdown.
+					app.logsClient.FlushData(ctx, event.RequestID, event.InvokedFunctionArn, app.apmClient.ForwardLambdaData, true)
+				}
+				if app.statsdListener != nil {
+					app.flushStatsD(ctx)
+				}
+				app.flushSelfMonitoring(ctx)
 				return nil
 			}
+			if app.statsdListener != nil && app.logsClient == nil {
+				app.flushStatsD(ctx)
+			}
 			if app.apmClient.ShouldFlush() {
 				// Use a new cancellable context for flushing APM data to make sure
 				// that the underlying transport is reset for next invocation without
@@ -169,6 +225,12 @@ func (app *App) processEvent(
 		return nil, err
 	}
 
+	if app.recorder != nil {
+		if err := app.recordNextEvent(event); err != nil {
+			app.logger.Warnf("Failed to record next event: %v", err)
+		}
+	}
+
 	// Used to compute Lambda Timeout
 	event.Timestamp = time.Now()
 	app.logger.Debug("Received event.")
@@ -182,6 +244,17 @@ func (app *App) processEvent(
 			event.DeadlineMs,
 			event.Timestamp,
 		)
+		// The X-Ray trace context of the invocation is recorded in the
+		// proxy and synthesized transactions.
+		if header, err := xray.ParseTraceHeader(event.Tracing.Value); err == nil {
+			if traceID, err := header.TraceID(); err == nil {
+				app.batch.SetXRayTraceContext(event.RequestID, accumulator.XRayTraceContext{
+					Root:     header.Root,
+					TraceID:  traceID,
+					ParentID: header.Parent,
+				})
+			}
+		}
 	case extension.Shutdown:
 		// platform.report metric (and some other metrics) might not have been
 		// reported by the logs API even till shutdown. At shutdown we will make
@@ -253,3 +326,41 @@ func (app *App) processEvent(
 	}
 	return event, nil
 }
+
+// recordNextEvent records the event returned by the Extensions API.
+func (app *App) recordNextEvent(event *extension.NextEventResponse) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal next event: %w", err)
+	}
+	return app.recorder.Record(recorder.NextEvent, body)
+}
+
+// flushStatsD forwards the StatsD metrics collected since the last flush.
+func (app *App) flushStatsD(ctx context.Context) {
+	metricsets, err := app.statsdListener.FlushMetrics(time.Now())
+	if err != nil {
+		app.logger.Errorf("Error processing StatsD metrics: %v", err)
+		return
+	}
+	for _, ms := range metricsets {
+		if err := app.apmClient.ForwardLambdaData(ctx, ms); err != nil {
+			app.logger.Errorf("Error forwarding StatsD metrics: %v", err)
+		}
+	}
+}
+
+// flushSelfMonitoring forwards the self-monitoring metrics collected since
+// the last flush.
+func (app *App) flushSelfMonitoring(ctx context.Context) {
+	metricsets, err := app.monitor.Flush(time.Now())
+	if err != nil {
+		app.logger.Errorf("Error processing self-monitoring metrics: %v", err)
+		return
+	}
+	for _, ms := range metricsets {
+		if err := app.apmClient.ForwardLambdaData(ctx, ms); err != nil {
+			app.logger.Errorf("Error forwarding self-monitoring metrics: %v", err)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package emulator emulates the AWS Lambda execution environment in
+// process, for hermetic integration tests of the extension. It implements
+// the Extensions API register, next event and error endpoints, the Logs
+// and Telemetry API subscriptions, and pushes the platform events and
+// function logs of a scripted timeline of invocations and shutdowns.
+package emulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/extension"
+	"github.com/elastic/apm-aws-lambda/logsapi"
+	"github.com/google/uuid"
+)
+
+const (
+	extensionNameHeader       = "Lambda-Extension-Name"
+	extensionIdentifierHeader = "Lambda-Extension-Identifier"
+	extensionErrorTypeHeader  = "Lambda-Extension-Function-Error-Type"
+)
+
+// errClosed is returned to the pending requests once the emulator is
+// closed.
+var errClosed = errors.New("emulator closed")
+
+// Outcome is how an invocation ends.
+type Outcome string
+
+const (
+	// Success is an invocation whose handler returned.
+	Success Outcome = "success"
+	// Error is an invocation whose handler returned an error.
+	Error Outcome = "error"
+	// Timeout is an invocation that ran until its deadline.
+	Timeout Outcome = "timeout"
+	// Crash is an invocation whose runtime exited. As in Lambda, the
+	// environment is reset: the next event is a SHUTDOWN with the failure
+	// reason, the queued steps are not run.
+	Crash Outcome = "crash"
+	// OutOfMemory is an invocation whose runtime was killed for using all
+	// the memory of the function. The environment is reset as for Crash.
+	OutOfMemory Outcome = "out_of_memory"
+)
+
+// Invocation is an invoke of the timeline.
+type Invocation struct {
+	// RequestID is the request ID of the invocation. A random one is used
+	// if it is empty.
+	RequestID string
+	// Delay is the time the environment stays idle before the invoke.
+	Delay time.Duration
+	// Duration is how long the runtime takes to run the invocation. It is
+	// capped by the function timeout.
+	Duration time.Duration
+	// Outcome is how the invocation ends, Success if it is empty.
+	Outcome Outcome
+	// ErrorType is the error type reported for the Error outcome.
+	ErrorType string
+	// MaxMemoryUsedMB is the memory used reported for the invocation.
+	MaxMemoryUsedMB int
+	// Logs are the function log lines written by the invocation.
+	Logs []string
+	// TraceHeader is the X-Ray tracing header of the invocation.
+	TraceHeader string
+	// Handler, if not nil, runs as the function code when the invocation
+	// starts, for example to send APM agent data to the extension. Its
+	// context is canceled at the deadline of the invocation.
+	Handler func(ctx context.Context, inv InvocationContext)
+}
+
+// InvocationContext describes a running invocation to its handler.
+type InvocationContext struct {
+	RequestID          string
+	InvokedFunctionArn string
+	Deadline           time.Time
+	TraceHeader        string
+}
+
+// Shutdown is a shutdown of the timeline.
+type Shutdown struct {
+	// Reason is the shutdown reason, spindown if it is empty.
+	Reason string
+	// Delay is the time the environment stays idle before the shutdown.
+	Delay time.Duration
+}
+
+type step struct {
+	invocation *Invocation
+	shutdown   *Shutdown
+	// notBefore is the end of the delay of the step, set when the step
+	// is first taken.
+	notBefore time.Time
+}
+
+// delay returns the idle time before the step.
+func (s step) delay() time.Duration {
+	if s.shutdown != nil {
+		return s.shutdown.Delay
+	}
+	return s.invocation.Delay
+}
+
+// Emulator emulates the Lambda Runtime API for an extension. Invocations
+// and shutdowns are queued with Invoke and Shutdown, and are returned in
+// order by the next event endpoint, which blocks while the queue is empty.
+type Emulator struct {
+	cfg    config
+	server *httptest.Server
+	steps  chan step
+	closed chan struct{}
+	done   chan struct{}
+	pusher *pusher
+
+	mu            sync.Mutex
+	extensionID   string
+	extensionName string
+	registeredAt  time.Time
+	initSent      bool
+	invoked       bool
+	current       *runningInvocation
+	// pending are the steps run before the queued ones: the steps whose
+	// next request was canceled and the shutdown of a reset.
+	pending    []step
+	initErrors []string
+	exitErrors []string
+
+	closeOnce sync.Once
+	doneOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+// New starts an Emulator. It must be closed with Close.
+func New(opts ...Option) *Emulator {
+	cfg := config{
+		functionName:    "emulated-function",
+		functionVersion: "$LATEST",
+		handler:         "index.handler",
+		region:          "us-east-1",
+		accountID:       "123456789012",
+		memorySizeMB:    128,
+		timeout:         3 * time.Second,
+		shutdownTimeout: 2 * time.Second,
+		initDuration:    100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	e := &Emulator{
+		cfg:    cfg,
+		steps:  make(chan step, 1024),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	e.pusher = newPusher(e.closed)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/2020-01-01/extension/register", e.handleRegister)
+	mux.HandleFunc("/2020-01-01/extension/event/next", e.handleNext)
+	mux.HandleFunc("/2020-01-01/extension/init/error", e.handleError(&e.initErrors))
+	mux.HandleFunc("/2020-01-01/extension/exit/error", e.handleError(&e.exitErrors))
+	mux.HandleFunc("/2020-08-15/logs", e.handleSubscribe(false))
+	mux.HandleFunc("/2022-07-01/telemetry", e.handleSubscribe(true))
+	e.server = httptest.NewServer(mux)
+	return e
+}
+
+// RuntimeAPI returns the address of the emulated Runtime API, the value
+// of AWS_LAMBDA_RUNTIME_API in Lambda.
+func (e *Emulator) RuntimeAPI() string {
+	return strings.TrimPrefix(e.server.URL, "http://")
+}
+
+// FunctionARN returns the ARN of the emulated function.
+func (e *Emulator) FunctionARN() string {
+	return fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", e.cfg.region, e.cfg.accountID, e.cfg.functionName)
+}
+
+// Invoke queues invocations.
+func (e *Emulator) Invoke(invocations ...Invocation) {
+	for i := range invocations {
+		inv := invocations[i]
+		e.steps <- step{invocation: &inv}
+	}
+}
+
+// Shutdown queues a shutdown. The extension receives no event after it.
+func (e *Emulator) Shutdown(s Shutdown) {
+	e.steps <- step{shutdown: &s}
+}
+
+// Done returns a channel closed once the shutdown event has been sent.
+func (e *Emulator) Done() <-chan struct{} {
+	return e.done
+}
+
+// InitErrors returns the error types reported by the extension on the
+// init error endpoint.
+func (e *Emulator) InitErrors() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.initErrors...)
+}
+
+// ExitErrors returns the error types reported by the extension on the
+// exit error endpoint.
+func (e *Emulator) ExitErrors() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.exitErrors...)
+}
+
+// Close stops the running invocations and the emulated API.
+func (e *Emulator) Close() {
+	e.closeOnce.Do(func() {
+		close(e.closed)
+	})
+	e.server.Close()
+	e.wg.Wait()
+	e.pusher.wait()
+}
+
+func (e *Emulator) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	e.mu.Lock()
+	if e.extensionID != "" {
+		e.mu.Unlock()
+		writeError(w, http.StatusForbidden, "Extension.AlreadyRegistered", "extension already registered")
+		return
+	}
+	e.extensionID = uuid.New().String()
+	e.extensionName = r.Header.Get(extensionNameHeader)
+	e.registeredAt = time.Now()
+	id := e.extensionID
+	e.mu.Unlock()
+
+	w.Header().Set(extensionIdentifierHeader, id)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(extension.RegisterResponse{
+		FunctionName:    e.cfg.functionName,
+		FunctionVersion: e.cfg.functionVersion,
+		Handler:         e.cfg.handler,
+	})
+}
+
+func (e *Emulator) handleNext(w http.ResponseWriter, r *http.Request) {
+	if !e.authorized(w, r) {
+		return
+	}
+	e.sendInitEvents()
+	if err := e.finishInvocation(r.Context()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	s, err := e.nextStep(r.Context())
+	if err != nil {
+		if errors.Is(err, errClosed) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	// The step is kept for the next request if this one is canceled
+	// during the delay.
+	if s.notBefore.IsZero() {
+		s.notBefore = time.Now().Add(s.delay())
+	}
+	if !sleep(r.Context(), e.closed, time.Until(s.notBefore)) {
+		e.requeue(s)
+		return
+	}
+
+	var event extension.NextEventResponse
+	if s.shutdown != nil {
+		reason := s.shutdown.Reason
+		if reason == "" {
+			reason = "spindown"
+		}
+		event = extension.NextEventResponse{
+			EventType:      extension.Shutdown,
+			ShutdownReason: reason,
+			DeadlineMs:     time.Now().Add(e.cfg.shutdownTimeout).UnixMilli(),
+		}
+	} else {
+		event = e.startInvocation(*s.invocation)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(event)
+	if s.shutdown != nil {
+		e.doneOnce.Do(func() { close(e.done) })
+	}
+}
+
+// nextStep returns the next step of the timeline, waiting for one to be
+// queued.
+func (e *Emulator) nextStep(ctx context.Context) (step, error) {
+	e.mu.Lock()
+	if len(e.pending) > 0 {
+		s := e.pending[0]
+		e.pending = e.pending[1:]
+		e.mu.Unlock()
+		return s, nil
+	}
+	e.mu.Unlock()
+	select {
+	case s := <-e.steps:
+		return s, nil
+	case <-ctx.Done():
+		return step{}, ctx.Err()
+	case <-e.closed:
+		return step{}, errClosed
+	}
+}
+
+// requeue makes s the next step of the timeline.
+func (e *Emulator) requeue(s step) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = append([]step{s}, e.pending...)
+}
+
+// authorized checks that the request comes from the registered extension.
+func (e *Emulator) authorized(w http.ResponseWriter, r *http.Request) bool {
+	e.mu.Lock()
+	id := e.extensionID
+	e.mu.Unlock()
+	if id == "" || r.Header.Get(extensionIdentifierHeader) != id {
+		writeError(w, http.StatusForbidden, "Extension.InvalidExtensionID", "invalid extension identifier")
+		return false
+	}
+	return true
+}
+
+func (e *Emulator) handleError(errs *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !e.authorized(w, r) {
+			return
+		}
+		e.mu.Lock()
+		*errs = append(*errs, r.Header.Get(extensionErrorTypeHeader))
+		e.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(extension.StatusResponse{Status: "OK"})
+	}
+}
+
+func (e *Emulator) handleSubscribe(telemetry bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !e.authorized(w, r) {
+			return
+		}
+		if telemetry && e.cfg.disableTelemetryAPI {
+			writeError(w, http.StatusNotFound, "InvalidRequest", "telemetry API not available")
+			return
+		}
+		var req logsapi.SubscribeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
+			return
+		}
+		e.pusher.subscribe(req.Destination.URI, req.LogTypes)
+		_, _ = w.Write([]byte("OK"))
+	}
+}
+
+// sendInitEvents pushes the events of the init phase before the first
+// invocation.
+func (e *Emulator) sendInitEvents() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.initSent {
+		return
+	}
+	e.initSent = true
+	start := e.registeredAt
+	end := start.Add(e.cfg.initDuration)
+	initRecord := map[string]interface{}{
+		"initializationType": "on-demand",
+		"phase":              "init",
+		"functionName":       e.cfg.functionName,
+		"functionVersion":    e.cfg.functionVersion,
+	}
+	e.pusher.push(
+		platformEvent(start, logsapi.PlatformInitStart, initRecord),
+		platformEvent(end, logsapi.PlatformInitRuntimeDone, map[string]interface{}{
+			"initializationType": "on-demand",
+			"phase":              "init",
+			"status":             "success",
+		}),
+		platformEvent(end, logsapi.PlatformInitReport, map[string]interface{}{
+			"initializationType": "on-demand",
+			"phase":              "init",
+			"status":             "success",
+			"metrics":            map[string]interface{}{"durationMs": durationMs(e.cfg.initDuration)},
+		}),
+	)
+}
+
+// sleep waits for d and returns false if the wait was interrupted.
+func sleep(ctx context.Context, closed <-chan struct{}, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-closed:
+		return false
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"errorType":    errorType,
+		"errorMessage": message,
+	})
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func billedDurationMs(d time.Duration) int64 {
+	return int64(math.Ceil(durationMs(d)))
+}
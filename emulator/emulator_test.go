@@ -0,0 +1,447 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package emulator_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/app"
+	"github.com/elastic/apm-aws-lambda/emulator"
+	"github.com/elastic/apm-aws-lambda/extension"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap/zaptest"
+)
+
+const agentMetadata = `{"metadata":{"service":{"name":"emulated","agent":{"name":"nodejs","version":"4.0.0"}}}}`
+
+// apmServer collects the events sent to the APM Server.
+type apmServer struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (s *apmServer) find(key string) []gjson.Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []gjson.Result
+	for _, event := range s.events {
+		if v := gjson.Get(event, key); v.Exists() {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+// runApp runs the extension against the emulator and returns the APM
+// Server collecting its data and the address of the agent data receiver.
+func runApp(t *testing.T, emu *emulator.Emulator) (*apmServer, string, <-chan error) {
+	t.Helper()
+	collector := &apmServer{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/intake/v2/events" {
+			return
+		}
+		raw, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body, err := accumulator.GetUncompressedBytes(raw, r.Header.Get("Content-Encoding"))
+		require.NoError(t, err)
+		collector.mu.Lock()
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			if len(line) > 0 {
+				collector.events = append(collector.events, string(line))
+			}
+		}
+		collector.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	t.Setenv("ELASTIC_APM_LAMBDA_APM_SERVER", server.URL)
+	t.Setenv("ELASTIC_APM_SECRET_TOKEN", "none")
+	t.Setenv("ELASTIC_APM_DATA_RECEIVER_SERVER_PORT", strconv.Itoa(port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	t.Cleanup(cancel)
+	application, err := app.New(ctx,
+		app.WithExtensionName("apm-lambda-extension"),
+		app.WithLambdaRuntimeAPI(emu.RuntimeAPI()),
+		app.WithLogsapiAddress("127.0.0.1:0"),
+		app.WithFunctionLogSubscription(),
+	)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- application.Run(ctx)
+	}()
+	return collector, fmt.Sprintf("http://127.0.0.1:%d", port), done
+}
+
+// agent returns a handler sending the metadata and events to the
+// extension as an APM agent would.
+func agent(t *testing.T, receiverURL *string, register bool, events ...string) func(context.Context, emulator.InvocationContext) {
+	return func(ctx context.Context, inv emulator.InvocationContext) {
+		if register {
+			body := agentMetadata + "\n" + `{"transaction":{"id":"c5ea9ba7dbfcd6ee","trace_id":"0af7651916cd43dd8448eb211c80319c","name":"handler","type":"request","sampled":true,"span_count":{"started":0}}}` + "\n"
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, *receiverURL+"/register/transaction", bytes.NewBufferString(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/vnd.elastic.apm.transaction+ndjson")
+			req.Header.Set("X-Elastic-Aws-Request-Id", inv.RequestID)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+		if len(events) == 0 {
+			return
+		}
+		body := agentMetadata + "\n"
+		for _, event := range events {
+			body += event + "\n"
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, *receiverURL+"/intake/v2/events?flushed=true", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+}
+
+func waitForShutdown(t *testing.T, emu *emulator.Emulator, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(20 * time.Second):
+		t.Fatal("timed out waiting for the extension to shut down")
+	}
+	select {
+	case <-emu.Done():
+	default:
+		t.Fatal("the extension exited before the shutdown event")
+	}
+}
+
+func TestInvokeAndShutdown(t *testing.T) {
+	emu := emulator.New(emulator.WithFunction("my-function", "1"))
+	defer emu.Close()
+	apm, receiverURL, done := runApp(t, emu)
+
+	emu.Invoke(emulator.Invocation{
+		RequestID: "req-1",
+		Duration:  50 * time.Millisecond,
+		Logs:      []string{"hello from the emulator"},
+		Handler: agent(t, &receiverURL, true,
+			`{"transaction":{"id":"c5ea9ba7dbfcd6ee","trace_id":"0af7651916cd43dd8448eb211c80319c","name":"handler","type":"request","duration":40,"outcome":"success","sampled":true,"span_count":{"started":0}}}`,
+		),
+	})
+	emu.Shutdown(emulator.Shutdown{})
+	waitForShutdown(t, emu, done)
+
+	txns := apm.find("transaction")
+	require.Len(t, txns, 2)
+	assert.Equal(t, "handler", txns[0].Get("name").String())
+	assert.Equal(t, "my-function init", txns[1].Get("name").String())
+	assert.Equal(t, "faas.init", txns[1].Get("type").String())
+
+	logs := apm.find("log")
+	require.Len(t, logs, 1)
+	assert.Equal(t, "hello from the emulator", logs[0].Get("message").String())
+	assert.Equal(t, "req-1", logs[0].Get("faas.execution").String())
+
+	metrics := apm.find("metricset.samples.faas\\.billed_duration")
+	require.Len(t, metrics, 1)
+	assert.GreaterOrEqual(t, metrics[0].Get("value").Int(), int64(50))
+	assert.Empty(t, emu.ExitErrors())
+}
+
+func TestStatsDMetricsFlushedAtShutdown(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.LocalAddr().String()
+	require.NoError(t, l.Close())
+	t.Setenv("ELASTIC_APM_LAMBDA_STATSD_LISTENER_ADDRESS", addr)
+
+	emu := emulator.New()
+	defer emu.Close()
+	apm, receiverURL, done := runApp(t, emu)
+
+	emu.Invoke(emulator.Invocation{
+		Duration: 20 * time.Millisecond,
+		Handler: func(ctx context.Context, inv emulator.InvocationContext) {
+			agent(t, &receiverURL, true)(ctx, inv)
+			// The metric is received after the invocation is done.
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				conn, err := net.Dial("udp", addr)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				_, _ = conn.Write([]byte("orders.processed:3|c"))
+			}()
+		},
+	})
+	emu.Shutdown(emulator.Shutdown{Delay: 500 * time.Millisecond})
+	waitForShutdown(t, emu, done)
+
+	metrics := apm.find("metricset.samples.orders\\.processed")
+	require.Len(t, metrics, 1)
+	assert.Equal(t, 3.0, metrics[0].Get("value").Float())
+}
+
+func TestExtensionDataWithoutAgent(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.LocalAddr().String()
+	require.NoError(t, l.Close())
+	t.Setenv("ELASTIC_APM_LAMBDA_STATSD_LISTENER_ADDRESS", addr)
+
+	emu := emulator.New()
+	defer emu.Close()
+	apm, _, done := runApp(t, emu)
+
+	emu.Invoke(emulator.Invocation{
+		Duration: 20 * time.Millisecond,
+		Handler: func(ctx context.Context, inv emulator.InvocationContext) {
+			conn, err := net.Dial("udp", addr)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_, _ = conn.Write([]byte("orders.processed:3|c"))
+		},
+	})
+	emu.Shutdown(emulator.Shutdown{Delay: 200 * time.Millisecond})
+	waitForShutdown(t, emu, done)
+
+	metadata := apm.find("metadata.service.agent.name")
+	require.NotEmpty(t, metadata)
+	assert.Equal(t, "apm-lambda-extension", metadata[0].String())
+	assert.Len(t, apm.find("metricset.samples.orders\\.processed"), 1)
+	assert.Len(t, apm.find("metricset.samples.faas\\.billed_duration"), 1)
+}
+
+func TestXRaySegmentsWithoutAgent(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.LocalAddr().String()
+	require.NoError(t, l.Close())
+	t.Setenv("ELASTIC_APM_LAMBDA_XRAY_LISTENER_ADDRESS", addr)
+	t.Setenv("ELASTIC_APM_LAMBDA_XRAY_RELAY", "false")
+	t.Setenv("ELASTIC_APM_LAMBDA_SYNTHESIZE_TRANSACTIONS", "true")
+
+	emu := emulator.New(emulator.WithFunction("my-function", "1"))
+	defer emu.Close()
+	apm, _, done := runApp(t, emu)
+
+	emu.Invoke(emulator.Invocation{
+		Duration: 50 * time.Millisecond,
+		Handler: func(ctx context.Context, inv emulator.InvocationContext) {
+			conn, err := net.Dial("udp", addr)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_, _ = conn.Write([]byte(`{"format": "json", "version": 1}` + "\n" +
+				`{"name": "segment", "id": "70de5b6f19ff9a0a", "trace_id": "1-581cf771-a006649127e371903a2de979", "start_time": 1478293361.271, "end_time": 1478293361.449}`))
+		},
+	})
+	emu.Shutdown(emulator.Shutdown{Delay: 200 * time.Millisecond})
+	waitForShutdown(t, emu, done)
+
+	// The X-Ray transaction is not an agent transaction: the invocation
+	// still gets a synthesized transaction and the extension metadata.
+	var names []string
+	for _, txn := range apm.find("transaction") {
+		names = append(names, txn.Get("name").String())
+	}
+	assert.Contains(t, names, "segment")
+	assert.Contains(t, names, "my-function")
+	for _, agentName := range apm.find("metadata.service.agent.name") {
+		assert.Equal(t, "apm-lambda-extension", agentName.String())
+	}
+}
+
+func TestRuntimeFailures(t *testing.T) {
+	for _, tc := range []struct {
+		outcome       emulator.Outcome
+		exceptionType string
+	}{
+		{outcome: emulator.Crash, exceptionType: accumulator.ExitErrorType},
+		{outcome: emulator.OutOfMemory, exceptionType: accumulator.OutOfMemoryErrorType},
+	} {
+		t.Run(string(tc.outcome), func(t *testing.T) {
+			emu := emulator.New()
+			defer emu.Close()
+			apm, receiverURL, done := runApp(t, emu)
+
+			emu.Invoke(emulator.Invocation{
+				Duration: 20 * time.Millisecond,
+				Outcome:  tc.outcome,
+				Handler:  agent(t, &receiverURL, true),
+			})
+			emu.Shutdown(emulator.Shutdown{})
+			waitForShutdown(t, emu, done)
+
+			errs := apm.find("error")
+			require.Len(t, errs, 1)
+			assert.Equal(t, tc.exceptionType, errs[0].Get("exception.type").String())
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	emu := emulator.New(emulator.WithTimeout(500 * time.Millisecond))
+	defer emu.Close()
+	apm, receiverURL, done := runApp(t, emu)
+
+	emu.Invoke(emulator.Invocation{
+		Outcome: emulator.Timeout,
+		Handler: agent(t, &receiverURL, true),
+	})
+	emu.Shutdown(emulator.Shutdown{Reason: "timeout"})
+	waitForShutdown(t, emu, done)
+
+	txns := apm.find("transaction")
+	var proxyTxn gjson.Result
+	for _, txn := range txns {
+		if txn.Get("type").String() == "request" {
+			proxyTxn = txn
+		}
+	}
+	require.True(t, proxyTxn.Exists())
+	assert.Equal(t, "failure", proxyTxn.Get("outcome").String())
+	assert.Equal(t, "timeout", proxyTxn.Get("result").String())
+}
+
+func TestNextEventRequiresRegistration(t *testing.T) {
+	emu := emulator.New()
+	defer emu.Close()
+
+	resp, err := http.Get("http://" + emu.RuntimeAPI() + "/2020-01-01/extension/event/next")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestCanceledNextEventKeepsTimeline(t *testing.T) {
+	emu := emulator.New()
+	defer emu.Close()
+	client := extension.NewClient(emu.RuntimeAPI(), zaptest.NewLogger(t).Sugar())
+	_, err := client.Register(t.Context(), "apm-lambda-extension")
+	require.NoError(t, err)
+
+	reports := make(chan string, 10)
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		for _, event := range gjson.ParseBytes(body).Array() {
+			if event.Get("type").String() == "platform.report" {
+				reports <- event.Get("record.requestId").String()
+			}
+		}
+	}))
+	defer subscriber.Close()
+	req, err := http.NewRequest(http.MethodPut, "http://"+emu.RuntimeAPI()+"/2022-07-01/telemetry",
+		strings.NewReader(`{"types":["platform"],"destination":{"protocol":"HTTP","URI":"`+subscriber.URL+`"}}`))
+	require.NoError(t, err)
+	req.Header.Set("Lambda-Extension-Identifier", client.ExtensionID)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	emu.Invoke(emulator.Invocation{RequestID: "req-1", Delay: 300 * time.Millisecond, Duration: 300 * time.Millisecond})
+	emu.Invoke(emulator.Invocation{RequestID: "req-2"})
+
+	// The request canceled during the delay does not drop the invocation.
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	_, err = client.NextEvent(ctx)
+	cancel()
+	require.Error(t, err)
+	event, err := nextEvent(t, client)
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", event.RequestID)
+
+	// Neither does the request canceled while the runtime is running drop
+	// the platform.report event of the invocation.
+	ctx, cancel = context.WithTimeout(t.Context(), 50*time.Millisecond)
+	_, err = client.NextEvent(ctx)
+	cancel()
+	require.Error(t, err)
+	event, err = nextEvent(t, client)
+	require.NoError(t, err)
+	assert.Equal(t, "req-2", event.RequestID)
+	select {
+	case reqID := <-reports:
+		assert.Equal(t, "req-1", reqID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the platform.report event")
+	}
+}
+
+func TestRuntimeFailureResetsEnvironment(t *testing.T) {
+	emu := emulator.New()
+	defer emu.Close()
+	client := extension.NewClient(emu.RuntimeAPI(), zaptest.NewLogger(t).Sugar())
+	_, err := client.Register(t.Context(), "apm-lambda-extension")
+	require.NoError(t, err)
+
+	emu.Invoke(
+		emulator.Invocation{RequestID: "req-1", Outcome: emulator.Crash},
+		emulator.Invocation{RequestID: "req-2"},
+	)
+	event, err := nextEvent(t, client)
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", event.RequestID)
+	event, err = nextEvent(t, client)
+	require.NoError(t, err)
+	assert.Equal(t, extension.Shutdown, event.EventType)
+	assert.Equal(t, "failure", event.ShutdownReason)
+	select {
+	case <-emu.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the shutdown")
+	}
+}
+
+// nextEvent calls the next event endpoint, failing if no event is returned
+// in time.
+func nextEvent(t *testing.T, client *extension.Client) (*extension.NextEventResponse, error) {
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	return client.NextEvent(ctx)
+}
@@ -0,0 +1,221 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package emulator
+
+import (
+	"context"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/extension"
+	"github.com/elastic/apm-aws-lambda/logsapi"
+	"github.com/google/uuid"
+)
+
+// runningInvocation is the invocation sent to the extension. Its
+// platform.report event is pushed when the extension asks for the next
+// event after the runtime is done.
+type runningInvocation struct {
+	Invocation
+	arn         string
+	start       time.Time
+	deadline    time.Time
+	first       bool
+	runtimeDone chan struct{}
+
+	status    string
+	errorType string
+	duration  time.Duration
+}
+
+// startInvocation starts running the invocation and returns its invoke
+// event.
+func (e *Emulator) startInvocation(inv Invocation) extension.NextEventResponse {
+	if inv.RequestID == "" {
+		inv.RequestID = uuid.New().String()
+	}
+	if inv.Outcome == "" {
+		inv.Outcome = Success
+	}
+	if inv.MaxMemoryUsedMB == 0 {
+		inv.MaxMemoryUsedMB = e.cfg.memorySizeMB / 2
+	}
+	now := time.Now()
+	running := &runningInvocation{
+		Invocation:  inv,
+		arn:         e.FunctionARN(),
+		start:       now,
+		deadline:    now.Add(e.cfg.timeout),
+		runtimeDone: make(chan struct{}),
+	}
+
+	e.mu.Lock()
+	running.first = !e.invoked
+	e.invoked = true
+	e.current = running
+	e.mu.Unlock()
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.run(running)
+	}()
+
+	event := extension.NextEventResponse{
+		EventType:          extension.Invoke,
+		DeadlineMs:         running.deadline.UnixMilli(),
+		RequestID:          inv.RequestID,
+		InvokedFunctionArn: running.arn,
+	}
+	if inv.TraceHeader != "" {
+		event.Tracing = extension.Tracing{Type: "X-Amzn-Trace-Id", Value: inv.TraceHeader}
+	}
+	return event
+}
+
+// run emulates the runtime running the invocation.
+func (e *Emulator) run(inv *runningInvocation) {
+	defer close(inv.runtimeDone)
+
+	startRecord := map[string]interface{}{
+		"requestId": inv.RequestID,
+		"version":   e.cfg.functionVersion,
+	}
+	events := []telemetryEvent{platformEvent(inv.start, logsapi.PlatformStart, startRecord)}
+	for _, line := range inv.Logs {
+		events = append(events, telemetryEvent{
+			Time:   time.Now().UTC().Format(time.RFC3339Nano),
+			Type:   string(logsapi.FunctionLog),
+			Record: line,
+		})
+	}
+	e.pusher.push(events...)
+
+	ctx, cancel := context.WithDeadline(context.Background(), inv.deadline)
+	defer cancel()
+	go func() {
+		select {
+		case <-e.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if inv.Handler != nil {
+		inv.Handler(ctx, InvocationContext{
+			RequestID:          inv.RequestID,
+			InvokedFunctionArn: inv.arn,
+			Deadline:           inv.deadline,
+			TraceHeader:        inv.TraceHeader,
+		})
+	}
+
+	end := inv.start.Add(inv.Duration)
+	if inv.Outcome == Timeout || end.After(inv.deadline) {
+		inv.Outcome = Timeout
+		end = inv.deadline
+	}
+	if !sleep(ctx, e.closed, time.Until(end)) && inv.Outcome != Timeout {
+		return
+	}
+	if now := time.Now(); now.After(end) {
+		end = now
+	}
+	inv.duration = end.Sub(inv.start)
+
+	switch inv.Outcome {
+	case Success:
+		inv.status = "success"
+	case Error:
+		inv.status = "error"
+		inv.errorType = inv.ErrorType
+		if inv.errorType == "" {
+			inv.errorType = "Function.Error"
+		}
+	case Timeout:
+		inv.status = "timeout"
+	case Crash:
+		inv.status = "failure"
+		inv.errorType = "Runtime.ExitError"
+	case OutOfMemory:
+		inv.status = "failure"
+		inv.errorType = "Runtime.ExitError"
+		inv.MaxMemoryUsedMB = e.cfg.memorySizeMB
+	}
+	if inv.status == "failure" {
+		// Lambda resets the environment after a runtime failure.
+		e.requeue(step{shutdown: &Shutdown{Reason: "failure"}})
+	}
+
+	e.pusher.push(platformEvent(end, logsapi.PlatformRuntimeDone, inv.record(map[string]interface{}{
+		"durationMs":    durationMs(inv.duration),
+		"producedBytes": 0,
+	})))
+}
+
+// finishInvocation waits for the runtime of the current invocation, if
+// any, and pushes its platform.report event.
+func (e *Emulator) finishInvocation(ctx context.Context) error {
+	e.mu.Lock()
+	inv := e.current
+	e.mu.Unlock()
+	if inv == nil {
+		return nil
+	}
+
+	select {
+	case <-inv.runtimeDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-e.closed:
+		return errClosed
+	}
+	// The invocation stays current until its report is pushed, for the
+	// next request if this one is canceled.
+	e.mu.Lock()
+	if e.current != inv {
+		e.mu.Unlock()
+		return nil
+	}
+	e.current = nil
+	e.mu.Unlock()
+
+	metrics := map[string]interface{}{
+		"durationMs":       durationMs(inv.duration),
+		"billedDurationMs": billedDurationMs(inv.duration),
+		"memorySizeMB":     e.cfg.memorySizeMB,
+		"maxMemoryUsedMB":  inv.MaxMemoryUsedMB,
+	}
+	if inv.first {
+		metrics["initDurationMs"] = durationMs(e.cfg.initDuration)
+	}
+	e.pusher.push(platformEvent(time.Now(), logsapi.PlatformReport, inv.record(metrics)))
+	return nil
+}
+
+// record returns the record of the platform.runtimeDone and
+// platform.report events of the invocation.
+func (inv *runningInvocation) record(metrics map[string]interface{}) map[string]interface{} {
+	record := map[string]interface{}{
+		"requestId": inv.RequestID,
+		"status":    inv.status,
+		"metrics":   metrics,
+	}
+	if inv.errorType != "" {
+		record["errorType"] = inv.errorType
+	}
+	return record
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package emulator
+
+import "time"
+
+type config struct {
+	functionName        string
+	functionVersion     string
+	handler             string
+	region              string
+	accountID           string
+	memorySizeMB        int
+	timeout             time.Duration
+	shutdownTimeout     time.Duration
+	initDuration        time.Duration
+	disableTelemetryAPI bool
+}
+
+// Option configures an Emulator.
+type Option func(*config)
+
+// WithFunction sets the name and version of the emulated function.
+func WithFunction(name, version string) Option {
+	return func(c *config) {
+		c.functionName = name
+		c.functionVersion = version
+	}
+}
+
+// WithRegion sets the region and account ID of the function ARN.
+func WithRegion(region, accountID string) Option {
+	return func(c *config) {
+		c.region = region
+		c.accountID = accountID
+	}
+}
+
+// WithMemorySize sets the memory size of the function, in MB.
+func WithMemorySize(mb int) Option {
+	return func(c *config) {
+		c.memorySizeMB = mb
+	}
+}
+
+// WithTimeout sets the timeout of the function, which sets the deadline
+// of the invocations.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeout = timeout
+	}
+}
+
+// WithShutdownTimeout sets how long the extension has to shut down after
+// the shutdown event.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.shutdownTimeout = timeout
+	}
+}
+
+// WithInitDuration sets the duration of the init phase reported in the
+// platform events.
+func WithInitDuration(d time.Duration) Option {
+	return func(c *config) {
+		c.initDuration = d
+	}
+}
+
+// WithoutTelemetryAPI makes the Telemetry API subscription fail, so that
+// the extension falls back to the Logs API.
+func WithoutTelemetryAPI() Option {
+	return func(c *config) {
+		c.disableTelemetryAPI = true
+	}
+}
@@ -0,0 +1,174 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package emulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/logsapi"
+)
+
+// pushRetryInterval is the interval between the attempts to push events
+// the extension did not accept.
+const pushRetryInterval = 50 * time.Millisecond
+
+// telemetryEvent is an event in the Telemetry API format.
+type telemetryEvent struct {
+	Time   string      `json:"time"`
+	Type   string      `json:"type"`
+	Record interface{} `json:"record"`
+}
+
+func platformEvent(ts time.Time, eventType logsapi.LogEventType, record map[string]interface{}) telemetryEvent {
+	return telemetryEvent{
+		Time:   ts.UTC().Format(time.RFC3339Nano),
+		Type:   string(eventType),
+		Record: record,
+	}
+}
+
+// subscriptionType returns the stream of the event type.
+func (e telemetryEvent) subscriptionType() logsapi.SubscriptionType {
+	switch {
+	case e.Type == string(logsapi.FunctionLog):
+		return logsapi.Function
+	case e.Type == string(logsapi.ExtensionLog):
+		return logsapi.Extension
+	case strings.HasPrefix(e.Type, "platform."):
+		return logsapi.Platform
+	default:
+		return ""
+	}
+}
+
+// pusher pushes the events to the subscribed extension, in order. Events
+// are buffered until the extension subscribes, and pushed again until the
+// extension accepts them, like the Lambda service does.
+type pusher struct {
+	client *http.Client
+	closed <-chan struct{}
+	notify chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	uri     string
+	types   map[logsapi.SubscriptionType]bool
+	pending []telemetryEvent
+}
+
+func newPusher(closed <-chan struct{}) *pusher {
+	p := &pusher{
+		client: &http.Client{Timeout: 5 * time.Second},
+		closed: closed,
+		notify: make(chan struct{}, 1),
+	}
+	p.wg.Add(1)
+	go p.loop()
+	return p
+}
+
+func (p *pusher) subscribe(uri string, types []logsapi.SubscriptionType) {
+	p.mu.Lock()
+	p.uri = uri
+	p.types = make(map[logsapi.SubscriptionType]bool, len(types))
+	for _, t := range types {
+		p.types[t] = true
+	}
+	p.mu.Unlock()
+	p.signal()
+}
+
+func (p *pusher) push(events ...telemetryEvent) {
+	p.mu.Lock()
+	p.pending = append(p.pending, events...)
+	p.mu.Unlock()
+	p.signal()
+}
+
+func (p *pusher) signal() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (p *pusher) wait() {
+	p.wg.Wait()
+}
+
+func (p *pusher) loop() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.notify:
+		case <-p.closed:
+			return
+		}
+		for !p.flush() {
+			select {
+			case <-time.After(pushRetryInterval):
+			case <-p.closed:
+				return
+			}
+		}
+	}
+}
+
+// flush pushes the pending events of the subscribed streams and returns
+// false if they must be pushed again.
+func (p *pusher) flush() bool {
+	p.mu.Lock()
+	if p.uri == "" || len(p.pending) == 0 {
+		p.mu.Unlock()
+		return true
+	}
+	uri := p.uri
+	events := p.pending
+	p.pending = nil
+	var batch []telemetryEvent
+	for _, event := range events {
+		if p.types[event.subscriptionType()] {
+			batch = append(batch, event)
+		}
+	}
+	p.mu.Unlock()
+	if len(batch) == 0 {
+		return true
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return true
+	}
+	resp, err := p.client.Post(uri, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode < http.StatusMultipleChoices {
+			return true
+		}
+	}
+	p.mu.Lock()
+	p.pending = append(batch, p.pending...)
+	p.mu.Unlock()
+	return false
+}
@@ -0,0 +1,244 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"go.elastic.co/fastjson"
+)
+
+// Names of the aggregated platform metrics.
+const (
+	// DurationHistogramMetric is the histogram of the invocation
+	// durations, in milliseconds. It is named apart from the
+	// faas.duration sample of the per-invocation metrics so that both
+	// can be sent together.
+	DurationHistogramMetric = "faas.duration.histogram"
+	// BilledDurationHistogramMetric is the histogram of the billed
+	// invocation durations, in milliseconds.
+	BilledDurationHistogramMetric = "faas.billed_duration.histogram"
+	// MemoryUsedHistogramMetric is the histogram of the maximum memory
+	// used by the invocations, in bytes.
+	MemoryUsedHistogramMetric = "system.memory.used"
+	// SuccessCountMetric, ErrorCountMetric and TimeoutCountMetric count
+	// the invocations by the status of their platform.report event.
+	SuccessCountMetric = "faas.invocations.success"
+	ErrorCountMetric   = "faas.invocations.error"
+	TimeoutCountMetric = "faas.invocations.timeout"
+)
+
+// durationBounds are the upper bounds of the buckets of the duration
+// histograms, in milliseconds. Durations are capped by the 15 minutes
+// timeout of Lambda functions.
+var durationBounds = []float64{
+	1, 2, 5, 10, 20, 50, 100, 200, 500,
+	1000, 2000, 5000, 10000, 20000, 50000, 100000, 200000, 500000, 900000,
+}
+
+// memoryBounds are the upper bounds of the buckets of the memory used
+// histogram, in MB. Lambda functions have at most 10240 MB of memory.
+var memoryBounds = []float64{16, 32, 64, 128, 256, 512, 1024, 2048, 3072, 4096, 6144, 8192, 10240}
+
+// histogram counts values in fixed buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
+}
+
+// buckets returns the midpoints and counts of the non empty buckets, in
+// ascending order. Values above the last bound are reported as the last
+// bound.
+func (h *histogram) buckets(scale float64) ([]float64, []uint64) {
+	var values []float64
+	var counts []uint64
+	for i, count := range h.counts {
+		if count == 0 {
+			continue
+		}
+		var value float64
+		switch {
+		case i == len(h.bounds):
+			value = h.bounds[i-1]
+		case i == 0:
+			value = h.bounds[0] / 2
+		default:
+			value = (h.bounds[i-1] + h.bounds[i]) / 2
+		}
+		values = append(values, value*scale)
+		counts = append(counts, count)
+	}
+	return values, counts
+}
+
+type aggregateKey struct {
+	fnARN   string
+	version string
+}
+
+// reportAggregate holds the aggregated platform metrics of a function
+// version.
+type reportAggregate struct {
+	duration       *histogram
+	billedDuration *histogram
+	memoryUsed     *histogram
+	success        uint64
+	errors         uint64
+	timeouts       uint64
+}
+
+// reportAggregator aggregates the platform metrics of the invocations
+// into histograms and counters flushed on an interval.
+type reportAggregator struct {
+	mu         sync.Mutex
+	interval   time.Duration
+	lastFlush  time.Time
+	version    string
+	aggregates map[aggregateKey]*reportAggregate
+}
+
+func newReportAggregator(interval time.Duration) *reportAggregator {
+	return &reportAggregator{
+		interval:   interval,
+		aggregates: make(map[aggregateKey]*reportAggregate),
+	}
+}
+
+// setVersion sets the function version of the following invocations.
+func (a *reportAggregator) setVersion(version string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.version = version
+}
+
+// aggregate returns the aggregate of the function version. The caller
+// must hold the lock.
+func (a *reportAggregator) aggregate(fnARN string) *reportAggregate {
+	key := aggregateKey{fnARN: fnARN, version: a.version}
+	agg, ok := a.aggregates[key]
+	if !ok {
+		agg = &reportAggregate{
+			duration:       newHistogram(durationBounds),
+			billedDuration: newHistogram(durationBounds),
+			memoryUsed:     newHistogram(memoryBounds),
+		}
+		a.aggregates[key] = agg
+	}
+	return agg
+}
+
+// observeReport records the metrics and the status of an invocation.
+// Unknown and empty statuses are not counted.
+func (a *reportAggregator) observeReport(fnARN, status string, metrics PlatformMetrics) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	agg := a.aggregate(fnARN)
+	agg.duration.observe(float64(metrics.DurationMs))
+	agg.billedDuration.observe(float64(metrics.BilledDurationMs))
+	agg.memoryUsed.observe(float64(metrics.MaxMemoryUsedMB))
+	switch status {
+	case "success":
+		agg.success++
+	case "timeout":
+		agg.timeouts++
+	case "error", "failure":
+		agg.errors++
+	}
+}
+
+// flush returns the metricsets of the aggregated metrics if the flush
+// interval has elapsed since the last flush, or if force is true.
+func (a *reportAggregator) flush(ts time.Time, force bool) ([][]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lastFlush.IsZero() {
+		a.lastFlush = ts
+	}
+	if !force && ts.Sub(a.lastFlush) < a.interval {
+		return nil, nil
+	}
+	a.lastFlush = ts
+
+	metricsets := make([][]byte, 0, len(a.aggregates))
+	for key, agg := range a.aggregates {
+		metricsContainer := model.MetricsContainer{
+			Metrics: &model.Metrics{
+				Timestamp: model.Time(ts),
+				FAAS:      &model.ExtendedFAAS{ID: key.fnARN},
+			},
+		}
+		if key.version != "" {
+			metricsContainer.Metrics.Labels = model.Labels{"faas_version": key.version}
+		}
+		convMB2Bytes := float64(1024 * 1024)
+		for _, h := range []struct {
+			name, unit string
+			hist       *histogram
+			scale      float64
+		}{
+			{DurationHistogramMetric, "ms", agg.duration, 1},
+			{BilledDurationHistogramMetric, "ms", agg.billedDuration, 1},
+			{MemoryUsedHistogramMetric, "byte", agg.memoryUsed, convMB2Bytes},
+		} {
+			if values, counts := h.hist.buckets(h.scale); len(values) > 0 {
+				metricsContainer.AddHistogram(h.name, h.unit, values, counts)
+			}
+		}
+		metricsContainer.Add(SuccessCountMetric, float64(agg.success))
+		metricsContainer.Add(ErrorCountMetric, float64(agg.errors))
+		metricsContainer.Add(TimeoutCountMetric, float64(agg.timeouts))
+
+		var jsonWriter fastjson.Writer
+		if err := metricsContainer.MarshalFastJSON(&jsonWriter); err != nil {
+			return nil, err
+		}
+		metricsets = append(metricsets, jsonWriter.Bytes())
+	}
+	a.aggregates = make(map[aggregateKey]*reportAggregate)
+	return metricsets, nil
+}
+
+// flushAggregatedMetrics forwards the aggregated platform metrics if the
+// flush interval has elapsed, or if force is true.
+func (lc *Client) flushAggregatedMetrics(ctx context.Context, ts time.Time, force bool, forwardFn Forwarder) {
+	if lc.aggregator == nil {
+		return
+	}
+	metricsets, err := lc.aggregator.flush(ts, force)
+	if err != nil {
+		lc.logger.Errorf("Error processing aggregated platform metrics: %v", err)
+		return
+	}
+	for _, ms := range metricsets {
+		if err := forwardFn(ctx, ms); err != nil {
+			lc.logger.Errorf("Error forwarding aggregated platform metrics: %v", err)
+		}
+	}
+}
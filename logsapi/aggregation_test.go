@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogram([]float64{10, 100, 1000})
+	for _, v := range []float64{5, 10, 50, 60, 5000} {
+		h.observe(v)
+	}
+	values, counts := h.buckets(1)
+	assert.Equal(t, []float64{5, 55, 1000}, values)
+	assert.Equal(t, []uint64{2, 2, 1}, counts)
+}
+
+func TestReportAggregatorFlushInterval(t *testing.T) {
+	a := newReportAggregator(time.Minute)
+	ts := time.Now()
+	a.observeReport("arn", "success", PlatformMetrics{DurationMs: 10})
+
+	metricsets, err := a.flush(ts, false)
+	require.NoError(t, err)
+	assert.Empty(t, metricsets)
+
+	metricsets, err = a.flush(ts.Add(time.Minute), false)
+	require.NoError(t, err)
+	require.Len(t, metricsets, 1)
+	assert.Equal(t, 1.0, gjson.GetBytes(metricsets[0], "metricset.samples.faas\\.invocations\\.success.value").Float())
+
+	metricsets, err = a.flush(ts.Add(2*time.Minute), false)
+	require.NoError(t, err)
+	assert.Empty(t, metricsets)
+}
+
+func TestProcessLogsMetricsAggregation(t *testing.T) {
+	c, batch := newTestClient(t, WithMetricsAggregation(time.Minute), WithInvocationMetrics(false))
+	for _, reqID := range []string{"req-1", "req-2"} {
+		batch.RegisterInvocation(reqID, "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+	}
+
+	ts := time.Now()
+	for _, event := range []LogEvent{
+		{Time: ts, Type: PlatformStart, Record: LogEventRecord{RequestID: "req-1", Version: "3"}},
+		{Time: ts, Type: PlatformRuntimeDone, Record: LogEventRecord{RequestID: "req-1", Status: "success"}},
+		{Time: ts, Type: PlatformReport, Record: LogEventRecord{RequestID: "req-1", Metrics: PlatformMetrics{
+			DurationMs: 150, BilledDurationMs: 151, MemorySizeMB: 128, MaxMemoryUsedMB: 76,
+		}}},
+		{Time: ts, Type: PlatformStart, Record: LogEventRecord{RequestID: "req-2", Version: "3"}},
+		{Time: ts, Type: PlatformRuntimeDone, Record: LogEventRecord{RequestID: "req-2", Status: "timeout"}},
+		{Time: ts, Type: PlatformReport, Record: LogEventRecord{RequestID: "req-2", Metrics: PlatformMetrics{
+			DurationMs: 3000, BilledDurationMs: 3000, MemorySizeMB: 128, MaxMemoryUsedMB: 100,
+		}}},
+	} {
+		c.logsChannel <- event
+	}
+
+	var forwarded [][]byte
+	c.ProcessLogs(context.Background(), "req-2", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, true)
+
+	require.Len(t, forwarded, 1)
+	ms := gjson.GetBytes(forwarded[0], "metricset")
+	assert.Equal(t, "arn", ms.Get("faas.id").String())
+	assert.Equal(t, "3", ms.Get("tags.faas_version").String())
+	assert.Equal(t, 1.0, ms.Get("samples.faas\\.invocations\\.success.value").Float())
+	assert.Equal(t, 0.0, ms.Get("samples.faas\\.invocations\\.error.value").Float())
+	assert.Equal(t, 1.0, ms.Get("samples.faas\\.invocations\\.timeout.value").Float())
+	assert.JSONEq(t, `{"type":"histogram","unit":"ms","values":[150,3500],"counts":[1,1]}`, ms.Get("samples.faas\\.duration\\.histogram").Raw)
+	assert.JSONEq(t, `{"type":"histogram","unit":"byte","values":[100663296],"counts":[2]}`, ms.Get("samples.system\\.memory\\.used").Raw)
+}
+
+func TestReportAggregatorStatus(t *testing.T) {
+	a := newReportAggregator(time.Minute)
+	for _, status := range []string{"success", "error", "failure", "timeout", "", "unknown"} {
+		a.observeReport("arn", status, PlatformMetrics{DurationMs: 10})
+	}
+
+	metricsets, err := a.flush(time.Now(), true)
+	require.NoError(t, err)
+	require.Len(t, metricsets, 1)
+	ms := gjson.GetBytes(metricsets[0], "metricset")
+	assert.Equal(t, 1.0, ms.Get("samples.faas\\.invocations\\.success.value").Float())
+	assert.Equal(t, 2.0, ms.Get("samples.faas\\.invocations\\.error.value").Float())
+	assert.Equal(t, 1.0, ms.Get("samples.faas\\.invocations\\.timeout.value").Float())
+	assert.JSONEq(t, `{"type":"histogram","unit":"ms","values":[7.5],"counts":[6]}`, ms.Get("samples.faas\\.duration\\.histogram").Raw)
+}
+
+func TestProcessLogsMetricsAggregationWithInvocationMetrics(t *testing.T) {
+	c, batch := newTestClient(t, WithMetricsAggregation(time.Minute), WithInvocationMetrics(true))
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+
+	ts := time.Now()
+	for _, event := range []LogEvent{
+		{Time: ts, Type: PlatformStart, Record: LogEventRecord{RequestID: "req-1"}},
+		{Time: ts, Type: PlatformRuntimeDone, Record: LogEventRecord{RequestID: "req-1", Status: "success"}},
+		{Time: ts, Type: PlatformReport, Record: LogEventRecord{RequestID: "req-1", Metrics: PlatformMetrics{
+			DurationMs: 150, BilledDurationMs: 151, MemorySizeMB: 128, MaxMemoryUsedMB: 76,
+		}}},
+	} {
+		c.logsChannel <- event
+	}
+
+	var forwarded [][]byte
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, true)
+
+	// A sample name must have a single type across the metricsets, or
+	// Elasticsearch rejects the documents with a mapping conflict.
+	require.Len(t, forwarded, 2)
+	types := make(map[string]string)
+	for _, ms := range forwarded {
+		gjson.GetBytes(ms, "metricset.samples").ForEach(func(name, sample gjson.Result) bool {
+			typ := sample.Get("type").String()
+			if prev, ok := types[name.String()]; ok {
+				assert.Equal(t, prev, typ, name.String())
+			}
+			types[name.String()] = typ
+			return true
+		})
+	}
+	assert.Equal(t, "", types["faas.duration"])
+	assert.Equal(t, "histogram", types["faas.duration.histogram"])
+	assert.Equal(t, "histogram", types["faas.billed_duration.histogram"])
+}
+
+func TestFlushDataAggregatedMetricsAtShutdown(t *testing.T) {
+	c, _ := newTestClient(t, WithMetricsAggregation(time.Hour), WithInvocationMetrics(false))
+	c.aggregator.observeReport("arn", "success", PlatformMetrics{DurationMs: 10})
+
+	var forwarded [][]byte
+	c.FlushData(context.Background(), "", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, true)
+
+	require.Len(t, forwarded, 1)
+	assert.Equal(t, 1.0, gjson.GetBytes(forwarded[0], "metricset.samples.faas\\.invocations\\.success.value").Float())
+}
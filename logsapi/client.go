@@ -23,8 +23,12 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
 	"go.uber.org/zap"
 )
 
@@ -48,16 +52,35 @@ type ClientOption func(*Client)
 
 type invocationLifecycler interface {
 	OnLambdaLogRuntimeDone(requestID, status string, time time.Time) error
-	OnPlatformStart(reqID string)
+	OnPlatformStart(reqID string, ts time.Time)
 	OnPlatformReport(reqID string) (fnARN string, deadlineMs int64, ts time.Time, err error)
+	// OnPlatformReportMetrics corrects the invocation finalized at
+	// shutdown, if any, with the status and duration of its report. It
+	// is called before OnPlatformReport for the request ID.
+	OnPlatformReportMetrics(reqID, status string, duration time.Duration) error
+	// OnRuntimeFailure reports an invocation that failed because the
+	// runtime crashed or ran out of memory. It is called before
+	// OnPlatformReport for the request ID.
+	OnRuntimeFailure(reqID string, failure accumulator.RuntimeFailure) error
 	// PlatformStartReqID is to identify the requestID for the function
 	// logs under the assumption that function logs for a specific request
 	// ID will be bounded by PlatformStart and PlatformEnd events.
 	PlatformStartReqID() string
+	// TraceContext returns the trace ID and transaction ID of the
+	// transaction registered for the request ID, if any.
+	TraceContext(reqID string) (traceID, transactionID string)
 	// Size should return the number of invocations waiting on platform.report
 	Size() int
 }
 
+// MetricsCollector collects metrics outside of the Logs API. The metrics
+// are flushed when the runtime of an invocation is done.
+type MetricsCollector interface {
+	// FlushMetrics returns the metricset events collected since the
+	// last flush.
+	FlushMetrics(ts time.Time) ([][]byte, error)
+}
+
 // Client is the client used to subscribe to the Logs API.
 type Client struct {
 	httpClient               *http.Client
@@ -68,6 +91,31 @@ type Client struct {
 	server                   *http.Server
 	logger                   *zap.SugaredLogger
 	invocationLifecycler     invocationLifecycler
+	metricsCollectors        []MetricsCollector
+	forwardEMFLogs           bool
+	multilineEnabled         bool
+	multilineMaxLines        int
+	multilineMaxDuration     time.Duration
+	multilinePatterns        []MultilinePattern
+	multiline                *multilineAggregator
+	minLogLevel              string
+	levelFilter              logLevelFilter
+	logMaxLines              int
+	logMaxBytes              int
+	logMaxErrorLines         int
+	logSampleEvery           int
+	limiter                  *logLimiter
+	telemetryAPIEnabled      bool
+	init                     initTracker
+	extensionInit            initPhase
+	extensionName            string
+	extensions               extensionRegistry
+	runtimeDone              runtimeDoneTracker
+	invocationMetrics        bool
+	aggregationInterval      time.Duration
+	aggregator               *reportAggregator
+	monitor                  *selfmonitor.Monitor
+	recorder                 *recorder.Recorder
 }
 
 // NewClient returns a new Client with the given URL.
@@ -77,15 +125,38 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 			// Fixes "Potential Slowloris Attack because ReadHeaderTimeout is not configured in the http.Server"
 			ReadHeaderTimeout: time.Second * 5,
 		},
-		httpClient: &http.Client{},
+		httpClient:           &http.Client{},
+		forwardEMFLogs:       true,
+		multilineMaxLines:    DefaultMultilineMaxLines,
+		multilineMaxDuration: DefaultMultilineMaxDuration,
+		logMaxErrorLines:     DefaultErrorLogLimit,
+		telemetryAPIEnabled:  true,
+		invocationMetrics:    true,
 	}
 
 	for _, opt := range opts {
 		opt(&c)
 	}
 
+	if c.logMaxLines > 0 || c.logMaxBytes > 0 {
+		c.limiter = &logLimiter{
+			maxLines:      c.logMaxLines,
+			maxBytes:      c.logMaxBytes,
+			maxErrorLines: c.logMaxErrorLines,
+			sampleEvery:   c.logSampleEvery,
+		}
+	}
+
+	if c.aggregationInterval > 0 {
+		c.aggregator = newReportAggregator(c.aggregationInterval)
+	}
+
+	if c.multilineEnabled {
+		c.multiline = newMultilineAggregator(c.multilineMaxLines, c.multilineMaxDuration, c.multilinePatterns)
+	}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", handleLogEventsRequest(c.logger, c.logsChannel))
+	mux.HandleFunc("/", handleLogEventsRequest(c.logger, c.monitor, c.recorder, c.logsChannel))
 
 	c.server.Handler = mux
 
@@ -97,10 +168,19 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 		return nil, errors.New("logger cannot be nil")
 	}
 
+	if c.minLogLevel != "" {
+		severity, ok := logLevelSeverity[strings.ToLower(c.minLogLevel)]
+		if !ok {
+			return nil, fmt.Errorf("unknown minimum log level %q", c.minLogLevel)
+		}
+		c.levelFilter.minSeverity = severity
+	}
+
 	return &c, nil
 }
 
-// StartService starts the HTTP server listening for log events and subscribes to the Logs API.
+// StartService starts the HTTP server listening for log events and subscribes to the
+// Telemetry API, or to the Logs API if the Telemetry API is disabled or not available.
 func (lc *Client) StartService(extensionID string) error {
 	addr, err := lc.startHTTPServer()
 	if err != nil {
@@ -132,11 +212,18 @@ func (lc *Client) StartService(extensionID string) error {
 		return err
 	}
 
+	// The extension is ready to receive events once subscribed.
+	lc.extensionInit.end = time.Now()
+
 	return nil
 }
 
 // Shutdown shutdowns the log service gracefully.
 func (lc *Client) Shutdown() error {
+	if dropped := lc.DroppedLogs(); len(dropped) > 0 {
+		lc.logger.Infof("Function log lines dropped below the minimum log level: %v", dropped)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
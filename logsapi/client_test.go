@@ -124,6 +124,65 @@ func TestSubscribe(t *testing.T) {
 	}
 }
 
+func TestSubscribeTelemetryAPI(t *testing.T) {
+	testCases := map[string]struct {
+		opts              []logsapi.ClientOption
+		telemetryStatus   int
+		expectedRequests  []string
+		expectedSchemaVer logsapi.SchemaVersion
+	}{
+		"telemetry api": {
+			telemetryStatus:   http.StatusOK,
+			expectedRequests:  []string{"/2022-07-01/telemetry"},
+			expectedSchemaVer: logsapi.TelemetrySchemaVersion20221213,
+		},
+		"fallback to logs api": {
+			telemetryStatus:   http.StatusNotFound,
+			expectedRequests:  []string{"/2022-07-01/telemetry", "/2020-08-15/logs"},
+			expectedSchemaVer: logsapi.SchemaVersion20210318,
+		},
+		"telemetry api disabled": {
+			opts:              []logsapi.ClientOption{logsapi.WithTelemetryAPI(false)},
+			telemetryStatus:   http.StatusOK,
+			expectedRequests:  []string{"/2020-08-15/logs"},
+			expectedSchemaVer: logsapi.SchemaVersion20210318,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var (
+				requests  []string
+				schemaVer logsapi.SchemaVersion
+			)
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var subRequest logsapi.SubscribeRequest
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&subRequest))
+				requests = append(requests, r.URL.Path)
+				schemaVer = subRequest.SchemaVersion
+				if r.URL.Path == "/2022-07-01/telemetry" {
+					w.WriteHeader(tc.telemetryStatus)
+				}
+			}))
+			defer s.Close()
+
+			c, err := logsapi.NewClient(
+				append(tc.opts,
+					logsapi.WithListenerAddress("localhost:0"),
+					logsapi.WithLogger(zaptest.NewLogger(t).Sugar()),
+					logsapi.WithLogsAPIBaseURL(s.URL),
+					logsapi.WithSubscriptionTypes(logsapi.Platform),
+				)...,
+			)
+			require.NoError(t, err)
+			require.NoError(t, c.StartService("foo"))
+			require.NoError(t, c.Shutdown())
+
+			assert.Equal(t, tc.expectedRequests, requests)
+			assert.Equal(t, tc.expectedSchemaVer, schemaVer)
+		})
+	}
+}
+
 func TestSubscribeAWSRequest(t *testing.T) {
 	addr := "localhost:8080"
 
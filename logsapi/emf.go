@@ -0,0 +1,169 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"go.elastic.co/fastjson"
+)
+
+// emfRecord is the metadata of a CloudWatch Embedded Metric Format
+// record, as found in the `_aws` member of the log line.
+type emfRecord struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// emfUnits maps the CloudWatch units to the units known by APM Server.
+var emfUnits = map[string]string{
+	"Microseconds": "us",
+	"Milliseconds": "ms",
+	"Seconds":      "s",
+	"Bytes":        "byte",
+	"Percent":      "percent",
+}
+
+// ProcessEMFLog extracts the metrics of a function log line written in the
+// CloudWatch Embedded Metric Format and returns the JSON bodies of the
+// resulting metricsets, one for each dimension set. The returned bool is
+// false if the log line is not an EMF record.
+func ProcessEMFLog(log LogEvent) ([][]byte, bool, error) {
+	line := strings.TrimSpace(log.StringRecord)
+	if !strings.HasPrefix(line, "{") || !strings.Contains(line, `"_aws"`) {
+		return nil, false, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return nil, false, nil
+	}
+	rawRecord, ok := fields["_aws"]
+	if !ok {
+		return nil, false, nil
+	}
+	var record emfRecord
+	if err := json.Unmarshal(rawRecord, &record); err != nil {
+		return nil, true, fmt.Errorf("failed to decode EMF metadata: %w", err)
+	}
+	if len(record.CloudWatchMetrics) == 0 {
+		return nil, true, fmt.Errorf("EMF record has no metric directives")
+	}
+
+	ts := log.Time
+	if record.Timestamp > 0 {
+		ts = time.UnixMilli(record.Timestamp)
+	}
+
+	var metricsets [][]byte
+	for _, directive := range record.CloudWatchMetrics {
+		dimensionSets := directive.Dimensions
+		if len(dimensionSets) == 0 {
+			dimensionSets = [][]string{nil}
+		}
+		for _, dimensions := range dimensionSets {
+			mc := model.MetricsContainer{
+				Metrics: &model.Metrics{
+					Timestamp: model.Time(ts),
+					Labels:    model.Labels{},
+				},
+			}
+			if directive.Namespace != "" {
+				mc.Metrics.Labels.Set("namespace", directive.Namespace)
+			}
+			for _, dimension := range dimensions {
+				if value, ok := emfLabelValue(fields[dimension]); ok {
+					mc.Metrics.Labels.Set(dimension, value)
+				}
+			}
+			for _, metric := range directive.Metrics {
+				addEMFMetric(mc, metric, fields[metric.Name])
+			}
+			if len(mc.Metrics.Samples) == 0 {
+				continue
+			}
+
+			var jsonWriter fastjson.Writer
+			if err := mc.MarshalFastJSON(&jsonWriter); err != nil {
+				return nil, true, err
+			}
+			metricsets = append(metricsets, jsonWriter.Bytes())
+		}
+	}
+	return metricsets, true, nil
+}
+
+// addEMFMetric adds the value of an EMF metric to the metricset. Metrics
+// with a list of values are added as histograms.
+func addEMFMetric(mc model.MetricsContainer, metric emfMetricDefinition, raw json.RawMessage) {
+	if raw == nil {
+		return
+	}
+	var value float64
+	if err := json.Unmarshal(raw, &value); err == nil {
+		mc.AddWithUnit(metric.Name, emfUnits[metric.Unit], value)
+		return
+	}
+	var values []float64
+	if err := json.Unmarshal(raw, &values); err != nil || len(values) == 0 {
+		return
+	}
+	sort.Float64s(values)
+	var (
+		buckets []float64
+		counts  []uint64
+	)
+	for _, v := range values {
+		if n := len(buckets); n > 0 && buckets[n-1] == v {
+			counts[n-1]++
+			continue
+		}
+		buckets = append(buckets, v)
+		counts = append(counts, 1)
+	}
+	mc.AddHistogram(metric.Name, emfUnits[metric.Unit], buckets, counts)
+}
+
+// emfLabelValue returns the value of a dimension if it can be used
+// as a label value.
+func emfLabelValue(raw json.RawMessage) (interface{}, bool) {
+	if raw == nil {
+		return nil, false
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, false
+	}
+	return value, isLabelValue(value)
+}
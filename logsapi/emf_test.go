@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const emfLogLine = `{"_aws":{"Timestamp":1668211200000,"CloudWatchMetrics":[{"Namespace":"orders","Dimensions":[["service"],["service","region"]],"Metrics":[{"Name":"latency","Unit":"Milliseconds"},{"Name":"count","Unit":"Count"},{"Name":"size","Unit":"Bytes"}]}]},"service":"checkout","region":"eu-west-1","latency":[5,3,5],"count":2,"size":512}`
+
+func TestProcessEMFLog(t *testing.T) {
+	event := LogEvent{
+		Time:         time.Date(2022, 11, 13, 0, 0, 0, 0, time.UTC),
+		Type:         FunctionLog,
+		StringRecord: emfLogLine + "\n",
+	}
+
+	metricsets, ok, err := ProcessEMFLog(event)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, metricsets, 2)
+
+	samples := `"samples":{"count":{"value":2},"size":{"value":512,"unit":"byte"},"latency":{"values":[3,5],"counts":[1,2],"type":"histogram","unit":"ms"}}`
+	assert.JSONEq(t,
+		`{"metricset":{"timestamp":1668211200000000,`+samples+`,"tags":{"namespace":"orders","service":"checkout"}}}`,
+		string(metricsets[0]),
+	)
+	assert.JSONEq(t,
+		`{"metricset":{"timestamp":1668211200000000,`+samples+`,"tags":{"namespace":"orders","region":"eu-west-1","service":"checkout"}}}`,
+		string(metricsets[1]),
+	)
+}
+
+func TestProcessEMFLogNotEMF(t *testing.T) {
+	for name, line := range map[string]string{
+		"text":        "START RequestId: 8476a536",
+		"json":        `{"message":"hello"}`,
+		"invalid":     `{"_aws":`,
+		"unquoted":    `{"level":"info","msg":"_aws"}`,
+		"not object":  `["_aws"]`,
+		"empty line":  "",
+		"nested json": `{"payload":{"_aws":{}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			metricsets, ok, err := ProcessEMFLog(LogEvent{Type: FunctionLog, StringRecord: line})
+			require.NoError(t, err)
+			assert.False(t, ok)
+			assert.Empty(t, metricsets)
+		})
+	}
+}
+
+func TestProcessEMFLogInvalidMetadata(t *testing.T) {
+	_, ok, err := ProcessEMFLog(LogEvent{
+		Type:         FunctionLog,
+		StringRecord: `{"_aws":{"CloudWatchMetrics":"orders"}}`,
+	})
+	assert.True(t, ok)
+	assert.Error(t, err)
+}
+
+func TestProcessLogsEMFForwarding(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts          []ClientOption
+		expectedCount int
+	}{
+		"default": {
+			expectedCount: 3,
+		},
+		"without log forwarding": {
+			opts:          []ClientOption{WithEMFLogForwarding(false)},
+			expectedCount: 2,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, _ := newTestClient(t, tc.opts...)
+			c.logsChannel <- LogEvent{
+				Time:         time.Now(),
+				Type:         FunctionLog,
+				StringRecord: emfLogLine,
+			}
+
+			var forwarded []string
+			c.FlushData(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+				forwarded = append(forwarded, string(b))
+				return nil
+			}, false)
+
+			require.Len(t, forwarded, tc.expectedCount)
+			assert.Contains(t, forwarded[0], `"metricset"`)
+			assert.Contains(t, forwarded[1], `"metricset"`)
+			if tc.expectedCount == 3 {
+				assert.Contains(t, forwarded[2], `"log"`)
+			}
+		})
+	}
+}
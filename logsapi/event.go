@@ -35,7 +35,18 @@ const (
 	PlatformLogsDropped LogEventType = "platform.logsDropped"
 	PlatformStart       LogEventType = "platform.start"
 	PlatformEnd         LogEventType = "platform.end"
+	PlatformExtension   LogEventType = "platform.extension"
 	FunctionLog         LogEventType = "function"
+	ExtensionLog        LogEventType = "extension"
+
+	// Events only sent by the Telemetry API.
+	PlatformInitStart             LogEventType = "platform.initStart"
+	PlatformInitRuntimeDone       LogEventType = "platform.initRuntimeDone"
+	PlatformInitReport            LogEventType = "platform.initReport"
+	PlatformRestoreStart          LogEventType = "platform.restoreStart"
+	PlatformRestoreRuntimeDone    LogEventType = "platform.restoreRuntimeDone"
+	PlatformRestoreReport         LogEventType = "platform.restoreReport"
+	PlatformTelemetrySubscription LogEventType = "platform.telemetrySubscription"
 )
 
 // LogEvent represents an event received from the Logs API
@@ -46,11 +57,54 @@ type LogEvent struct {
 	Record       LogEventRecord
 }
 
-// LogEventRecord is a sub-object in a Logs API event
+// LogEventRecord is a sub-object in a Logs API or Telemetry API event
 type LogEventRecord struct {
 	RequestID string          `json:"requestId"`
 	Status    string          `json:"status"`
 	Metrics   PlatformMetrics `json:"metrics"`
+	// ErrorType is set by the Telemetry API for failed invocations and
+	// initializations.
+	ErrorType string `json:"errorType,omitempty"`
+	// Version is the function version of platform.start events.
+	Version string `json:"version,omitempty"`
+	// Tracing is the X-Ray trace context of the invocation, sent by the
+	// Telemetry API.
+	Tracing *TracingRecord `json:"tracing,omitempty"`
+	// Spans are the phases of the invocation, such as responseLatency,
+	// sent by the Telemetry API with platform.runtimeDone events.
+	Spans []SpanRecord `json:"spans,omitempty"`
+
+	// Fields of the Telemetry API initialization and restore events.
+	InitializationType string `json:"initializationType,omitempty"`
+	Phase              string `json:"phase,omitempty"`
+	RuntimeVersion     string `json:"runtimeVersion,omitempty"`
+	RuntimeVersionArn  string `json:"runtimeVersionArn,omitempty"`
+	FunctionName       string `json:"functionName,omitempty"`
+	FunctionVersion    string `json:"functionVersion,omitempty"`
+
+	// Fields of platform.extension events.
+	Name   string   `json:"name,omitempty"`
+	State  string   `json:"state,omitempty"`
+	Events []string `json:"events,omitempty"`
+
+	// Fields of platform.logsDropped events.
+	Reason         string `json:"reason,omitempty"`
+	DroppedRecords int64  `json:"droppedRecords,omitempty"`
+	DroppedBytes   int64  `json:"droppedBytes,omitempty"`
+}
+
+// TracingRecord is the trace context of a Telemetry API event.
+type TracingRecord struct {
+	SpanID string `json:"spanId,omitempty"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+}
+
+// SpanRecord is a phase of an invocation reported by the Telemetry API.
+type SpanRecord struct {
+	Name       string    `json:"name"`
+	Start      time.Time `json:"start"`
+	DurationMs float64   `json:"durationMs"`
 }
 
 // ProcessLogs consumes log events until there are no more log events that
@@ -65,12 +119,17 @@ func (lc *Client) ProcessLogs(
 	forwardFn Forwarder,
 	isShutdown bool,
 ) {
+	if isShutdown {
+		defer lc.flushAggregatedMetrics(ctx, time.Now(), true, forwardFn)
+	}
 	for {
 		select {
 		case logEvent := <-lc.logsChannel:
 			if shouldExit := lc.handleEvent(ctx, logEvent, requestID, invokedFnArn, forwardFn, isShutdown); shouldExit {
 				return
 			}
+		case <-lc.multilineTimeout():
+			lc.flushMultiline(ctx, invokedFnArn, forwardFn)
 		case <-ctx.Done():
 			lc.logger.Debug("Current invocation over. Interrupting logs processing goroutine")
 			return
@@ -86,6 +145,9 @@ func (lc *Client) FlushData(
 	isShutdown bool,
 ) {
 	lc.logger.Infof("flushing %d buffered logs", len(lc.logsChannel))
+	if isShutdown {
+		defer lc.flushAggregatedMetrics(ctx, time.Now(), true, forwardFn)
+	}
 	for {
 		select {
 		case logEvent := <-lc.logsChannel:
@@ -97,6 +159,7 @@ func (lc *Client) FlushData(
 			return
 		default:
 			if len(lc.logsChannel) == 0 {
+				lc.flushMultiline(ctx, invokedFnArn, forwardFn)
 				lc.logger.Debug("Flush ended for logs - no data in buffer")
 				return
 			}
@@ -114,7 +177,10 @@ func (lc *Client) handleEvent(ctx context.Context,
 	lc.logger.Debugf("Received log event %v for request ID %s", logEvent.Type, logEvent.Record.RequestID)
 	switch logEvent.Type {
 	case PlatformStart:
-		lc.invocationLifecycler.OnPlatformStart(logEvent.Record.RequestID)
+		lc.invocationLifecycler.OnPlatformStart(logEvent.Record.RequestID, logEvent.Time)
+		if lc.aggregator != nil && logEvent.Record.Version != "" {
+			lc.aggregator.setVersion(logEvent.Record.Version)
+		}
 	case PlatformRuntimeDone:
 		if err := lc.invocationLifecycler.OnLambdaLogRuntimeDone(
 			logEvent.Record.RequestID,
@@ -123,6 +189,12 @@ func (lc *Client) handleEvent(ctx context.Context,
 		); err != nil {
 			lc.logger.Warnf("Failed to finalize invocation with request ID %s: %v", logEvent.Record.RequestID, err)
 		}
+		lc.runtimeDone.add(logEvent.Record)
+		lc.flushInitTransaction(ctx, logEvent, forwardFn)
+		lc.flushMultiline(ctx, invokedFnArn, forwardFn)
+		lc.flushLogLimits(ctx, logEvent.Record.RequestID, invokedFnArn, logEvent.Time, forwardFn)
+		lc.flushMetrics(ctx, logEvent.Time, forwardFn)
+		lc.flushAggregatedMetrics(ctx, logEvent.Time, false, forwardFn)
 		// For invocation events the platform.runtimeDone would be the last possible event.
 		if !isShutdown && logEvent.Record.RequestID == requestID {
 			lc.logger.Debugf(
@@ -132,20 +204,43 @@ func (lc *Client) handleEvent(ctx context.Context,
 			return true
 		}
 	case PlatformReport:
+		if record, ok := lc.runtimeDone.take(logEvent.Record.RequestID); ok {
+			logEvent.Record.Metrics.addRuntimeDone(record)
+			if logEvent.Record.Status == "" {
+				logEvent.Record.Status, logEvent.Record.ErrorType = record.Status, record.ErrorType
+			}
+		}
+		if err := lc.invocationLifecycler.OnPlatformReportMetrics(
+			logEvent.Record.RequestID,
+			logEvent.Record.Status,
+			time.Duration(float64(logEvent.Record.Metrics.DurationMs)*float64(time.Millisecond)),
+		); err != nil {
+			lc.logger.Warnf("Failed to correct invocation with request ID %s: %v", logEvent.Record.RequestID, err)
+		}
+		lc.handleRuntimeFailure(logEvent)
+		lc.init.onReport(logEvent)
+		lc.flushInitTransaction(ctx, logEvent, forwardFn)
 		fnARN, deadlineMs, ts, err := lc.invocationLifecycler.OnPlatformReport(logEvent.Record.RequestID)
 		if err != nil {
 			lc.logger.Warnf("Failed to process platform report: %v", err)
 		} else {
 			lc.logger.Debugf("Received platform report for %s", logEvent.Record.RequestID)
-			processedMetrics, err := ProcessPlatformReport(fnARN, deadlineMs, ts, logEvent)
-			if err != nil {
-				lc.logger.Errorf("Error processing Lambda platform metrics: %v", err)
-			} else {
-				if err := forwardFn(ctx, processedMetrics); err != nil {
-					lc.logger.Errorf("Error forwarding Lambda platform metrics: %v", err)
+			if lc.aggregator != nil {
+				lc.aggregator.observeReport(fnARN, logEvent.Record.Status, logEvent.Record.Metrics)
+			}
+			if lc.invocationMetrics {
+				coldstart := logEvent.Record.Metrics.InitDurationMs > 0 && lc.init.initializationType() != ProvisionedConcurrency
+				processedMetrics, err := processPlatformReport(fnARN, deadlineMs, ts, logEvent, coldstart)
+				if err != nil {
+					lc.logger.Errorf("Error processing Lambda platform metrics: %v", err)
+				} else {
+					if err := forwardFn(ctx, processedMetrics); err != nil {
+						lc.logger.Errorf("Error forwarding Lambda platform metrics: %v", err)
+					}
 				}
 			}
 		}
+		lc.flushAggregatedMetrics(ctx, logEvent.Time, false, forwardFn)
 		// For shutdown event the platform report metrics for the previous log event
 		// would be the last possible log event. After processing this metric the
 		// invocation lifecycler's cache should be empty.
@@ -156,21 +251,69 @@ func (lc *Client) handleEvent(ctx context.Context,
 			)
 			return true
 		}
+	case PlatformInitStart, PlatformInitRuntimeDone, PlatformInitReport,
+		PlatformRestoreStart, PlatformRestoreRuntimeDone, PlatformRestoreReport:
+		lc.logger.Debugf("Received %s event for %s initialization: %+v", logEvent.Type, logEvent.Record.InitializationType, logEvent.Record)
+		lc.init.onEvent(logEvent)
+	case PlatformExtension:
+		if name := logEvent.Record.Name; name != "" && name != lc.extensionName {
+			lc.extensions.register(name)
+		}
+	case PlatformFault:
+		lc.logger.Warnf("Received platform fault: %s", logEvent.StringRecord)
+		lc.handlePlatformFault(ctx, logEvent, requestID, invokedFnArn, forwardFn)
 	case PlatformLogsDropped:
 		lc.logger.Warnf("Logs dropped due to extension falling behind: %v", logEvent.Record)
+		lc.handleLogsDropped(ctx, logEvent, invokedFnArn, forwardFn)
 	case FunctionLog:
-		processedLog, err := ProcessFunctionLog(
-			lc.invocationLifecycler.PlatformStartReqID(),
-			invokedFnArn,
-			logEvent,
-		)
+		if lc.multiline == nil {
+			lc.handleFunctionLog(ctx, logEvent, invokedFnArn, forwardFn)
+			break
+		}
+		for _, event := range lc.multiline.add(logEvent) {
+			lc.handleFunctionLog(ctx, event, invokedFnArn, forwardFn)
+		}
+	case ExtensionLog:
+		lc.handleExtensionLog(ctx, logEvent, invokedFnArn, forwardFn)
+	}
+	return false
+}
+
+// flushMetrics forwards the metrics of all the configured collectors.
+func (lc *Client) flushMetrics(ctx context.Context, ts time.Time, forwardFn Forwarder) {
+	for _, mc := range lc.metricsCollectors {
+		metricsets, err := mc.FlushMetrics(ts)
 		if err != nil {
-			lc.logger.Warnf("Error processing function log : %v", err)
-		} else {
-			if err := forwardFn(ctx, processedLog); err != nil {
-				lc.logger.Warnf("Error forwarding function log : %v", err)
+			lc.logger.Errorf("Error processing collected metrics: %v", err)
+			continue
+		}
+		for _, ms := range metricsets {
+			if err := forwardFn(ctx, ms); err != nil {
+				lc.logger.Errorf("Error forwarding collected metrics: %v", err)
 			}
 		}
 	}
-	return false
+}
+
+// multilineTimeout returns a channel receiving once the pending group
+// of function log lines is due, or nil if no group is pending.
+func (lc *Client) multilineTimeout() <-chan time.Time {
+	if lc.multiline == nil {
+		return nil
+	}
+	d, ok := lc.multiline.timeout(time.Now())
+	if !ok {
+		return nil
+	}
+	return time.After(d)
+}
+
+// flushMultiline forwards the function log lines still being grouped.
+func (lc *Client) flushMultiline(ctx context.Context, invokedFnArn string, forwardFn Forwarder) {
+	if lc.multiline == nil {
+		return
+	}
+	for _, event := range lc.multiline.flush() {
+		lc.handleFunctionLog(ctx, event, invokedFnArn, forwardFn)
+	}
 }
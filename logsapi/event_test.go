@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+type testMetricsCollector struct {
+	flushed []time.Time
+}
+
+func (c *testMetricsCollector) FlushMetrics(ts time.Time) ([][]byte, error) {
+	c.flushed = append(c.flushed, ts)
+	return [][]byte{[]byte(`{"metricset":{}}`)}, nil
+}
+
+func newTestLogger(t *testing.T) *zap.SugaredLogger {
+	return zaptest.NewLogger(t).Sugar()
+}
+
+func newTestClient(t *testing.T, opts ...ClientOption) (*Client, *accumulator.Batch) {
+	t.Helper()
+	batch := accumulator.NewBatch(100, time.Minute)
+	opts = append([]ClientOption{
+		WithLogsAPIBaseURL("http://example.com"),
+		WithLogBuffer(10),
+		WithLogger(newTestLogger(t)),
+		WithInvocationLifecycler(batch),
+	}, opts...)
+	c, err := NewClient(opts...)
+	require.NoError(t, err)
+	return c, batch
+}
+
+func TestProcessLogsFlushesCollectedMetrics(t *testing.T) {
+	collector := &testMetricsCollector{}
+	c, batch := newTestClient(t, WithMetricsCollector(collector))
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+
+	ts := time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC)
+	c.logsChannel <- LogEvent{
+		Time:   ts,
+		Type:   PlatformRuntimeDone,
+		Record: LogEventRecord{RequestID: "req-1", Status: "success"},
+	}
+
+	var forwarded [][]byte
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, false)
+
+	assert.Equal(t, []time.Time{ts}, collector.flushed)
+	assert.Equal(t, [][]byte{[]byte(`{"metricset":{}}`)}, forwarded)
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
+)
+
+// extensionNameLabel is the label holding the name of the extension that
+// wrote an extension log line.
+const extensionNameLabel = "extension_name"
+
+// extensionLogPrefix matches the bracketed name many extensions prefix
+// their log lines with, such as `[AWS Parameters and Secrets Lambda Extension]`.
+var extensionLogPrefix = regexp.MustCompile(`^\s*\[([^\]]+)\]`)
+
+// extensionRegistry holds the names of the other extensions registered in
+// the execution environment, as reported by platform.extension events.
+type extensionRegistry struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *extensionRegistry) register(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, n := range r.names {
+		if n == name {
+			return
+		}
+	}
+	r.names = append(r.names, name)
+}
+
+func (r *extensionRegistry) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.names...)
+}
+
+// extensionLogName returns the name of the extension that wrote the log
+// line. Log lines are matched against the registered extension names
+// first, then against a bracketed prefix other than a log level. If a
+// single other extension is registered, the log line is attributed to it.
+func extensionLogName(record, logger string, known []string) string {
+	trimmed := strings.TrimLeft(record, "[ ")
+	for _, name := range known {
+		if logger == name || strings.HasPrefix(trimmed, name) {
+			return name
+		}
+	}
+	if m := extensionLogPrefix.FindStringSubmatch(record); m != nil {
+		// Bracketed log levels, such as [ERROR], are not extension names.
+		if _, ok := logLevelSeverity[strings.ToLower(m[1])]; !ok {
+			return m[1]
+		}
+	}
+	if len(known) == 1 {
+		return known[0]
+	}
+	return ""
+}
+
+// handleExtensionLog forwards the log line of another extension, tagged
+// with the name of the extension and correlated with the current
+// invocation. The log lines written by this extension are skipped.
+func (lc *Client) handleExtensionLog(ctx context.Context, logEvent LogEvent, invokedFnArn string, forwardFn Forwarder) {
+	requestID := lc.invocationLifecycler.PlatformStartReqID()
+	traceID, transactionID := lc.invocationLifecycler.TraceContext(requestID)
+	log := newFunctionLog(
+		requestID,
+		invokedFnArn,
+		traceID,
+		transactionID,
+		logEvent,
+	)
+	if lc.extensionName != "" && log.Log.Logger == lc.extensionName {
+		return
+	}
+	if !lc.levelFilter.allow(log.Log.Level) {
+		lc.monitor.Inc(selfmonitor.LogEventsFiltered)
+		return
+	}
+	if name := extensionLogName(logEvent.StringRecord, log.Log.Logger, lc.extensions.list()); name != "" {
+		if log.Log.Labels == nil {
+			log.Log.Labels = model.Labels{}
+		}
+		log.Log.Labels.Set(extensionNameLabel, name)
+	}
+	processedLog, err := marshalLog(log)
+	if err != nil {
+		lc.logger.Warnf("Error processing extension log : %v", err)
+		return
+	}
+	if err := forwardFn(ctx, processedLog); err != nil {
+		lc.logger.Warnf("Error forwarding extension log : %v", err)
+	}
+}
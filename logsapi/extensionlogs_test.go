@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestExtensionLogName(t *testing.T) {
+	testCases := map[string]struct {
+		record   string
+		logger   string
+		known    []string
+		expected string
+	}{
+		"registered name prefix": {
+			record:   "secrets-cache: cache refreshed",
+			known:    []string{"security-agent", "secrets-cache"},
+			expected: "secrets-cache",
+		},
+		"registered logger": {
+			record:   `{"logger":"security-agent","msg":"scan done"}`,
+			logger:   "security-agent",
+			known:    []string{"secrets-cache", "security-agent"},
+			expected: "security-agent",
+		},
+		"bracketed prefix": {
+			record:   "[AWS Parameters and Secrets Lambda Extension] 2022/10/12 INFO ready to serve traffic",
+			known:    []string{"secrets-cache", "security-agent"},
+			expected: "AWS Parameters and Secrets Lambda Extension",
+		},
+		"bracketed log level": {
+			record:   "[ERROR] failed",
+			known:    []string{"secrets-cache"},
+			expected: "secrets-cache",
+		},
+		"single registered extension": {
+			record:   "ready",
+			known:    []string{"secrets-cache"},
+			expected: "secrets-cache",
+		},
+		"unknown": {
+			record: "ready",
+			known:  []string{"secrets-cache", "security-agent"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, extensionLogName(tc.record, tc.logger, tc.known))
+		})
+	}
+}
+
+func TestProcessLogsExtensionLogs(t *testing.T) {
+	c, batch := newTestClient(t, WithExtensionName("apm-lambda-extension"))
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+
+	ts := time.Now()
+	for _, event := range []LogEvent{
+		{Time: ts, Type: PlatformExtension, Record: LogEventRecord{Name: "apm-lambda-extension", State: "Ready"}},
+		{Time: ts, Type: PlatformExtension, Record: LogEventRecord{Name: "secrets-cache", State: "Ready"}},
+		{Time: ts, Type: PlatformStart, Record: LogEventRecord{RequestID: "req-1"}},
+		{Time: ts, Type: ExtensionLog, StringRecord: `{"log.level":"info","log.logger":"apm-lambda-extension","message":"flushing"}`},
+		{Time: ts, Type: ExtensionLog, StringRecord: "[ERROR] failed to refresh secret"},
+		{Time: ts, Type: PlatformRuntimeDone, Record: LogEventRecord{RequestID: "req-1", Status: "success"}},
+	} {
+		c.logsChannel <- event
+	}
+
+	var forwarded [][]byte
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, false)
+
+	require.Len(t, forwarded, 1)
+	assert.Equal(t, "[ERROR] failed to refresh secret", gjson.GetBytes(forwarded[0], "log.message").String())
+	assert.Equal(t, "error", gjson.GetBytes(forwarded[0], "log.log\\.level").String())
+	assert.Equal(t, "secrets-cache", gjson.GetBytes(forwarded[0], "log.labels.extension_name").String())
+	assert.Equal(t, "req-1", gjson.GetBytes(forwarded[0], "log.faas.execution").String())
+}
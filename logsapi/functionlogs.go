@@ -18,30 +18,70 @@
 package logsapi
 
 import (
+	"context"
+
 	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
 	"go.elastic.co/fastjson"
 )
 
 // ProcessFunctionLog processes the `function` log line from lambda logs API and returns
 // a byte array containing the JSON body for the extracted log along with the timestamp.
+// The well known fields of structured JSON log lines are mapped onto the log event.
 // A non nil error is returned when marshaling of the log into JSON fails.
 func ProcessFunctionLog(
 	requestID string,
 	invokedFnArn string,
 	log LogEvent,
 ) ([]byte, error) {
+	return ProcessFunctionLogWithTraceContext(requestID, invokedFnArn, "", "", log)
+}
+
+// ProcessFunctionLogWithTraceContext is like ProcessFunctionLog, but the log
+// is correlated with the given trace and transaction IDs unless the log line
+// carries its own trace context.
+func ProcessFunctionLogWithTraceContext(
+	requestID string,
+	invokedFnArn string,
+	traceID string,
+	transactionID string,
+	log LogEvent,
+) ([]byte, error) {
+	return marshalLog(newFunctionLog(requestID, invokedFnArn, traceID, transactionID, log))
+}
+
+func newFunctionLog(
+	requestID string,
+	invokedFnArn string,
+	traceID string,
+	transactionID string,
+	log LogEvent,
+) model.LogContainer {
 	lc := model.LogContainer{
 		Log: &model.LogLine{
 			Timestamp: model.Time(log.Time),
 			Message:   log.StringRecord,
+			Original:  log.StringRecord,
 		},
 	}
 
+	parseJSONLog(log.StringRecord, lc.Log)
+	if lc.Log.Level == "" {
+		lc.Log.Level = detectLogLevel(log.StringRecord)
+	}
+	if lc.Log.TraceID == "" {
+		lc.Log.TraceID = traceID
+		lc.Log.TransactionID = transactionID
+	}
+
 	lc.Log.FAAS = &model.FAAS{
 		ID:        invokedFnArn,
 		Execution: requestID,
 	}
+	return lc
+}
 
+func marshalLog(lc model.LogContainer) ([]byte, error) {
 	var jsonWriter fastjson.Writer
 	if err := lc.MarshalFastJSON(&jsonWriter); err != nil {
 		return nil, err
@@ -49,3 +89,48 @@ func ProcessFunctionLog(
 
 	return jsonWriter.Bytes(), nil
 }
+
+// handleFunctionLog forwards the metricsets extracted from EMF records and
+// the function log line itself, unless its level is below the minimum level
+// or the log limits of the invocation are reached.
+func (lc *Client) handleFunctionLog(ctx context.Context, logEvent LogEvent, invokedFnArn string, forwardFn Forwarder) {
+	metricsets, isEMF, err := ProcessEMFLog(logEvent)
+	if err != nil {
+		lc.logger.Warnf("Error processing EMF function log : %v", err)
+	}
+	for _, ms := range metricsets {
+		if err := forwardFn(ctx, ms); err != nil {
+			lc.logger.Warnf("Error forwarding EMF metrics : %v", err)
+		}
+	}
+	if isEMF && err == nil && !lc.forwardEMFLogs {
+		return
+	}
+
+	requestID := lc.invocationLifecycler.PlatformStartReqID()
+	traceID, transactionID := lc.invocationLifecycler.TraceContext(requestID)
+	log := newFunctionLog(
+		requestID,
+		invokedFnArn,
+		traceID,
+		transactionID,
+		logEvent,
+	)
+	if !lc.levelFilter.allow(log.Log.Level) {
+		lc.monitor.Inc(selfmonitor.LogEventsFiltered)
+		lc.monitor.Inc(selfmonitor.LogEventsFilteredPrefix + log.Log.Level)
+		return
+	}
+	processedLog, err := marshalLog(log)
+	if err != nil {
+		lc.logger.Warnf("Error processing function log : %v", err)
+		return
+	}
+	if lc.limiter != nil && !lc.limiter.allow(log.Log.Level, len(processedLog)) {
+		lc.monitor.Inc(selfmonitor.LogEventsLimited)
+		return
+	}
+	if err := forwardFn(ctx, processedLog); err != nil {
+		lc.logger.Warnf("Error forwarding function log : %v", err)
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 )
 
 func TestProcessFunctionLog(t *testing.T) {
@@ -35,9 +36,10 @@ func TestProcessFunctionLog(t *testing.T) {
 	reqID := "8476a536-e9f4-11e8-9739-2dfe598c3fcd"
 	invokedFnArn := "arn:aws:lambda:us-east-2:123456789012:function:custom-runtime"
 	expectedData := fmt.Sprintf(
-		"{\"log\":{\"@timestamp\":%d,\"message\":%q,\"faas\":{\"execution\":%q,\"id\":%q}}}",
+		"{\"log\":{\"@timestamp\":%d,\"message\":%q,\"event.original\":%q,\"faas\":{\"execution\":%q,\"id\":%q},\"log.level\":\"error\"}}",
 		event.Time.UnixNano()/int64(time.Microsecond),
 		event.StringRecord,
+		event.StringRecord,
 		reqID,
 		invokedFnArn,
 	)
@@ -47,3 +49,61 @@ func TestProcessFunctionLog(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, expectedData, string(data))
 }
+
+func TestProcessFunctionLogJSON(t *testing.T) {
+	event := LogEvent{
+		Time:         time.Date(2022, 11, 12, 0, 0, 0, 0, time.UTC),
+		Type:         FunctionLog,
+		StringRecord: `{"level":"error","message":"failed","error":{"type":"ValueError"}}`,
+	}
+	expectedData := fmt.Sprintf(
+		"{\"log\":{\"@timestamp\":%d,\"message\":\"failed\",\"error.type\":\"ValueError\",\"event.original\":%q,\"faas\":{\"execution\":\"req\",\"id\":\"arn\"},\"log.level\":\"error\"}}",
+		event.Time.UnixNano()/int64(time.Microsecond),
+		event.StringRecord,
+	)
+
+	data, err := ProcessFunctionLog("req", "arn", event)
+
+	require.NoError(t, err)
+	assert.Equal(t, expectedData, string(data))
+}
+
+func TestProcessFunctionLogTraceContext(t *testing.T) {
+	testCases := map[string]struct {
+		record                string
+		expectedTraceID       string
+		expectedTransactionID string
+		expectedSpanID        string
+	}{
+		"plain text": {
+			record:                "processing order",
+			expectedTraceID:       "registered-trace",
+			expectedTransactionID: "registered-transaction",
+		},
+		"ecs trace id": {
+			record:          `{"message":"processing order","trace.id":"logged-trace"}`,
+			expectedTraceID: "logged-trace",
+		},
+		"traceparent": {
+			record:          `{"message":"processing order","traceparent":"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}`,
+			expectedTraceID: "0af7651916cd43dd8448eb211c80319c",
+			expectedSpanID:  "b7ad6b7169203331",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			event := LogEvent{
+				Time:         time.Date(2022, 11, 12, 0, 0, 0, 0, time.UTC),
+				Type:         FunctionLog,
+				StringRecord: tc.record,
+			}
+
+			data, err := ProcessFunctionLogWithTraceContext("req", "arn", "registered-trace", "registered-transaction", event)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedTraceID, gjson.GetBytes(data, "log.trace\\.id").String())
+			assert.Equal(t, tc.expectedTransactionID, gjson.GetBytes(data, "log.transaction\\.id").String())
+			assert.Equal(t, tc.expectedSpanID, gjson.GetBytes(data, "log.span\\.id").String())
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"github.com/elastic/apm-aws-lambda/xray"
+	"go.elastic.co/fastjson"
+)
+
+// ProvisionedConcurrency is the initialization type of execution
+// environments initialized ahead of invocations.
+const ProvisionedConcurrency = "provisioned-concurrency"
+
+// initPhase is a phase of the initialization of the execution
+// environment, as reported by the Telemetry API.
+type initPhase struct {
+	start, end time.Time
+}
+
+func (p initPhase) complete() bool {
+	return !p.start.IsZero() && !p.end.IsZero() && !p.end.Before(p.start)
+}
+
+// initData holds the initialization phases of the execution
+// environment.
+type initData struct {
+	initializationType string
+	functionName       string
+	runtimeVersion     string
+	status             string
+	durationMs         float64
+	runtime            initPhase
+	restore            initPhase
+}
+
+// initTracker collects the Telemetry API initialization events until the
+// first invocation is done.
+type initTracker struct {
+	mu      sync.Mutex
+	pending bool
+	// received is true once an initialization was reported, either by
+	// the Telemetry API or by the first platform.report.
+	received bool
+	data     initData
+}
+
+func (t *initTracker) onEvent(event LogEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.received = true
+	record := event.Record
+	switch event.Type {
+	case PlatformInitStart:
+		t.pending = true
+		t.data = initData{
+			initializationType: record.InitializationType,
+			functionName:       record.FunctionName,
+			runtimeVersion:     record.RuntimeVersion,
+			runtime:            initPhase{start: event.Time},
+		}
+	case PlatformInitRuntimeDone:
+		t.data.runtime.end = event.Time
+		t.data.status = record.Status
+	case PlatformInitReport:
+		t.data.durationMs = float64(record.Metrics.DurationMs)
+		if record.Status != "" {
+			t.data.status = record.Status
+		}
+	case PlatformRestoreStart:
+		t.pending = true
+		t.data.initializationType = record.InitializationType
+		t.data.restore = initPhase{start: event.Time}
+	case PlatformRestoreRuntimeDone:
+		t.data.restore.end = event.Time
+		t.data.status = record.Status
+	}
+}
+
+// onReport derives the initialization from the init duration of the
+// platform.report of the first invocation if no initialization event was
+// received, as is the case with the Logs API. The initialization is
+// assumed to end when the invocation starts.
+func (t *initTracker) onReport(event LogEvent) {
+	metrics := event.Record.Metrics
+	if metrics.InitDurationMs <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.received {
+		return
+	}
+	t.received = true
+	t.pending = true
+	end := event.Time.Add(-time.Duration(float64(metrics.DurationMs) * float64(time.Millisecond)))
+	t.data = initData{
+		durationMs: float64(metrics.InitDurationMs),
+		runtime: initPhase{
+			start: end.Add(-time.Duration(float64(metrics.InitDurationMs) * float64(time.Millisecond))),
+			end:   end,
+		},
+	}
+}
+
+// initializationType returns the initialization type of the execution
+// environment, if reported by the Telemetry API.
+func (t *initTracker) initializationType() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.data.initializationType
+}
+
+// take returns the collected initialization phases. The returned bool is
+// false if there is no initialization left to report.
+func (t *initTracker) take() (initData, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.pending {
+		return initData{}, false
+	}
+	t.pending = false
+	return t.data, true
+}
+
+// flushInitTransaction forwards a transaction describing the
+// initialization of the execution environment, once the first
+// invocation is done or reported. The transaction is linked to the trace
+// of the invocation.
+func (lc *Client) flushInitTransaction(ctx context.Context, event LogEvent, forwardFn Forwarder) {
+	init, ok := lc.init.take()
+	if !ok {
+		return
+	}
+	var link *model.Link
+	if traceID, txnID := lc.invocationLifecycler.TraceContext(event.Record.RequestID); traceID != "" {
+		link = &model.Link{TraceID: traceID, SpanID: txnID}
+	} else if tracing := event.Record.Tracing; tracing != nil {
+		if header, err := xray.ParseTraceHeader(tracing.Value); err == nil {
+			if traceID, err := header.TraceID(); err == nil {
+				link = &model.Link{TraceID: traceID, SpanID: header.Parent}
+			}
+		}
+	}
+
+	events, err := buildInitTransaction(init, lc.extensionInit, link)
+	if err != nil {
+		lc.logger.Errorf("Error processing init transaction: %v", err)
+		return
+	}
+	for _, event := range events {
+		if err := forwardFn(ctx, event); err != nil {
+			lc.logger.Errorf("Error forwarding init transaction: %v", err)
+		}
+	}
+}
+
+// buildInitTransaction returns the intake v2 transaction and spans of the
+// initialization phases.
+func buildInitTransaction(init initData, extensionInit initPhase, link *model.Link) ([][]byte, error) {
+	start := init.runtime.start
+	if start.IsZero() {
+		start = init.restore.start
+	}
+	txn := &model.Transaction{
+		ID:        model.NewID(8),
+		TraceID:   model.NewID(16),
+		Name:      "init",
+		Type:      "faas.init",
+		Timestamp: model.Time(start),
+		Duration:  init.durationMs,
+		Result:    init.status,
+		Outcome:   "success",
+		Context: &model.Context{
+			Labels: model.Labels{
+				"faas_initialization_type": init.initializationType,
+				"faas_coldstart":           init.initializationType != ProvisionedConcurrency,
+			},
+		},
+	}
+	if init.status != "" && init.status != "success" {
+		txn.Outcome = "failure"
+	}
+	if init.functionName != "" {
+		txn.Name = init.functionName + " init"
+	}
+	if init.runtimeVersion != "" {
+		txn.Context.Labels.Set("runtime_version", init.runtimeVersion)
+	}
+	if link != nil {
+		txn.Links = []model.Link{*link}
+	}
+
+	var spans []*model.Span
+	for _, phase := range []struct {
+		name, subtype string
+		initPhase
+	}{
+		{"Runtime init", "runtime", init.runtime},
+		{"Extension init", "extension", extensionInit},
+		{"Restore", "restore", init.restore},
+	} {
+		if !phase.complete() {
+			continue
+		}
+		spans = append(spans, &model.Span{
+			ID:            model.NewID(8),
+			TransactionID: txn.ID,
+			TraceID:       txn.TraceID,
+			ParentID:      txn.ID,
+			Name:          phase.name,
+			Type:          "faas.init",
+			Subtype:       phase.subtype,
+			Timestamp:     model.Time(phase.start),
+			Duration:      float64(phase.end.Sub(phase.start).Microseconds()) / 1e3,
+		})
+		if end := float64(phase.end.Sub(start).Microseconds()) / 1e3; end > txn.Duration {
+			txn.Duration = end
+		}
+	}
+	txn.SpanCount.Started = len(spans)
+
+	events := make([][]byte, 0, len(spans)+1)
+	var w fastjson.Writer
+	if err := (&model.TransactionContainer{Transaction: txn}).MarshalFastJSON(&w); err != nil {
+		return nil, err
+	}
+	events = append(events, w.Bytes())
+	for _, span := range spans {
+		var w fastjson.Writer
+		if err := (&model.SpanContainer{Span: span}).MarshalFastJSON(&w); err != nil {
+			return nil, err
+		}
+		events = append(events, w.Bytes())
+	}
+	return events, nil
+}
@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestProcessLogsInitTransaction(t *testing.T) {
+	initStart := time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC)
+	extensionStart := initStart.Add(10 * time.Millisecond)
+	c, batch := newTestClient(t, WithExtensionStartTime(extensionStart))
+	c.extensionInit.end = extensionStart.Add(40 * time.Millisecond)
+
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+	require.NoError(t, batch.OnAgentInit("req-1", "", []byte(`{"transaction":{"id":"023d90ff77f13b9f","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`)))
+
+	for _, event := range []LogEvent{
+		{
+			Time: initStart,
+			Type: PlatformInitStart,
+			Record: LogEventRecord{
+				InitializationType: "on-demand",
+				Phase:              "init",
+				FunctionName:       "my-function",
+				RuntimeVersion:     "nodejs-18.v3",
+			},
+		},
+		{
+			Time:   initStart.Add(120 * time.Millisecond),
+			Type:   PlatformInitRuntimeDone,
+			Record: LogEventRecord{InitializationType: "on-demand", Status: "success"},
+		},
+		{
+			Time:   initStart.Add(125 * time.Millisecond),
+			Type:   PlatformInitReport,
+			Record: LogEventRecord{InitializationType: "on-demand", Status: "success", Metrics: PlatformMetrics{DurationMs: 125}},
+		},
+		{
+			Time:   initStart.Add(time.Second),
+			Type:   PlatformRuntimeDone,
+			Record: LogEventRecord{RequestID: "req-1", Status: "success"},
+		},
+	} {
+		c.logsChannel <- event
+	}
+
+	var forwarded [][]byte
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, false)
+
+	require.Len(t, forwarded, 3)
+	txn := gjson.GetBytes(forwarded[0], "transaction")
+	assert.Equal(t, "my-function init", txn.Get("name").String())
+	assert.Equal(t, "faas.init", txn.Get("type").String())
+	assert.Equal(t, initStart.UnixMicro(), txn.Get("timestamp").Int())
+	assert.Equal(t, 125.0, txn.Get("duration").Float())
+	assert.Equal(t, "success", txn.Get("outcome").String())
+	assert.Equal(t, int64(2), txn.Get("span_count.started").Int())
+	assert.Equal(t, "on-demand", txn.Get("context.tags.faas_initialization_type").String())
+	assert.True(t, txn.Get("context.tags.faas_coldstart").Bool())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", txn.Get("links.0.trace_id").String())
+	assert.Equal(t, "023d90ff77f13b9f", txn.Get("links.0.span_id").String())
+
+	runtimeSpan := gjson.GetBytes(forwarded[1], "span")
+	assert.Equal(t, "Runtime init", runtimeSpan.Get("name").String())
+	assert.Equal(t, 120.0, runtimeSpan.Get("duration").Float())
+	assert.Equal(t, txn.Get("id").String(), runtimeSpan.Get("parent_id").String())
+	assert.Equal(t, txn.Get("trace_id").String(), runtimeSpan.Get("trace_id").String())
+
+	extensionSpan := gjson.GetBytes(forwarded[2], "span")
+	assert.Equal(t, "Extension init", extensionSpan.Get("name").String())
+	assert.Equal(t, extensionStart.UnixMicro(), extensionSpan.Get("timestamp").Int())
+	assert.Equal(t, 40.0, extensionSpan.Get("duration").Float())
+
+	// The init transaction is only sent for the first invocation.
+	c.logsChannel <- LogEvent{
+		Time:   initStart.Add(2 * time.Second),
+		Type:   PlatformRuntimeDone,
+		Record: LogEventRecord{RequestID: "req-1", Status: "success"},
+	}
+	forwarded = nil
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, false)
+	assert.Empty(t, forwarded)
+}
+
+func TestProcessLogsInitTransactionFromReport(t *testing.T) {
+	c, batch := newTestClient(t, WithInvocationMetrics(false))
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+
+	// The Logs API only reports the init duration in the platform.report
+	// of the first invocation.
+	reportTime := time.Date(2022, 10, 12, 0, 0, 1, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		c.logsChannel <- LogEvent{
+			Time: reportTime,
+			Type: PlatformReport,
+			Record: LogEventRecord{
+				RequestID: "req-1",
+				Status:    "success",
+				Metrics:   PlatformMetrics{DurationMs: 100, InitDurationMs: 250},
+			},
+		}
+	}
+
+	var forwarded [][]byte
+	c.FlushData(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, false)
+
+	require.Len(t, forwarded, 2)
+	txn := gjson.GetBytes(forwarded[0], "transaction")
+	assert.Equal(t, "init", txn.Get("name").String())
+	assert.Equal(t, reportTime.Add(-350*time.Millisecond).UnixMicro(), txn.Get("timestamp").Int())
+	assert.Equal(t, 250.0, txn.Get("duration").Float())
+	assert.Equal(t, "Runtime init", gjson.GetBytes(forwarded[1], "span.name").String())
+}
+
+func TestProcessLogsProvisionedConcurrency(t *testing.T) {
+	c, batch := newTestClient(t)
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+
+	ts := time.Now()
+	for _, event := range []LogEvent{
+		{
+			Time:   ts,
+			Type:   PlatformInitStart,
+			Record: LogEventRecord{InitializationType: ProvisionedConcurrency},
+		},
+		{
+			Time:   ts.Add(100 * time.Millisecond),
+			Type:   PlatformInitRuntimeDone,
+			Record: LogEventRecord{InitializationType: ProvisionedConcurrency, Status: "success"},
+		},
+		{
+			Time:   ts.Add(time.Minute),
+			Type:   PlatformRuntimeDone,
+			Record: LogEventRecord{RequestID: "req-1", Status: "success"},
+		},
+		{
+			Time:   ts.Add(time.Minute),
+			Type:   PlatformReport,
+			Record: LogEventRecord{RequestID: "req-1", Metrics: PlatformMetrics{DurationMs: 10, InitDurationMs: 100}},
+		},
+	} {
+		c.logsChannel <- event
+	}
+
+	var forwarded [][]byte
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, true)
+
+	require.Len(t, forwarded, 3)
+	txn := gjson.GetBytes(forwarded[0], "transaction")
+	assert.Equal(t, ProvisionedConcurrency, txn.Get("context.tags.faas_initialization_type").String())
+	assert.False(t, txn.Get("context.tags.faas_coldstart").Bool())
+	assert.False(t, gjson.GetBytes(forwarded[2], "metricset.faas.coldstart").Bool())
+	assert.Equal(t, 100.0, gjson.GetBytes(forwarded[2], "metricset.samples.faas\\.coldstart_duration.value").Float())
+}
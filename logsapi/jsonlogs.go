@@ -0,0 +1,174 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+)
+
+// jsonLogKeys are the top level keys of structured log lines that are
+// either mapped to log event fields or dropped. The remaining keys with
+// scalar values are added as labels.
+var jsonLogKeys = map[string]struct{}{
+	"@timestamp": {}, "timestamp": {}, "time": {}, "ts": {},
+	"message": {}, "msg": {},
+	"level": {}, "log.level": {}, "log": {}, "severity": {},
+	"logger": {}, "log.logger": {}, "logger_name": {},
+	"error": {}, "err": {}, "error.type": {}, "error.message": {}, "error.stack_trace": {},
+	"trace.id": {}, "trace_id": {}, "traceId": {}, "trace": {}, "traceparent": {},
+	"transaction.id": {}, "transaction_id": {}, "transaction": {},
+	"span.id": {}, "span_id": {}, "spanId": {}, "span": {},
+	"labels": {}, "ecs": {}, "ecs.version": {}, "_aws": {},
+	"requestId": {}, "pid": {}, "hostname": {},
+}
+
+// pinoLevels maps the numeric log levels of pino to their names.
+var pinoLevels = map[float64]string{
+	10: "trace",
+	20: "debug",
+	30: "info",
+	40: "warn",
+	50: "error",
+	60: "fatal",
+}
+
+// parseJSONLog maps the well known fields of a structured JSON log line
+// onto the log event. It returns false if the line is not a JSON object.
+func parseJSONLog(line string, logLine *model.LogLine) bool {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "{") {
+		return false
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(trimmed), &fields); err != nil {
+		return false
+	}
+
+	if message, ok := lookupString(fields, "message", "msg"); ok {
+		logLine.Message = message
+	}
+	if level, ok := lookupJSONField(fields, "log.level", "level", "severity"); ok {
+		switch level := level.(type) {
+		case string:
+			logLine.Level = strings.ToLower(level)
+		case float64:
+			logLine.Level = pinoLevels[level]
+		}
+	}
+	logLine.Logger, _ = lookupString(fields, "log.logger", "logger", "logger_name")
+	logLine.TraceID, _ = lookupString(fields, "trace.id", "trace_id", "traceId")
+	logLine.TransactionID, _ = lookupString(fields, "transaction.id", "transaction_id")
+	logLine.SpanID, _ = lookupString(fields, "span.id", "span_id", "spanId")
+	if traceparent, ok := lookupString(fields, "traceparent"); ok && logLine.TraceID == "" {
+		logLine.TraceID, logLine.SpanID, _ = parseTraceparent(traceparent)
+	}
+	parseJSONLogError(fields, logLine)
+
+	labels := model.Labels{}
+	if custom, ok := fields["labels"].(map[string]interface{}); ok {
+		for k, v := range custom {
+			if isLabelValue(v) {
+				labels.Set(k, v)
+			}
+		}
+	}
+	for k, v := range fields {
+		if _, ok := jsonLogKeys[k]; ok || !isLabelValue(v) {
+			continue
+		}
+		labels.Set(k, v)
+	}
+	if len(labels) > 0 {
+		logLine.Labels = labels
+	}
+	return true
+}
+
+// parseJSONLogError maps the ECS error fields, as well as the error
+// objects of common loggers, onto the log event.
+func parseJSONLogError(fields map[string]interface{}, logLine *model.LogLine) {
+	logLine.ErrorType, _ = lookupString(fields, "error.type", "err.type")
+	logLine.ErrorMessage, _ = lookupString(fields, "error.message", "err.message")
+	logLine.ErrorStackTrace, _ = lookupString(fields, "error.stack_trace", "err.stack_trace", "err.stack", "error.stack")
+	if logLine.ErrorMessage == "" {
+		// Loggers such as zap log the error message as a string.
+		logLine.ErrorMessage, _ = lookupString(fields, "error", "err")
+	}
+}
+
+// parseTraceparent returns the trace ID and parent ID of a W3C
+// traceparent header value.
+func parseTraceparent(traceparent string) (traceID, parentID string, ok bool) {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// lookupString returns the first of the given fields that is a string.
+func lookupString(fields map[string]interface{}, paths ...string) (string, bool) {
+	for _, path := range paths {
+		if v, ok := lookupJSONField(fields, path); ok {
+			if s, ok := v.(string); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// lookupJSONField returns the first of the given fields that is set. A
+// dotted path matches both a dotted key and the corresponding nested
+// objects, as both forms are used by ECS loggers.
+func lookupJSONField(fields map[string]interface{}, paths ...string) (interface{}, bool) {
+	for _, path := range paths {
+		if v, ok := fields[path]; ok {
+			return v, true
+		}
+		for i := strings.IndexByte(path, '.'); i >= 0; i = nextDot(path, i) {
+			nested, ok := fields[path[:i]].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if v, ok := lookupJSONField(nested, path[i+1:]); ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func nextDot(path string, i int) int {
+	j := strings.IndexByte(path[i+1:], '.')
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+func isLabelValue(v interface{}) bool {
+	switch v.(type) {
+	case string, bool, float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"testing"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSONLog(t *testing.T) {
+	testCases := map[string]struct {
+		line     string
+		expected model.LogLine
+	}{
+		"ecs dotted": {
+			line: `{"@timestamp":"2022-11-12T00:00:00Z","log.level":"ERROR","message":"failed","log.logger":"app","trace.id":"abc","transaction.id":"def","error.type":"ValueError","error.message":"bad value","error.stack_trace":"at main","labels":{"tenant.id":"t1"}}`,
+			expected: model.LogLine{
+				Message:         "failed",
+				Level:           "error",
+				Logger:          "app",
+				TraceID:         "abc",
+				TransactionID:   "def",
+				ErrorType:       "ValueError",
+				ErrorMessage:    "bad value",
+				ErrorStackTrace: "at main",
+				Labels:          model.Labels{"tenant_id": "t1"},
+			},
+		},
+		"ecs nested": {
+			line: `{"log":{"level":"warn","logger":"app"},"message":"slow","span":{"id":"123"},"error":{"type":"Timeout","message":"took too long"}}`,
+			expected: model.LogLine{
+				Message:      "slow",
+				Level:        "warn",
+				Logger:       "app",
+				SpanID:       "123",
+				ErrorType:    "Timeout",
+				ErrorMessage: "took too long",
+			},
+		},
+		"zap": {
+			line: `{"level":"info","ts":1668211200.5,"logger":"handler","msg":"done","error":"connection reset","order_id":42,"cached":true}`,
+			expected: model.LogLine{
+				Message:      "done",
+				Level:        "info",
+				Logger:       "handler",
+				ErrorMessage: "connection reset",
+				Labels:       model.Labels{"order_id": float64(42), "cached": true},
+			},
+		},
+		"pino": {
+			line: `{"level":50,"time":1668211200000,"pid":8,"hostname":"host","msg":"boom","err":{"type":"Error","message":"boom","stack":"Error: boom"}}`,
+			expected: model.LogLine{
+				Message:         "boom",
+				Level:           "error",
+				ErrorType:       "Error",
+				ErrorMessage:    "boom",
+				ErrorStackTrace: "Error: boom",
+			},
+		},
+		"without message": {
+			line: `{"level":"debug","cold_start":true}`,
+			expected: model.LogLine{
+				Message: `{"level":"debug","cold_start":true}`,
+				Level:   "debug",
+				Labels:  model.Labels{"cold_start": true},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			logLine := model.LogLine{Message: tc.line}
+			assert.True(t, parseJSONLog(tc.line, &logLine))
+			assert.Equal(t, tc.expected, logLine)
+		})
+	}
+}
+
+func TestParseJSONLogNotJSON(t *testing.T) {
+	for _, line := range []string{
+		"plain text",
+		"{not json",
+		`["message"]`,
+	} {
+		logLine := model.LogLine{Message: line}
+		assert.False(t, parseJSONLog(line, &logLine))
+		assert.Equal(t, model.LogLine{Message: line}, logLine)
+	}
+}
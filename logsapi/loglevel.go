@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// logLevelSeverity ranks the log levels used by the common loggers.
+var logLevelSeverity = map[string]int{
+	"trace":    1,
+	"debug":    2,
+	"info":     3,
+	"notice":   3,
+	"warn":     4,
+	"warning":  4,
+	"error":    5,
+	"critical": 6,
+	"fatal":    6,
+	"dpanic":   6,
+	"panic":    6,
+}
+
+// textLogLevel matches the level of plain text log lines, either at the
+// beginning of the line, as in `[INFO]` or `ERROR:`, or right after a
+// timestamp and an optional request ID as written by the Lambda runtimes.
+var textLogLevel = regexp.MustCompile(`^(?:\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}\S*\s+(?:\S+\s+)?)?\[?(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|CRITICAL|FATAL)\]?(?:[\s:]|$)`)
+
+// detectLogLevel returns the level of a plain text log line, or an empty
+// string if the line has no known level.
+func detectLogLevel(line string) string {
+	m := textLogLevel.FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+	return strings.ToLower(m[1])
+}
+
+// logLevelFilter drops the log lines below a minimum level and counts
+// the dropped lines per level. Lines without a known level are never
+// dropped.
+type logLevelFilter struct {
+	minSeverity int
+
+	mu      sync.Mutex
+	dropped map[string]uint64
+}
+
+func (f *logLevelFilter) allow(level string) bool {
+	severity, ok := logLevelSeverity[level]
+	if !ok || severity >= f.minSeverity {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dropped == nil {
+		f.dropped = make(map[string]uint64)
+	}
+	f.dropped[level]++
+	return false
+}
+
+func (f *logLevelFilter) droppedCounts() map[string]uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	counts := make(map[string]uint64, len(f.dropped))
+	for level, n := range f.dropped {
+		counts[level] = n
+	}
+	return counts
+}
+
+// DroppedLogs returns the number of function log lines dropped for being
+// below the minimum log level, per level.
+func (lc *Client) DroppedLogs() map[string]uint64 {
+	return lc.levelFilter.droppedCounts()
+}
@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestDetectLogLevel(t *testing.T) {
+	for line, expected := range map[string]string{
+		"[INFO]\t2022-11-12T00:00:00.000Z\t8476a536\tprocessing": "info",
+		"2022-11-12T00:00:00.000Z\t8476a536\tWARN\tslow request": "warn",
+		"2022-11-12 00:00:00 8476a536 ERROR Handler - failed":    "error",
+		"DEBUG: cache miss":                                     "debug",
+		"CRITICAL database unavailable":                         "critical",
+		"processing order":                                      "",
+		"Information about the ERRORS":                          "",
+		"START RequestId: 8476a536 Version: $LATEST":            "",
+		"user 42 cancelled order INFO mail sent":                "",
+		"Processed INFO requests":                               "",
+		"2022-11-12T00:00:00.000Z\t8476a536\tsent ERROR report": "",
+	} {
+		assert.Equal(t, expected, detectLogLevel(line), line)
+	}
+}
+
+func TestMinimumLogLevel(t *testing.T) {
+	_, err := NewClient(
+		WithLogsAPIBaseURL("http://example.com"),
+		WithLogger(newTestLogger(t)),
+		WithMinimumLogLevel("verbose"),
+	)
+	require.Error(t, err)
+
+	monitor := selfmonitor.New(time.Minute)
+	c, _ := newTestClient(t, WithMinimumLogLevel("WARN"), WithSelfMonitor(monitor))
+	for _, record := range []string{
+		"[DEBUG] cache miss",
+		`{"level":"debug","message":"cache miss"}`,
+		"[INFO] processing",
+		"[WARN] slow request",
+		`{"level":"error","message":"failed"}`,
+		"no level",
+	} {
+		c.logsChannel <- LogEvent{Time: time.Now(), Type: FunctionLog, StringRecord: record}
+	}
+
+	var levels []string
+	c.FlushData(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		levels = append(levels, gjson.GetBytes(b, "log.log\\.level").String())
+		return nil
+	}, false)
+
+	assert.Equal(t, []string{"warn", "error", ""}, levels)
+	assert.Equal(t, map[string]uint64{"debug": 2, "info": 1}, c.DroppedLogs())
+
+	metricsets, err := monitor.Flush(time.Now())
+	require.NoError(t, err)
+	require.Len(t, metricsets, 1)
+	samples := gjson.GetBytes(metricsets[0], "metricset.samples")
+	assert.Equal(t, 3.0, samples.Get("extension\\.logs\\.filtered.value").Float())
+	assert.Equal(t, 2.0, samples.Get("extension\\.logs\\.filtered\\.debug.value").Float())
+	assert.Equal(t, 1.0, samples.Get("extension\\.logs\\.filtered\\.info.value").Float())
+}
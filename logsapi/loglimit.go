@@ -0,0 +1,114 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+)
+
+// DefaultErrorLogLimit is the default number of error level function log
+// lines forwarded per invocation once the log limits are reached.
+const DefaultErrorLogLimit = 100
+
+// logLimiter caps the number of function log lines and bytes forwarded
+// per invocation. Once a cap is reached, one out of sampleEvery lines is
+// forwarded, or none if sampleEvery is 0. Error level lines are forwarded
+// regardless of the caps, up to maxErrorLines.
+type logLimiter struct {
+	maxLines      int
+	maxBytes      int
+	maxErrorLines int
+	sampleEvery   int
+
+	mu         sync.Mutex
+	lines      int
+	bytes      int
+	errorLines int
+	overLimit  int
+	suppressed int
+}
+
+// allow records a log line of the given level and size and returns
+// whether it can be forwarded.
+func (l *logLimiter) allow(level string, size int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if (l.maxLines <= 0 || l.lines < l.maxLines) && (l.maxBytes <= 0 || l.bytes+size <= l.maxBytes) {
+		l.lines++
+		l.bytes += size
+		return true
+	}
+	if logLevelSeverity[level] >= logLevelSeverity["error"] && l.errorLines < l.maxErrorLines {
+		l.errorLines++
+		return true
+	}
+	l.overLimit++
+	if l.sampleEvery > 0 && l.overLimit%l.sampleEvery == 0 {
+		return true
+	}
+	l.suppressed++
+	return false
+}
+
+// reset starts a new invocation and returns the number of log lines
+// suppressed during the previous one.
+func (l *logLimiter) reset() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	suppressed := l.suppressed
+	l.lines, l.bytes, l.errorLines, l.overLimit, l.suppressed = 0, 0, 0, 0, 0
+	return suppressed
+}
+
+// flushLogLimits resets the log limits for the next invocation and
+// forwards a log event summarizing the log lines suppressed during the
+// invocation, if any.
+func (lc *Client) flushLogLimits(ctx context.Context, requestID, invokedFnArn string, ts time.Time, forwardFn Forwarder) {
+	if lc.limiter == nil {
+		return
+	}
+	suppressed := lc.limiter.reset()
+	if suppressed == 0 {
+		return
+	}
+	summary, err := marshalLog(model.LogContainer{
+		Log: &model.LogLine{
+			Timestamp: model.Time(ts),
+			Message:   fmt.Sprintf("%d function log lines were suppressed for exceeding the log limits of the invocation", suppressed),
+			Level:     "warn",
+			FAAS: &model.FAAS{
+				ID:        invokedFnArn,
+				Execution: requestID,
+			},
+			Labels: model.Labels{"suppressed_log_lines": suppressed},
+		},
+	})
+	if err != nil {
+		lc.logger.Warnf("Error processing log limits summary : %v", err)
+		return
+	}
+	if err := forwardFn(ctx, summary); err != nil {
+		lc.logger.Warnf("Error forwarding log limits summary : %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestLogLimiter(t *testing.T) {
+	testCases := map[string]struct {
+		limiter    *logLimiter
+		levels     []string
+		expected   []bool
+		suppressed int
+	}{
+		"line limit": {
+			limiter:    &logLimiter{maxLines: 2},
+			levels:     []string{"info", "info", "info", "info"},
+			expected:   []bool{true, true, false, false},
+			suppressed: 2,
+		},
+		"byte limit": {
+			limiter:    &logLimiter{maxBytes: 25},
+			levels:     []string{"info", "info", "info"},
+			expected:   []bool{true, true, false},
+			suppressed: 1,
+		},
+		"sampling": {
+			limiter:    &logLimiter{maxLines: 1, sampleEvery: 2},
+			levels:     []string{"info", "info", "info", "info", "info"},
+			expected:   []bool{true, false, true, false, true},
+			suppressed: 2,
+		},
+		"error lines": {
+			limiter:    &logLimiter{maxLines: 1, maxErrorLines: 2},
+			levels:     []string{"info", "error", "fatal", "error", "info"},
+			expected:   []bool{true, true, true, false, false},
+			suppressed: 2,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var allowed []bool
+			for _, level := range tc.levels {
+				allowed = append(allowed, tc.limiter.allow(level, 10))
+			}
+			assert.Equal(t, tc.expected, allowed)
+			assert.Equal(t, tc.suppressed, tc.limiter.reset())
+			assert.True(t, tc.limiter.allow("info", 10))
+		})
+	}
+}
+
+func TestProcessLogsLogLimitsSummary(t *testing.T) {
+	c, batch := newTestClient(t, WithInvocationLogLimits(2, 0), WithErrorLogLimit(1))
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+
+	ts := time.Now()
+	for _, record := range []string{
+		"[INFO] one",
+		"[INFO] two",
+		"[INFO] three",
+		"[ERROR] failed",
+		"[ERROR] failed again",
+	} {
+		c.logsChannel <- LogEvent{Time: ts, Type: FunctionLog, StringRecord: record}
+	}
+	c.logsChannel <- LogEvent{
+		Time:   ts,
+		Type:   PlatformRuntimeDone,
+		Record: LogEventRecord{RequestID: "req-1", Status: "success"},
+	}
+
+	var messages []string
+	var summary []byte
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		messages = append(messages, gjson.GetBytes(b, "log.message").String())
+		summary = b
+		return nil
+	}, false)
+
+	require.Len(t, messages, 4)
+	assert.Equal(t, []string{"[INFO] one", "[INFO] two", "[ERROR] failed"}, messages[:3])
+	assert.Equal(t, int64(2), gjson.GetBytes(summary, "log.labels.suppressed_log_lines").Int())
+	assert.Equal(t, "req-1", gjson.GetBytes(summary, "log.faas.execution").String())
+	assert.Equal(t, "warn", gjson.GetBytes(summary, "log.log\\.level").String())
+}
@@ -19,24 +19,115 @@ package logsapi
 
 import (
 	"math"
+	"sync"
 	"time"
 
 	"github.com/elastic/apm-aws-lambda/logsapi/model"
 	"go.elastic.co/fastjson"
 )
 
+// Names of the optional platform metrics, only reported when the platform
+// events carry the corresponding field.
+const (
+	// ResponseLatencyMetric is the time from the invocation until the
+	// runtime started sending the response, in milliseconds.
+	ResponseLatencyMetric = "faas.response_latency"
+	// ResponseDurationMetric is the time the runtime took to send the
+	// response, in milliseconds.
+	ResponseDurationMetric = "faas.response_duration"
+	// RuntimeOverheadMetric is the time the runtime took after sending the
+	// response until it requested the next event, in milliseconds.
+	RuntimeOverheadMetric = "faas.runtime_overhead"
+	// ProducedBytesMetric is the size of the invocation response, in bytes.
+	ProducedBytesMetric = "faas.produced_bytes"
+	// RestoreDurationMetric is the duration of the restore of SnapStart
+	// functions, in milliseconds.
+	RestoreDurationMetric = "faas.restore_duration"
+	// BilledRestoreDurationMetric is the billed duration of the restore of
+	// SnapStart functions, in milliseconds.
+	BilledRestoreDurationMetric = "faas.billed_restore_duration"
+)
+
 type PlatformMetrics struct {
 	DurationMs       float32 `json:"durationMs"`
 	BilledDurationMs int32   `json:"billedDurationMs"`
 	MemorySizeMB     int32   `json:"memorySizeMB"`
 	MaxMemoryUsedMB  int32   `json:"maxMemoryUsedMB"`
 	InitDurationMs   float32 `json:"initDurationMs"`
+
+	// The following metrics are only sent by newer platform events and
+	// are nil if not reported.
+
+	// RestoreDurationMs and BilledRestoreDurationMs are sent with the
+	// platform.report events of SnapStart functions.
+	RestoreDurationMs       *float32 `json:"restoreDurationMs,omitempty"`
+	BilledRestoreDurationMs *int32   `json:"billedRestoreDurationMs,omitempty"`
+	// ProducedBytes is sent with platform.runtimeDone events.
+	ProducedBytes *int64 `json:"producedBytes,omitempty"`
+	// ResponseLatencyMs, ResponseDurationMs and RuntimeOverheadMs are
+	// taken from the spans of platform.runtimeDone events.
+	ResponseLatencyMs  *float64 `json:"-"`
+	ResponseDurationMs *float64 `json:"-"`
+	RuntimeOverheadMs  *float64 `json:"-"`
+}
+
+// addRuntimeDone sets the metrics reported by the platform.runtimeDone
+// event of the invocation.
+func (m *PlatformMetrics) addRuntimeDone(record LogEventRecord) {
+	if record.Metrics.ProducedBytes != nil {
+		m.ProducedBytes = record.Metrics.ProducedBytes
+	}
+	for _, span := range record.Spans {
+		durationMs := span.DurationMs
+		switch span.Name {
+		case "responseLatency":
+			m.ResponseLatencyMs = &durationMs
+		case "responseDuration":
+			m.ResponseDurationMs = &durationMs
+		case "runtimeOverhead":
+			m.RuntimeOverheadMs = &durationMs
+		}
+	}
+}
+
+// runtimeDoneTracker holds the platform.runtimeDone records reporting
+// metrics or the status of the invocation until the platform.report
+// event of the invocation.
+type runtimeDoneTracker struct {
+	mu      sync.Mutex
+	records map[string]LogEventRecord
+}
+
+func (t *runtimeDoneTracker) add(record LogEventRecord) {
+	if len(record.Spans) == 0 && record.Metrics.ProducedBytes == nil && record.Status == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.records == nil {
+		t.records = make(map[string]LogEventRecord)
+	}
+	t.records[record.RequestID] = record
+}
+
+func (t *runtimeDoneTracker) take(reqID string) (LogEventRecord, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	record, ok := t.records[reqID]
+	delete(t.records, reqID)
+	return record, ok
 }
 
 // ProcessPlatformReport processes the `platform.report` log line from lambda logs API and
 // returns a byte array containing the JSON body for the extracted platform metrics. A non
 // nil error is returned when marshaling of platform metrics into JSON fails.
 func ProcessPlatformReport(fnARN string, deadlineMs int64, ts time.Time, platformReport LogEvent) ([]byte, error) {
+	return processPlatformReport(fnARN, deadlineMs, ts, platformReport, platformReport.Record.Metrics.InitDurationMs > 0)
+}
+
+// processPlatformReport processes the `platform.report` log line, coldstart
+// is false for environments initialized by provisioned concurrency.
+func processPlatformReport(fnARN string, deadlineMs int64, ts time.Time, platformReport LogEvent, coldstart bool) ([]byte, error) {
 	metricsContainer := model.MetricsContainer{
 		Metrics: &model.Metrics{},
 	}
@@ -51,7 +142,7 @@ func ProcessPlatformReport(fnARN string, deadlineMs int64, ts time.Time, platfor
 	metricsContainer.Metrics.FAAS = &model.ExtendedFAAS{
 		Execution: platformReport.Record.RequestID,
 		ID:        fnARN,
-		Coldstart: platformReportMetrics.InitDurationMs > 0,
+		Coldstart: &coldstart,
 	}
 
 	// System
@@ -69,6 +160,26 @@ func ProcessPlatformReport(fnARN string, deadlineMs int64, ts time.Time, platfor
 	// - The multiplication / division then rounds the value to obtain a number of ms that can be expressed a multiple of 1000 (see initial assumption)
 	metricsContainer.Add("faas.timeout", math.Ceil(float64(deadlineMs-ts.UnixMilli())/1e3)*1e3) // Unit : Milliseconds
 
+	// Optional Metrics
+	if v := platformReportMetrics.ResponseLatencyMs; v != nil {
+		metricsContainer.Add(ResponseLatencyMetric, *v) // Unit : Milliseconds
+	}
+	if v := platformReportMetrics.ResponseDurationMs; v != nil {
+		metricsContainer.Add(ResponseDurationMetric, *v) // Unit : Milliseconds
+	}
+	if v := platformReportMetrics.RuntimeOverheadMs; v != nil {
+		metricsContainer.Add(RuntimeOverheadMetric, *v) // Unit : Milliseconds
+	}
+	if v := platformReportMetrics.ProducedBytes; v != nil {
+		metricsContainer.Add(ProducedBytesMetric, float64(*v)) // Unit : Bytes
+	}
+	if v := platformReportMetrics.RestoreDurationMs; v != nil {
+		metricsContainer.Add(RestoreDurationMetric, float64(*v)) // Unit : Milliseconds
+	}
+	if v := platformReportMetrics.BilledRestoreDurationMs; v != nil {
+		metricsContainer.Add(BilledRestoreDurationMetric, float64(*v)) // Unit : Milliseconds
+	}
+
 	var jsonWriter fastjson.Writer
 	if err := metricsContainer.MarshalFastJSON(&jsonWriter); err != nil {
 		return nil, err
@@ -18,7 +18,10 @@
 package logsapi
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -26,6 +29,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 )
 
 func TestProcessPlatformReport_Coldstart(t *testing.T) {
@@ -112,6 +116,64 @@ func TestProcessPlatformReport_NoColdstart(t *testing.T) {
 	assert.JSONEq(t, desiredOutputMetrics, string(data))
 }
 
+func TestProcessLogsPlatformReportBreakdown(t *testing.T) {
+	c, batch := newTestClient(t)
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+
+	var runtimeDone, report LogEvent
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"time": "2022-10-12T00:01:15.000Z",
+		"type": "platform.runtimeDone",
+		"record": {
+			"requestId": "req-1",
+			"status": "success",
+			"spans": [
+				{"name": "responseLatency", "start": "2022-10-12T00:01:00.000Z", "durationMs": 23.02},
+				{"name": "responseDuration", "start": "2022-10-12T00:01:00.023Z", "durationMs": 20},
+				{"name": "runtimeOverhead", "start": "2022-10-12T00:01:00.043Z", "durationMs": 1.5}
+			],
+			"metrics": {"durationMs": 200.0, "producedBytes": 1000}
+		}
+	}`), &runtimeDone))
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"time": "2022-10-12T00:01:15.500Z",
+		"type": "platform.report",
+		"record": {
+			"requestId": "req-1",
+			"status": "success",
+			"metrics": {
+				"durationMs": 210.0,
+				"billedDurationMs": 211,
+				"memorySizeMB": 128,
+				"maxMemoryUsedMB": 76,
+				"restoreDurationMs": 300.5,
+				"billedRestoreDurationMs": 301
+			}
+		}
+	}`), &report))
+	c.logsChannel <- runtimeDone
+	c.logsChannel <- report
+
+	var forwarded [][]byte
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, true)
+
+	require.Len(t, forwarded, 1)
+	samples := gjson.GetBytes(forwarded[0], "metricset.samples")
+	for name, expected := range map[string]float64{
+		ResponseLatencyMetric:       23.02,
+		ResponseDurationMetric:      20,
+		RuntimeOverheadMetric:       1.5,
+		ProducedBytesMetric:         1000,
+		RestoreDurationMetric:       300.5,
+		BilledRestoreDurationMetric: 301,
+	} {
+		assert.Equal(t, expected, samples.Get(strings.ReplaceAll(name, ".", "\\.")+".value").Float(), name)
+	}
+}
+
 func BenchmarkPlatformReport(b *testing.B) {
 	reqID := "8476a536-e9f4-11e8-9739-2dfe598c3fcd"
 	invokedFnArn := "arn:aws:lambda:us-east-2:123456789012:function:custom-runtime"
@@ -0,0 +1,186 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package model
+
+import "strings"
+
+// Labels holds user defined key/value pairs. Values are expected to
+// be strings, booleans or numbers.
+type Labels map[string]interface{}
+
+var labelKeyReplacer = strings.NewReplacer(".", "_", "*", "_", "\"", "_")
+
+// Set adds a label, replacing the characters that are not allowed in
+// label keys by APM Server.
+func (l Labels) Set(key string, value interface{}) {
+	l[labelKeyReplacer.Replace(key)] = value
+}
+
+type MetadataContainer struct {
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// Metadata is a subset of the intake v2 metadata event, used when the
+// extension has to describe the service itself as no APM agent did.
+type Metadata struct {
+	Service Service `json:"service"`
+	Cloud   *Cloud  `json:"cloud,omitempty"`
+	Labels  Labels  `json:"labels,omitempty"`
+}
+
+type Service struct {
+	Name        string    `json:"name"`
+	Version     string    `json:"version,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	Agent       Agent     `json:"agent"`
+	Language    *Language `json:"language,omitempty"`
+	Runtime     *Runtime  `json:"runtime,omitempty"`
+}
+
+type Agent struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Language struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type Runtime struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type Cloud struct {
+	Provider string        `json:"provider"`
+	Region   string        `json:"region,omitempty"`
+	Account  *CloudAccount `json:"account,omitempty"`
+	Service  *CloudService `json:"service,omitempty"`
+}
+
+type CloudAccount struct {
+	ID string `json:"id,omitempty"`
+}
+
+type CloudService struct {
+	Name string `json:"name,omitempty"`
+}
+
+type TransactionContainer struct {
+	Transaction *Transaction `json:"transaction,omitempty"`
+}
+
+type Transaction struct {
+	ID        string    `json:"id"`
+	TraceID   string    `json:"trace_id"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Type      string    `json:"type"`
+	Timestamp Time      `json:"timestamp"`
+	Duration  float64   `json:"duration"`
+	Result    string    `json:"result,omitempty"`
+	Outcome   string    `json:"outcome,omitempty"`
+	SpanCount SpanCount `json:"span_count"`
+	Context   *Context  `json:"context,omitempty"`
+	OTel      *OTel     `json:"otel,omitempty"`
+	Links     []Link    `json:"links,omitempty"`
+	// FAAS is set for transactions synthesized for function invocations.
+	FAAS *ExtendedFAAS `json:"faas,omitempty"`
+}
+
+type SpanCount struct {
+	Started int `json:"started"`
+}
+
+type SpanContainer struct {
+	Span *Span `json:"span,omitempty"`
+}
+
+type Span struct {
+	ID            string   `json:"id"`
+	TransactionID string   `json:"transaction_id,omitempty"`
+	TraceID       string   `json:"trace_id"`
+	ParentID      string   `json:"parent_id"`
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	Subtype       string   `json:"subtype,omitempty"`
+	Action        string   `json:"action,omitempty"`
+	Timestamp     Time     `json:"timestamp"`
+	Duration      float64  `json:"duration"`
+	Outcome       string   `json:"outcome,omitempty"`
+	Context       *Context `json:"context,omitempty"`
+	OTel          *OTel    `json:"otel,omitempty"`
+	Links         []Link   `json:"links,omitempty"`
+}
+
+// Context holds the contextual information of transactions, spans
+// and errors.
+type Context struct {
+	Labels Labels                 `json:"tags,omitempty"`
+	Custom map[string]interface{} `json:"custom,omitempty"`
+}
+
+// OTel holds the OpenTelemetry span kind and attributes of an event,
+// APM Server maps the attributes to the corresponding APM fields.
+type OTel struct {
+	SpanKind   string                 `json:"span_kind,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Link is a span link to another trace or span.
+type Link struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+type ErrorContainer struct {
+	Error *Error `json:"error,omitempty"`
+}
+
+type Error struct {
+	ID            string            `json:"id"`
+	TraceID       string            `json:"trace_id,omitempty"`
+	TransactionID string            `json:"transaction_id,omitempty"`
+	ParentID      string            `json:"parent_id,omitempty"`
+	Timestamp     Time              `json:"timestamp"`
+	Culprit       string            `json:"culprit,omitempty"`
+	Exception     *Exception        `json:"exception,omitempty"`
+	Log           *ErrorLog         `json:"log,omitempty"`
+	Context       *Context          `json:"context,omitempty"`
+	Transaction   *ErrorTransaction `json:"transaction,omitempty"`
+}
+
+type Exception struct {
+	Message string `json:"message,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Handled *bool  `json:"handled,omitempty"`
+}
+
+type ErrorLog struct {
+	Message string `json:"message"`
+	Level   string `json:"level,omitempty"`
+}
+
+// ErrorTransaction holds the details of the transaction an error
+// belongs to.
+type ErrorTransaction struct {
+	Sampled bool   `json:"sampled"`
+	Type    string `json:"type,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
@@ -18,6 +18,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"go.elastic.co/fastjson"
@@ -31,6 +32,23 @@ type LogLine struct {
 	Message   string `json:"message"`
 	Timestamp Time   `json:"@timestamp"`
 	FAAS      *FAAS  `json:"faas,omitempty"`
+	// Level is the log level, for example "info" or "error".
+	Level string `json:"log.level,omitempty"`
+	// Logger is the name of the logger that produced the log line.
+	Logger string `json:"log.logger,omitempty"`
+	// TraceID, TransactionID and SpanID correlate the log line with a trace.
+	TraceID       string `json:"trace.id,omitempty"`
+	TransactionID string `json:"transaction.id,omitempty"`
+	SpanID        string `json:"span.id,omitempty"`
+	// ErrorType, ErrorMessage and ErrorStackTrace describe the error
+	// logged with the log line, if any.
+	ErrorType       string `json:"error.type,omitempty"`
+	ErrorMessage    string `json:"error.message,omitempty"`
+	ErrorStackTrace string `json:"error.stack_trace,omitempty"`
+	// Original is the raw log line, kept as is whether or not fields
+	// have been extracted from it.
+	Original string `json:"event.original,omitempty"`
+	Labels   Labels `json:"labels,omitempty"`
 }
 
 type Time time.Time
@@ -40,6 +58,17 @@ func (t Time) MarshalFastJSON(w *fastjson.Writer) error {
 	return nil
 }
 
+// UnmarshalJSON decodes the number of microseconds since the epoch used
+// by the intake v2 events.
+func (t *Time) UnmarshalJSON(data []byte) error {
+	var us float64
+	if err := json.Unmarshal(data, &us); err != nil {
+		return err
+	}
+	*t = Time(time.UnixMicro(int64(us)).UTC())
+	return nil
+}
+
 // faas struct is a subset of go.elastic.co/apm/v2/model#FAAS
 //
 // The purpose of having a separate struct is to have a custom
@@ -64,6 +93,17 @@ func (mc MetricsContainer) Add(name string, value float64) {
 	mc.addMetric(name, Metric{Value: value})
 }
 
+// AddWithUnit adds a metric with the given name, unit and value.
+func (mc MetricsContainer) AddWithUnit(name, unit string, value float64) {
+	mc.addMetric(name, Metric{Unit: unit, Value: value})
+}
+
+// AddHistogram adds a histogram metric with the given name and unit.
+// The values are expected to be sorted in ascending order.
+func (mc MetricsContainer) AddHistogram(name, unit string, values []float64, counts []uint64) {
+	mc.addMetric(name, Metric{Type: "histogram", Unit: unit, Values: values, Counts: counts})
+}
+
 // Simplified version of https://github.com/elastic/apm-agent-go/blob/675e8398c7fe546f9fd169bef971b9ccfbcdc71f/metrics.go#L89
 func (mc MetricsContainer) addMetric(name string, metric Metric) {
 	if mc.Metrics.Samples == nil {
@@ -76,14 +116,26 @@ type Metrics struct {
 	Timestamp Time              `json:"timestamp"`
 	FAAS      *ExtendedFAAS     `json:"faas,omitempty"`
 	Samples   map[string]Metric `json:"samples,omitempty"`
+	Labels    Labels            `json:"tags,omitempty"`
 }
 
+// ExtendedFAAS holds the faas fields of metricsets and synthesized
+// transactions. Coldstart is left nil when the event does not relate
+// to a single invocation.
 type ExtendedFAAS struct {
 	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
 	Execution string `json:"execution,omitempty"`
-	Coldstart bool   `json:"coldstart"`
+	Coldstart *bool  `json:"coldstart,omitempty"`
 }
 
+// Metric is a single metric sample. Histogram samples set Type to
+// "histogram" and carry their data in Values and Counts, in which
+// case Value is not encoded.
 type Metric struct {
-	Value float64 `json:"value"`
+	Type   string    `json:"type,omitempty"`
+	Unit   string    `json:"unit,omitempty"`
+	Value  float64   `json:"value"`
+	Values []float64 `json:"values,omitempty"`
+	Counts []uint64  `json:"counts,omitempty"`
 }
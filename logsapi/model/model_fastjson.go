@@ -0,0 +1,639 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package model
+
+import (
+	"go.elastic.co/fastjson"
+)
+
+// The marshalers of this file are written by hand. They must not be
+// moved to model_json.go, which is generated by generate-fastjson.
+
+// MarshalFastJSON writes the JSON representation of the metric sample.
+// It is not generated as the value must be omitted for histograms.
+func (v *Metric) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	if v.Values != nil {
+		w.RawString("\"values\":")
+		w.RawByte('[')
+		for i, v := range v.Values {
+			if i != 0 {
+				w.RawByte(',')
+			}
+			w.Float64(v)
+		}
+		w.RawByte(']')
+		w.RawString(",\"counts\":")
+		w.RawByte('[')
+		for i, v := range v.Counts {
+			if i != 0 {
+				w.RawByte(',')
+			}
+			w.Uint64(v)
+		}
+		w.RawByte(']')
+	} else {
+		w.RawString("\"value\":")
+		w.Float64(v.Value)
+	}
+	if v.Type != "" {
+		w.RawString(",\"type\":")
+		w.String(v.Type)
+	}
+	if v.Unit != "" {
+		w.RawString(",\"unit\":")
+		w.String(v.Unit)
+	}
+	w.RawByte('}')
+	return nil
+}
+
+func (v *MetadataContainer) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	if v.Metadata != nil {
+		w.RawString("\"metadata\":")
+		if err := v.Metadata.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *Metadata) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	w.RawString("\"service\":")
+	if err := v.Service.MarshalFastJSON(w); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if v.Cloud != nil {
+		w.RawString(",\"cloud\":")
+		if err := v.Cloud.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.Labels != nil {
+		w.RawString(",\"labels\":")
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Labels {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				if err := fastjson.Marshal(w, v); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		w.RawByte('}')
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *Service) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	w.RawString("\"agent\":")
+	if err := v.Agent.MarshalFastJSON(w); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	w.RawString(",\"name\":")
+	w.String(v.Name)
+	if v.Environment != "" {
+		w.RawString(",\"environment\":")
+		w.String(v.Environment)
+	}
+	if v.Language != nil {
+		w.RawString(",\"language\":")
+		if err := v.Language.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.Runtime != nil {
+		w.RawString(",\"runtime\":")
+		if err := v.Runtime.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.Version != "" {
+		w.RawString(",\"version\":")
+		w.String(v.Version)
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *Agent) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	w.RawString("\"name\":")
+	w.String(v.Name)
+	w.RawString(",\"version\":")
+	w.String(v.Version)
+	w.RawByte('}')
+	return nil
+}
+
+func (v *Language) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	w.RawString("\"name\":")
+	w.String(v.Name)
+	if v.Version != "" {
+		w.RawString(",\"version\":")
+		w.String(v.Version)
+	}
+	w.RawByte('}')
+	return nil
+}
+
+func (v *Runtime) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	w.RawString("\"name\":")
+	w.String(v.Name)
+	if v.Version != "" {
+		w.RawString(",\"version\":")
+		w.String(v.Version)
+	}
+	w.RawByte('}')
+	return nil
+}
+
+func (v *Cloud) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	w.RawString("\"provider\":")
+	w.String(v.Provider)
+	if v.Account != nil {
+		w.RawString(",\"account\":")
+		if err := v.Account.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.Region != "" {
+		w.RawString(",\"region\":")
+		w.String(v.Region)
+	}
+	if v.Service != nil {
+		w.RawString(",\"service\":")
+		if err := v.Service.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *CloudAccount) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	if v.ID != "" {
+		w.RawString("\"id\":")
+		w.String(v.ID)
+	}
+	w.RawByte('}')
+	return nil
+}
+
+func (v *CloudService) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	if v.Name != "" {
+		w.RawString("\"name\":")
+		w.String(v.Name)
+	}
+	w.RawByte('}')
+	return nil
+}
+
+func (v *TransactionContainer) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	if v.Transaction != nil {
+		w.RawString("\"transaction\":")
+		if err := v.Transaction.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *Transaction) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	w.RawString("\"duration\":")
+	w.Float64(v.Duration)
+	w.RawString(",\"id\":")
+	w.String(v.ID)
+	w.RawString(",\"span_count\":")
+	if err := v.SpanCount.MarshalFastJSON(w); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	w.RawString(",\"timestamp\":")
+	if err := v.Timestamp.MarshalFastJSON(w); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	w.RawString(",\"trace_id\":")
+	w.String(v.TraceID)
+	w.RawString(",\"type\":")
+	w.String(v.Type)
+	if v.Context != nil {
+		w.RawString(",\"context\":")
+		if err := v.Context.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.FAAS != nil {
+		w.RawString(",\"faas\":")
+		if err := v.FAAS.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.Links != nil {
+		w.RawString(",\"links\":")
+		w.RawByte('[')
+		for i, v := range v.Links {
+			if i != 0 {
+				w.RawByte(',')
+			}
+			if err := v.MarshalFastJSON(w); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		w.RawByte(']')
+	}
+	if v.Name != "" {
+		w.RawString(",\"name\":")
+		w.String(v.Name)
+	}
+	if v.OTel != nil {
+		w.RawString(",\"otel\":")
+		if err := v.OTel.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.Outcome != "" {
+		w.RawString(",\"outcome\":")
+		w.String(v.Outcome)
+	}
+	if v.ParentID != "" {
+		w.RawString(",\"parent_id\":")
+		w.String(v.ParentID)
+	}
+	if v.Result != "" {
+		w.RawString(",\"result\":")
+		w.String(v.Result)
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *SpanCount) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	w.RawString("\"started\":")
+	w.Int64(int64(v.Started))
+	w.RawByte('}')
+	return nil
+}
+
+func (v *SpanContainer) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	if v.Span != nil {
+		w.RawString("\"span\":")
+		if err := v.Span.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *Span) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	w.RawString("\"duration\":")
+	w.Float64(v.Duration)
+	w.RawString(",\"id\":")
+	w.String(v.ID)
+	w.RawString(",\"name\":")
+	w.String(v.Name)
+	w.RawString(",\"parent_id\":")
+	w.String(v.ParentID)
+	w.RawString(",\"timestamp\":")
+	if err := v.Timestamp.MarshalFastJSON(w); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	w.RawString(",\"trace_id\":")
+	w.String(v.TraceID)
+	w.RawString(",\"type\":")
+	w.String(v.Type)
+	if v.Action != "" {
+		w.RawString(",\"action\":")
+		w.String(v.Action)
+	}
+	if v.Context != nil {
+		w.RawString(",\"context\":")
+		if err := v.Context.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.Links != nil {
+		w.RawString(",\"links\":")
+		w.RawByte('[')
+		for i, v := range v.Links {
+			if i != 0 {
+				w.RawByte(',')
+			}
+			if err := v.MarshalFastJSON(w); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		w.RawByte(']')
+	}
+	if v.OTel != nil {
+		w.RawString(",\"otel\":")
+		if err := v.OTel.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.Outcome != "" {
+		w.RawString(",\"outcome\":")
+		w.String(v.Outcome)
+	}
+	if v.Subtype != "" {
+		w.RawString(",\"subtype\":")
+		w.String(v.Subtype)
+	}
+	if v.TransactionID != "" {
+		w.RawString(",\"transaction_id\":")
+		w.String(v.TransactionID)
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *Context) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	first := true
+	if v.Custom != nil {
+		const prefix = ",\"custom\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Custom {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				if err := fastjson.Marshal(w, v); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		w.RawByte('}')
+	}
+	if v.Labels != nil {
+		const prefix = ",\"tags\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Labels {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				if err := fastjson.Marshal(w, v); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		w.RawByte('}')
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *OTel) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	first := true
+	if v.Attributes != nil {
+		const prefix = ",\"attributes\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Attributes {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				if err := fastjson.Marshal(w, v); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		w.RawByte('}')
+	}
+	if v.SpanKind != "" {
+		const prefix = ",\"span_kind\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.SpanKind)
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *Link) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	w.RawString("\"span_id\":")
+	w.String(v.SpanID)
+	w.RawString(",\"trace_id\":")
+	w.String(v.TraceID)
+	w.RawByte('}')
+	return nil
+}
+
+func (v *ErrorContainer) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	if v.Error != nil {
+		w.RawString("\"error\":")
+		if err := v.Error.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *Error) MarshalFastJSON(w *fastjson.Writer) error {
+	var firstErr error
+	w.RawByte('{')
+	w.RawString("\"id\":")
+	w.String(v.ID)
+	w.RawString(",\"timestamp\":")
+	if err := v.Timestamp.MarshalFastJSON(w); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if v.Context != nil {
+		w.RawString(",\"context\":")
+		if err := v.Context.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.Culprit != "" {
+		w.RawString(",\"culprit\":")
+		w.String(v.Culprit)
+	}
+	if v.Exception != nil {
+		w.RawString(",\"exception\":")
+		if err := v.Exception.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.Log != nil {
+		w.RawString(",\"log\":")
+		if err := v.Log.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.ParentID != "" {
+		w.RawString(",\"parent_id\":")
+		w.String(v.ParentID)
+	}
+	if v.TraceID != "" {
+		w.RawString(",\"trace_id\":")
+		w.String(v.TraceID)
+	}
+	if v.Transaction != nil {
+		w.RawString(",\"transaction\":")
+		if err := v.Transaction.MarshalFastJSON(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v.TransactionID != "" {
+		w.RawString(",\"transaction_id\":")
+		w.String(v.TransactionID)
+	}
+	w.RawByte('}')
+	return firstErr
+}
+
+func (v *Exception) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	first := true
+	if v.Handled != nil {
+		const prefix = ",\"handled\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.Bool(*v.Handled)
+	}
+	if v.Message != "" {
+		const prefix = ",\"message\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.Message)
+	}
+	if v.Type != "" {
+		const prefix = ",\"type\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.Type)
+	}
+	w.RawByte('}')
+	return nil
+}
+
+func (v *ErrorLog) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	w.RawString("\"message\":")
+	w.String(v.Message)
+	if v.Level != "" {
+		w.RawString(",\"level\":")
+		w.String(v.Level)
+	}
+	w.RawByte('}')
+	return nil
+}
+
+func (v *ErrorTransaction) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	w.RawString("\"sampled\":")
+	w.Bool(v.Sampled)
+	if v.Name != "" {
+		w.RawString(",\"name\":")
+		w.String(v.Name)
+	}
+	if v.Type != "" {
+		w.RawString(",\"type\":")
+		w.String(v.Type)
+	}
+	w.RawByte('}')
+	return nil
+}
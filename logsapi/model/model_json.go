@@ -45,12 +45,68 @@ func (v *LogLine) MarshalFastJSON(w *fastjson.Writer) error {
 	}
 	w.RawString(",\"message\":")
 	w.String(v.Message)
+	if v.ErrorMessage != "" {
+		w.RawString(",\"error.message\":")
+		w.String(v.ErrorMessage)
+	}
+	if v.ErrorStackTrace != "" {
+		w.RawString(",\"error.stack_trace\":")
+		w.String(v.ErrorStackTrace)
+	}
+	if v.ErrorType != "" {
+		w.RawString(",\"error.type\":")
+		w.String(v.ErrorType)
+	}
+	if v.Original != "" {
+		w.RawString(",\"event.original\":")
+		w.String(v.Original)
+	}
 	if v.FAAS != nil {
 		w.RawString(",\"faas\":")
 		if err := v.FAAS.MarshalFastJSON(w); err != nil && firstErr == nil {
 			firstErr = err
 		}
 	}
+	if v.Labels != nil {
+		w.RawString(",\"labels\":")
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Labels {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				if err := fastjson.Marshal(w, v); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		w.RawByte('}')
+	}
+	if v.Level != "" {
+		w.RawString(",\"log.level\":")
+		w.String(v.Level)
+	}
+	if v.Logger != "" {
+		w.RawString(",\"log.logger\":")
+		w.String(v.Logger)
+	}
+	if v.SpanID != "" {
+		w.RawString(",\"span.id\":")
+		w.String(v.SpanID)
+	}
+	if v.TraceID != "" {
+		w.RawString(",\"trace.id\":")
+		w.String(v.TraceID)
+	}
+	if v.TransactionID != "" {
+		w.RawString(",\"transaction.id\":")
+		w.String(v.TransactionID)
+	}
 	w.RawByte('}')
 	return firstErr
 }
@@ -128,30 +184,73 @@ func (v *Metrics) MarshalFastJSON(w *fastjson.Writer) error {
 		}
 		w.RawByte('}')
 	}
+	if v.Labels != nil {
+		w.RawString(",\"tags\":")
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Labels {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				if err := fastjson.Marshal(w, v); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		w.RawByte('}')
+	}
 	w.RawByte('}')
 	return firstErr
 }
 
 func (v *ExtendedFAAS) MarshalFastJSON(w *fastjson.Writer) error {
 	w.RawByte('{')
-	w.RawString("\"coldstart\":")
-	w.Bool(v.Coldstart)
+	first := true
+	if v.Coldstart != nil {
+		const prefix = ",\"coldstart\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.Bool(*v.Coldstart)
+	}
 	if v.Execution != "" {
-		w.RawString(",\"execution\":")
+		const prefix = ",\"execution\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
 		w.String(v.Execution)
 	}
 	if v.ID != "" {
-		w.RawString(",\"id\":")
+		const prefix = ",\"id\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
 		w.String(v.ID)
 	}
-	w.RawByte('}')
-	return nil
-}
-
-func (v *Metric) MarshalFastJSON(w *fastjson.Writer) error {
-	w.RawByte('{')
-	w.RawString("\"value\":")
-	w.Float64(v.Value)
+	if v.Name != "" {
+		const prefix = ",\"name\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.Name)
+	}
 	w.RawByte('}')
 	return nil
 }
@@ -0,0 +1,197 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default bounds of the groups of function log lines.
+const (
+	DefaultMultilineMaxLines    = 500
+	DefaultMultilineMaxDuration = 5 * time.Second
+)
+
+// multilineSpeculativeWait is how long a line that may start a group,
+// as it follows a pattern without start, is held for a continuation
+// line. It is twice the buffering timeout of the subscription, so the
+// lines of a stack trace written at once arrive within it.
+const multilineSpeculativeWait = 200 * time.Millisecond
+
+// MultilinePattern describes how function log lines are grouped into a
+// single log event.
+//
+// If Start is nil any line can start a group, and the following lines
+// matching Continuation are added to it. If Start is set a group is only
+// started by a line matching Start; the following lines are added to it
+// if they match Continuation or, if Continuation is nil, as long as they
+// don't match Start.
+type MultilinePattern struct {
+	Start        *regexp.Regexp
+	Continuation *regexp.Regexp
+}
+
+// builtinMultilinePatterns group the stack traces of the common
+// Lambda runtimes.
+var builtinMultilinePatterns = []MultilinePattern{
+	// Java and Node.js stack traces.
+	{
+		Continuation: regexp.MustCompile(`^\s+(at\s|\.\.\.\s\d+\s)|^(Caused by|\s+Suppressed):`),
+	},
+	// Python tracebacks.
+	{
+		Start:        regexp.MustCompile(`^Traceback \(most recent call last\):`),
+		Continuation: regexp.MustCompile(`^(\s|$)|^[\w.]+(Error|Exception|Warning|Exit|Interrupt)\b|^(During handling of|The above exception)|^Traceback `),
+	},
+	// Go panics.
+	{
+		Start:        regexp.MustCompile(`^(panic: |fatal error: )`),
+		Continuation: regexp.MustCompile(`^(\s|$)|^goroutine \d+ \[|^\S+\(.*\)$|^created by |^\[signal |^exit status `),
+	},
+}
+
+func (p *MultilinePattern) continues(line string) bool {
+	switch {
+	case p.Continuation != nil:
+		return p.Continuation.MatchString(line)
+	case p.Start != nil:
+		return !p.Start.MatchString(line)
+	}
+	return false
+}
+
+// multilineAggregator groups consecutive function log events. A group is
+// bounded by a number of lines and by the time elapsed since its first
+// line.
+type multilineAggregator struct {
+	mu          sync.Mutex
+	patterns    []MultilinePattern
+	maxLines    int
+	maxDuration time.Duration
+
+	pending      *LogEvent
+	pendingLines int
+	candidates   []*MultilinePattern
+	// started is when the pending group was started, and speculative
+	// is true while the group holds a single line that only patterns
+	// without start may continue, as any line may start such a group.
+	started     time.Time
+	speculative bool
+}
+
+func newMultilineAggregator(maxLines int, maxDuration time.Duration, patterns []MultilinePattern) *multilineAggregator {
+	a := &multilineAggregator{
+		maxLines:    maxLines,
+		maxDuration: maxDuration,
+	}
+	all := append(append([]MultilinePattern{}, patterns...), builtinMultilinePatterns...)
+	for _, p := range all {
+		if p.Start != nil || p.Continuation != nil {
+			a.patterns = append(a.patterns, p)
+		}
+	}
+	return a
+}
+
+// add adds a function log event and returns the log events whose group
+// is complete.
+func (a *multilineAggregator) add(event LogEvent) []LogEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	line := strings.TrimRight(event.StringRecord, "\r\n")
+	if a.pending != nil && a.continues(line, event.Time) {
+		a.pending.StringRecord += "\n" + line
+		a.pendingLines++
+		return nil
+	}
+
+	completed := a.flushLocked()
+	a.candidates = a.candidatesFor(line)
+	if len(a.candidates) == 0 {
+		return append(completed, event)
+	}
+	event.StringRecord = line
+	a.pending, a.pendingLines = &event, 1
+	a.started = time.Now()
+	a.speculative = a.candidates[0].Start == nil
+	return completed
+}
+
+// timeout returns how long after now the pending group is due, and
+// false if there is no pending group. A speculative group is due
+// quickly, so that lines without continuation are not delayed.
+func (a *multilineAggregator) timeout(now time.Time) (time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending == nil {
+		return 0, false
+	}
+	wait := a.maxDuration
+	if a.speculative && a.pendingLines == 1 && multilineSpeculativeWait < wait {
+		wait = multilineSpeculativeWait
+	}
+	return max(0, a.started.Add(wait).Sub(now)), true
+}
+
+// flush returns the pending log event, if any.
+func (a *multilineAggregator) flush() []LogEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flushLocked()
+}
+
+func (a *multilineAggregator) flushLocked() []LogEvent {
+	if a.pending == nil {
+		return nil
+	}
+	event := *a.pending
+	a.pending, a.pendingLines, a.candidates = nil, 0, nil
+	return []LogEvent{event}
+}
+
+func (a *multilineAggregator) continues(line string, ts time.Time) bool {
+	if a.pendingLines >= a.maxLines || ts.Sub(a.pending.Time) > a.maxDuration {
+		return false
+	}
+	for _, p := range a.candidates {
+		if p.continues(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidatesFor returns the patterns a group started by line can follow.
+// A matching start pattern takes precedence over the patterns without
+// start.
+func (a *multilineAggregator) candidatesFor(line string) []*MultilinePattern {
+	var candidates []*MultilinePattern
+	for i := range a.patterns {
+		p := &a.patterns[i]
+		if p.Start == nil {
+			candidates = append(candidates, p)
+		} else if p.Start.MatchString(line) {
+			return []*MultilinePattern{p}
+		}
+	}
+	return candidates
+}
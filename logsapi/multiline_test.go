@@ -0,0 +1,223 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestMultilineAggregator(t *testing.T) {
+	testCases := map[string]struct {
+		patterns []MultilinePattern
+		lines    []string
+		expected []string
+	}{
+		"java": {
+			lines: []string{
+				"Processing order",
+				"java.lang.IllegalStateException: boom",
+				"\tat com.example.Handler.handleRequest(Handler.java:12)",
+				"\tat java.base/java.lang.Thread.run(Thread.java:833)",
+				"Caused by: java.io.IOException: closed",
+				"\t... 2 more",
+				"Done",
+			},
+			expected: []string{
+				"Processing order",
+				"java.lang.IllegalStateException: boom\n\tat com.example.Handler.handleRequest(Handler.java:12)\n\tat java.base/java.lang.Thread.run(Thread.java:833)\nCaused by: java.io.IOException: closed\n\t... 2 more",
+				"Done",
+			},
+		},
+		"nodejs": {
+			lines: []string{
+				"Error: boom",
+				"    at handler (/var/task/index.js:3:9)",
+				"    at Runtime.handleOnceNonStreaming (file:///var/runtime/index.mjs:1:1)",
+			},
+			expected: []string{
+				"Error: boom\n    at handler (/var/task/index.js:3:9)\n    at Runtime.handleOnceNonStreaming (file:///var/runtime/index.mjs:1:1)",
+			},
+		},
+		"python": {
+			lines: []string{
+				"Traceback (most recent call last):",
+				`  File "/var/task/app.py", line 3, in handler`,
+				"    raise ValueError('boom')",
+				"ValueError: boom",
+				"next line",
+			},
+			expected: []string{
+				"Traceback (most recent call last):\n  File \"/var/task/app.py\", line 3, in handler\n    raise ValueError('boom')\nValueError: boom",
+				"next line",
+			},
+		},
+		"go": {
+			lines: []string{
+				"panic: boom",
+				"",
+				"goroutine 1 [running]:",
+				"main.handler(...)",
+				"\t/var/task/main.go:10 +0x27",
+				"created by main.main",
+				"next line",
+			},
+			expected: []string{
+				"panic: boom\n\ngoroutine 1 [running]:\nmain.handler(...)\n\t/var/task/main.go:10 +0x27\ncreated by main.main",
+				"next line",
+			},
+		},
+		"user defined start": {
+			patterns: []MultilinePattern{{Start: regexp.MustCompile(`^\[\d{4}-`)}},
+			lines: []string{
+				"[2022-11-12] first",
+				"detail",
+				"[2022-11-12] second",
+			},
+			expected: []string{
+				"[2022-11-12] first\ndetail",
+				"[2022-11-12] second",
+			},
+		},
+		"user defined continuation": {
+			patterns: []MultilinePattern{{Continuation: regexp.MustCompile(`^\+`)}},
+			lines: []string{
+				"query",
+				"+ where",
+				"+ limit",
+			},
+			expected: []string{
+				"query\n+ where\n+ limit",
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			a := newMultilineAggregator(DefaultMultilineMaxLines, DefaultMultilineMaxDuration, tc.patterns)
+			ts := time.Now()
+			var got []string
+			for _, line := range tc.lines {
+				for _, e := range a.add(LogEvent{Time: ts, Type: FunctionLog, StringRecord: line + "\n"}) {
+					got = append(got, e.StringRecord)
+				}
+			}
+			for _, e := range a.flush() {
+				got = append(got, e.StringRecord)
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestMultilineAggregatorBounds(t *testing.T) {
+	ts := time.Now()
+	stackLine := LogEvent{Time: ts, Type: FunctionLog, StringRecord: "\tat Handler.java"}
+
+	a := newMultilineAggregator(3, time.Second, nil)
+	assert.Empty(t, a.add(LogEvent{Time: ts, Type: FunctionLog, StringRecord: "Exception"}))
+	assert.Empty(t, a.add(stackLine))
+	assert.Empty(t, a.add(stackLine))
+	completed := a.add(stackLine)
+	require.Len(t, completed, 1)
+	assert.Equal(t, 3, strings.Count(completed[0].StringRecord, "\n")+1)
+
+	a = newMultilineAggregator(10, time.Second, nil)
+	assert.Empty(t, a.add(LogEvent{Time: ts, Type: FunctionLog, StringRecord: "Exception"}))
+	stackLine.Time = ts.Add(2 * time.Second)
+	completed = a.add(stackLine)
+	require.Len(t, completed, 1)
+	assert.Equal(t, "Exception", completed[0].StringRecord)
+}
+
+func TestProcessLogsFlushesMultiline(t *testing.T) {
+	c, batch := newTestClient(t, WithMultilineGrouping(DefaultMultilineMaxLines, DefaultMultilineMaxDuration))
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+
+	ts := time.Now()
+	for _, line := range []string{"Error: boom", "    at handler (/var/task/index.js:3:9)"} {
+		c.logsChannel <- LogEvent{Time: ts, Type: FunctionLog, StringRecord: line}
+	}
+	c.logsChannel <- LogEvent{
+		Time:   ts,
+		Type:   PlatformRuntimeDone,
+		Record: LogEventRecord{RequestID: "req-1", Status: "success"},
+	}
+
+	var forwarded [][]byte
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, false)
+
+	require.Len(t, forwarded, 1)
+	assert.Equal(t, "Error: boom\n    at handler (/var/task/index.js:3:9)", gjson.GetBytes(forwarded[0], "log.message").String())
+}
+
+func TestMultilineAggregatorTimeout(t *testing.T) {
+	now := time.Now()
+	a := newMultilineAggregator(DefaultMultilineMaxLines, time.Second, nil)
+	_, ok := a.timeout(time.Now())
+	assert.False(t, ok)
+
+	// Any line may start a Java stack trace, it is held shortly.
+	a.add(LogEvent{Time: now, Type: FunctionLog, StringRecord: "Exception"})
+	d, ok := a.timeout(time.Now())
+	require.True(t, ok)
+	assert.LessOrEqual(t, d, multilineSpeculativeWait)
+
+	// A continuation line confirms the group.
+	a.add(LogEvent{Time: now, Type: FunctionLog, StringRecord: "\tat Handler.java"})
+	d, ok = a.timeout(time.Now())
+	require.True(t, ok)
+	assert.Greater(t, d, multilineSpeculativeWait)
+
+	// A line matching a start pattern is held up to the maximum duration.
+	a.flush()
+	a.add(LogEvent{Time: now, Type: FunctionLog, StringRecord: "Traceback (most recent call last):"})
+	d, ok = a.timeout(time.Now())
+	require.True(t, ok)
+	assert.Greater(t, d, multilineSpeculativeWait)
+}
+
+func TestProcessLogsMultilineTimeout(t *testing.T) {
+	c, batch := newTestClient(t, WithMultilineGrouping(DefaultMultilineMaxLines, 50*time.Millisecond))
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+	c.logsChannel <- LogEvent{Time: time.Now(), Type: FunctionLog, StringRecord: "Traceback (most recent call last):"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	forwarded := make(chan []byte, 1)
+	go c.ProcessLogs(ctx, "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded <- b
+		return nil
+	}, false)
+
+	select {
+	case b := <-forwarded:
+		assert.Equal(t, "Traceback (most recent call last):", gjson.GetBytes(b, "log.message").String())
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the pending group")
+	}
+}
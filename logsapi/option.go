@@ -18,6 +18,10 @@
 package logsapi
 
 import (
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
 	"go.uber.org/zap"
 )
 
@@ -65,3 +69,131 @@ func WithInvocationLifecycler(l invocationLifecycler) ClientOption {
 		c.invocationLifecycler = l
 	}
 }
+
+// WithSelfMonitor configures the monitor recording the self-monitoring
+// metrics of the client.
+func WithSelfMonitor(monitor *selfmonitor.Monitor) ClientOption {
+	return func(c *Client) {
+		c.monitor = monitor
+	}
+}
+
+// WithRecorder configures the recorder of the log events pushed by the
+// Logs or Telemetry API.
+func WithRecorder(rec *recorder.Recorder) ClientOption {
+	return func(c *Client) {
+		c.recorder = rec
+	}
+}
+
+// WithMetricsCollector adds a collector whose metrics are flushed when
+// the runtime of an invocation is done.
+func WithMetricsCollector(mc MetricsCollector) ClientOption {
+	return func(c *Client) {
+		c.metricsCollectors = append(c.metricsCollectors, mc)
+	}
+}
+
+// WithEMFLogForwarding sets whether the function log lines written in the
+// CloudWatch Embedded Metric Format are forwarded as logs in addition to
+// the metricsets extracted from them.
+func WithEMFLogForwarding(forward bool) ClientOption {
+	return func(c *Client) {
+		c.forwardEMFLogs = forward
+	}
+}
+
+// WithMultilineGrouping enables the grouping of consecutive function log
+// lines, such as stack traces, into a single log event. A group contains
+// at most maxLines lines, spanning at most maxDuration.
+func WithMultilineGrouping(maxLines int, maxDuration time.Duration) ClientOption {
+	return func(c *Client) {
+		c.multilineEnabled = true
+		c.multilineMaxLines = maxLines
+		c.multilineMaxDuration = maxDuration
+	}
+}
+
+// WithMultilinePattern adds a user defined pattern for the multiline
+// grouping of function log lines. User defined patterns take precedence
+// over the built-in patterns.
+func WithMultilinePattern(p MultilinePattern) ClientOption {
+	return func(c *Client) {
+		c.multilinePatterns = append(c.multilinePatterns, p)
+	}
+}
+
+// WithMinimumLogLevel sets the minimum level of the function log lines to
+// forward. Log lines without a known level are always forwarded.
+func WithMinimumLogLevel(level string) ClientOption {
+	return func(c *Client) {
+		c.minLogLevel = level
+	}
+}
+
+// WithInvocationLogLimits caps the number of function log lines and bytes
+// forwarded per invocation. A zero value disables the corresponding cap.
+func WithInvocationLogLimits(maxLines, maxBytes int) ClientOption {
+	return func(c *Client) {
+		c.logMaxLines = maxLines
+		c.logMaxBytes = maxBytes
+	}
+}
+
+// WithLogSampling forwards one out of every n function log lines once the
+// invocation log limits are reached, instead of suppressing all of them.
+func WithLogSampling(n int) ClientOption {
+	return func(c *Client) {
+		c.logSampleEvery = n
+	}
+}
+
+// WithErrorLogLimit sets the number of error level function log lines
+// that are forwarded per invocation once the log limits are reached.
+func WithErrorLogLimit(maxLines int) ClientOption {
+	return func(c *Client) {
+		c.logMaxErrorLines = maxLines
+	}
+}
+
+// WithTelemetryAPI sets whether the client subscribes to the Telemetry API
+// before falling back to the Logs API. It is enabled by default.
+func WithTelemetryAPI(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.telemetryAPIEnabled = enabled
+	}
+}
+
+// WithExtensionStartTime sets the time the extension process started, to
+// report the extension initialization in the init transaction.
+func WithExtensionStartTime(t time.Time) ClientOption {
+	return func(c *Client) {
+		c.extensionInit.start = t
+	}
+}
+
+// WithExtensionName sets the name of this extension. The log lines written
+// by this extension are not forwarded when subscribed to the extension log
+// stream.
+func WithExtensionName(name string) ClientOption {
+	return func(c *Client) {
+		c.extensionName = name
+	}
+}
+
+// WithMetricsAggregation enables the aggregation of the platform metrics
+// of the invocations into histograms and counters per function version,
+// flushed on the given interval and at shutdown.
+func WithMetricsAggregation(interval time.Duration) ClientOption {
+	return func(c *Client) {
+		c.aggregationInterval = interval
+	}
+}
+
+// WithInvocationMetrics sets whether a metricset is forwarded for the
+// platform.report event of every invocation. It is enabled by default.
+func WithInvocationMetrics(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.invocationMetrics = enabled
+	}
+}
@@ -0,0 +1,159 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
+	"go.elastic.co/fastjson"
+)
+
+// faultRequestID matches the request ID platform.fault records start with,
+// for example `RequestId: 6f7f0961-... Process exited before completing request`.
+var faultRequestID = regexp.MustCompile(`^RequestId:\s*(\S+)\s*`)
+
+// ProcessPlatformFault processes the `platform.fault` log line from lambda logs API and
+// returns a byte array containing the JSON body of an error event. The error is tied to
+// the given trace and transaction IDs, if any. A non nil error is returned when marshaling
+// of the error into JSON fails.
+func ProcessPlatformFault(requestID, invokedFnArn, traceID, transactionID string, fault LogEvent) ([]byte, error) {
+	message := strings.TrimSpace(fault.StringRecord)
+	if m := faultRequestID.FindStringSubmatch(message); m != nil {
+		message = strings.TrimSpace(message[len(m[0]):])
+	}
+	if message == "" {
+		message = string(PlatformFault)
+	}
+
+	handled := false
+	e := &model.Error{
+		ID:        model.NewID(16),
+		TraceID:   traceID,
+		Timestamp: model.Time(fault.Time),
+		Culprit:   string(PlatformFault),
+		Exception: &model.Exception{
+			Message: message,
+			Type:    string(PlatformFault),
+			Handled: &handled,
+		},
+		Context: &model.Context{
+			Labels: model.Labels{
+				"faas_execution": requestID,
+				"faas_id":        invokedFnArn,
+			},
+		},
+	}
+	if transactionID != "" {
+		e.TransactionID = transactionID
+		e.ParentID = transactionID
+		e.Transaction = &model.ErrorTransaction{Sampled: true}
+	}
+
+	var jsonWriter fastjson.Writer
+	if err := (&model.ErrorContainer{Error: e}).MarshalFastJSON(&jsonWriter); err != nil {
+		return nil, err
+	}
+	return jsonWriter.Bytes(), nil
+}
+
+// ProcessLogsDropped processes the `platform.logsDropped` log line from lambda logs API
+// and returns a byte array containing the JSON body of a metricset with the number of
+// dropped records and bytes. A non nil error is returned when marshaling of the metrics
+// into JSON fails.
+func ProcessLogsDropped(invokedFnArn string, logsDropped LogEvent) ([]byte, error) {
+	metricsContainer := model.MetricsContainer{
+		Metrics: &model.Metrics{
+			Timestamp: model.Time(logsDropped.Time),
+			FAAS:      &model.ExtendedFAAS{ID: invokedFnArn},
+		},
+	}
+	metricsContainer.Add("faas.logs_dropped.records", float64(logsDropped.Record.DroppedRecords))
+	metricsContainer.Add("faas.logs_dropped.bytes", float64(logsDropped.Record.DroppedBytes)) // Unit : Bytes
+	if reason := logsDropped.Record.Reason; reason != "" {
+		metricsContainer.Metrics.Labels = model.Labels{"reason": reason}
+	}
+
+	var jsonWriter fastjson.Writer
+	if err := metricsContainer.MarshalFastJSON(&jsonWriter); err != nil {
+		return nil, err
+	}
+	return jsonWriter.Bytes(), nil
+}
+
+// handlePlatformFault forwards a platform.fault event as an error tied to
+// the transaction of the faulted request.
+func (lc *Client) handlePlatformFault(ctx context.Context, logEvent LogEvent, requestID, invokedFnArn string, forwardFn Forwarder) {
+	if m := faultRequestID.FindStringSubmatch(strings.TrimSpace(logEvent.StringRecord)); m != nil {
+		requestID = m[1]
+	} else if logEvent.Record.RequestID != "" {
+		requestID = logEvent.Record.RequestID
+	}
+	traceID, transactionID := lc.invocationLifecycler.TraceContext(requestID)
+	processedFault, err := ProcessPlatformFault(requestID, invokedFnArn, traceID, transactionID, logEvent)
+	if err != nil {
+		lc.logger.Errorf("Error processing Lambda platform fault: %v", err)
+		return
+	}
+	if err := forwardFn(ctx, processedFault); err != nil {
+		lc.logger.Errorf("Error forwarding Lambda platform fault: %v", err)
+	}
+}
+
+// handleLogsDropped forwards a platform.logsDropped event as a metricset.
+func (lc *Client) handleLogsDropped(ctx context.Context, logEvent LogEvent, invokedFnArn string, forwardFn Forwarder) {
+	lc.monitor.Add(selfmonitor.LogEventsPlatformDropped, float64(logEvent.Record.DroppedRecords))
+	processedMetrics, err := ProcessLogsDropped(invokedFnArn, logEvent)
+	if err != nil {
+		lc.logger.Errorf("Error processing Lambda dropped logs metrics: %v", err)
+		return
+	}
+	if err := forwardFn(ctx, processedMetrics); err != nil {
+		lc.logger.Errorf("Error forwarding Lambda dropped logs metrics: %v", err)
+	}
+}
+
+// runtimeFailed returns true for the statuses of invocations that failed
+// because of the runtime. Timeouts are reported when the invocation is
+// finalized.
+func runtimeFailed(status string) bool {
+	return status == "error" || status == "failure"
+}
+
+// handleRuntimeFailure reports the invocation of a platform.report event
+// as a runtime failure if its status, or the status of its
+// platform.runtimeDone event, is a failure. The memory figures of the
+// report tell apart the runtimes killed for running out of memory.
+func (lc *Client) handleRuntimeFailure(logEvent LogEvent) {
+	if !runtimeFailed(logEvent.Record.Status) {
+		return
+	}
+	if err := lc.invocationLifecycler.OnRuntimeFailure(logEvent.Record.RequestID, accumulator.RuntimeFailure{
+		Status:          logEvent.Record.Status,
+		ErrorType:       logEvent.Record.ErrorType,
+		Time:            logEvent.Time,
+		MaxMemoryUsedMB: int(logEvent.Record.Metrics.MaxMemoryUsedMB),
+		MemorySizeMB:    int(logEvent.Record.Metrics.MemorySizeMB),
+	}); err != nil {
+		lc.logger.Warnf("Failed to report runtime failure for request ID %s: %v", logEvent.Record.RequestID, err)
+	}
+}
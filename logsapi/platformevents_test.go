@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logsapi
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestProcessLogsPlatformFault(t *testing.T) {
+	c, batch := newTestClient(t)
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+	require.NoError(t, batch.OnAgentInit("req-1", "", []byte(`{"transaction":{"id":"023d90ff77f13b9f","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`)))
+
+	var event LogEvent
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"time": "2022-10-12T00:00:15.064Z",
+		"type": "platform.fault",
+		"record": "RequestId: req-1 Process exited before completing request"
+	}`), &event))
+	c.logsChannel <- event
+	c.logsChannel <- LogEvent{
+		Time:   event.Time,
+		Type:   PlatformRuntimeDone,
+		Record: LogEventRecord{RequestID: "req-1", Status: "failure"},
+	}
+
+	var forwarded [][]byte
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(_ context.Context, b []byte) error {
+		forwarded = append(forwarded, b)
+		return nil
+	}, false)
+
+	require.Len(t, forwarded, 1)
+	e := gjson.GetBytes(forwarded[0], "error")
+	assert.Equal(t, "Process exited before completing request", e.Get("exception.message").String())
+	assert.Equal(t, "platform.fault", e.Get("exception.type").String())
+	assert.False(t, e.Get("exception.handled").Bool())
+	assert.Equal(t, event.Time.UnixMicro(), e.Get("timestamp").Int())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", e.Get("trace_id").String())
+	assert.Equal(t, "023d90ff77f13b9f", e.Get("transaction_id").String())
+	assert.Equal(t, "023d90ff77f13b9f", e.Get("parent_id").String())
+	assert.True(t, e.Get("transaction.sampled").Bool())
+	assert.Equal(t, "req-1", e.Get("context.tags.faas_execution").String())
+}
+
+func TestProcessLogsRuntimeFailure(t *testing.T) {
+	c, batch := newTestClient(t)
+	batch.RegisterInvocation("req-1", "arn", time.Now().Add(time.Minute).UnixMilli(), time.Now())
+	require.NoError(t, batch.OnAgentInit("req-1", "", []byte(
+		`{"metadata":{"service":{"name":"test"}}}`+"\n"+
+			`{"transaction":{"id":"023d90ff77f13b9f","trace_id":"0af7651916cd43dd8448eb211c80319c"}}`,
+	)))
+
+	ts := time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC)
+	c.logsChannel <- LogEvent{
+		Time:   ts,
+		Type:   PlatformRuntimeDone,
+		Record: LogEventRecord{RequestID: "req-1", Status: "error", ErrorType: "Runtime.ExitError"},
+	}
+	c.logsChannel <- LogEvent{
+		Time: ts.Add(time.Millisecond),
+		Type: PlatformReport,
+		Record: LogEventRecord{RequestID: "req-1", Metrics: PlatformMetrics{
+			DurationMs:      1500,
+			MemorySizeMB:    128,
+			MaxMemoryUsedMB: 128,
+		}},
+	}
+	c.ProcessLogs(context.Background(), "req-1", "arn", func(context.Context, []byte) error { return nil }, true)
+
+	lines := strings.Split(string(batch.ToAPMData().Data), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "failure", gjson.Get(lines[1], "transaction.outcome").String())
+	e := gjson.Get(lines[2], "error")
+	assert.Equal(t, "Runtime.OutOfMemory", e.Get("exception.type").String())
+	assert.Equal(t, "Runtime exited after running out of memory: 128 MB used of 128 MB", e.Get("exception.message").String())
+	assert.Equal(t, ts.Add(time.Millisecond).UnixMicro(), e.Get("timestamp").Int())
+	assert.Equal(t, "023d90ff77f13b9f", e.Get("transaction_id").String())
+	assert.Equal(t, int64(128), e.Get("context.tags.faas_memory_used_mb").Int())
+	assert.Equal(t, int64(128), e.Get("context.tags.faas_memory_size_mb").Int())
+}
+
+func TestProcessLogsDropped(t *testing.T) {
+	var event LogEvent
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"time": "2022-10-12T00:00:15.064Z",
+		"type": "platform.logsDropped",
+		"record": {
+			"reason": "Consumer seems to have fallen behind as it has not acknowledged receipt of logs.",
+			"droppedRecords": 123,
+			"droppedBytes": 12345
+		}
+	}`), &event))
+
+	data, err := ProcessLogsDropped("arn", event)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"metricset":{
+		"timestamp": 1665532815064000,
+		"faas": {"id": "arn"},
+		"samples": {
+			"faas.logs_dropped.records": {"value": 123},
+			"faas.logs_dropped.bytes": {"value": 12345}
+		},
+		"tags": {"reason": "Consumer seems to have fallen behind as it has not acknowledged receipt of logs."}
+	}}`, string(data))
+}
@@ -18,17 +18,36 @@
 package logsapi
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"time"
 
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/elastic/apm-aws-lambda/selfmonitor"
 	"go.uber.org/zap"
 )
 
-func handleLogEventsRequest(logger *zap.SugaredLogger, logsChannel chan LogEvent) func(w http.ResponseWriter, r *http.Request) {
+func handleLogEventsRequest(logger *zap.SugaredLogger, monitor *selfmonitor.Monitor, rec *recorder.Recorder, logsChannel chan LogEvent) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if rec != nil {
+			// The body is buffered only to be recorded.
+			raw, err := io.ReadAll(r.Body)
+			if err != nil {
+				logger.Errorf("Error reading log events: %+v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if err := rec.RecordRequest(recorder.LogsPush, r, raw); err != nil {
+				logger.Warnf("Failed to record log events: %v", err)
+			}
+			body = bytes.NewReader(raw)
+		}
+
 		var logEvents []LogEvent
-		if err := json.NewDecoder(r.Body).Decode(&logEvents); err != nil {
+		if err := json.NewDecoder(body).Decode(&logEvents); err != nil {
 			logger.Errorf("Error unmarshalling log events: %+v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -42,8 +61,10 @@ func handleLogEventsRequest(logger *zap.SugaredLogger, logsChannel chan LogEvent
 			}
 			select {
 			case logsChannel <- logEvents[idx]:
+				monitor.Inc(selfmonitor.LogEventsReceived)
 			case <-r.Context().Done():
 				logger.Warnf("Failed to enqueue event, signaling lambda to retry")
+				monitor.Add(selfmonitor.LogEventsRejected, float64(len(logEvents)-idx))
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
@@ -64,11 +85,16 @@ func (le *LogEvent) UnmarshalJSON(data []byte) error {
 	le.Time = b.Time
 	le.Type = b.Type
 
-	if len(b.Record) > 0 && b.Record[0] == '{' {
+	isLogLine := b.Type == FunctionLog || b.Type == ExtensionLog
+	switch {
+	case len(b.Record) > 0 && b.Record[0] == '{' && isLogLine:
+		// Log lines written in the JSON log format are sent as objects.
+		le.StringRecord = string(b.Record)
+	case len(b.Record) > 0 && b.Record[0] == '{':
 		if err := json.Unmarshal(b.Record, &(le.Record)); err != nil {
 			return err
 		}
-	} else {
+	default:
 		if err := json.Unmarshal(b.Record, &(le.StringRecord)); err != nil {
 			return err
 		}
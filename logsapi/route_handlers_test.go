@@ -135,3 +135,84 @@ func Test_unmarshalRuntimeDoneFaultRecordString(t *testing.T) {
 	assert.Equal(t, PlatformFault, le.Type)
 	assert.Equal(t, "Unknown application error occurred", le.StringRecord)
 }
+
+func TestLogEventUnmarshalTelemetryRuntimeDone(t *testing.T) {
+	le := new(LogEvent)
+	jsonBytes := []byte(`{
+		"time": "2022-10-12T00:01:15.000Z",
+		"type": "platform.runtimeDone",
+		"record": {
+			"requestId": "6d68ca91-49c9-448d-89b8-7ca3e6dc66aa",
+			"status": "error",
+			"errorType": "Runtime.ExitError",
+			"tracing": {
+				"spanId": "54565fb41ac79632",
+				"type": "X-Amzn-Trace-Id",
+				"value": "Root=1-62e900b2-710d76f009d6e7785905449a;Parent=0efbd19962d95b05;Sampled=1"
+			},
+			"spans": [{"name": "responseLatency", "start": "2022-10-12T00:01:00.000Z", "durationMs": 23.02}],
+			"metrics": {"durationMs": 200.0, "producedBytes": 1000}
+		}
+	}`)
+
+	require.NoError(t, le.UnmarshalJSON(jsonBytes))
+	assert.Equal(t, PlatformRuntimeDone, le.Type)
+	producedBytes := int64(1000)
+	assert.Equal(t, LogEventRecord{
+		RequestID: "6d68ca91-49c9-448d-89b8-7ca3e6dc66aa",
+		Status:    "error",
+		ErrorType: "Runtime.ExitError",
+		Metrics:   PlatformMetrics{DurationMs: 200, ProducedBytes: &producedBytes},
+		Tracing: &TracingRecord{
+			SpanID: "54565fb41ac79632",
+			Type:   "X-Amzn-Trace-Id",
+			Value:  "Root=1-62e900b2-710d76f009d6e7785905449a;Parent=0efbd19962d95b05;Sampled=1",
+		},
+		Spans: []SpanRecord{{
+			Name:       "responseLatency",
+			Start:      time.Date(2022, 10, 12, 0, 1, 0, 0, time.UTC),
+			DurationMs: 23.02,
+		}},
+	}, le.Record)
+}
+
+func TestLogEventUnmarshalTelemetryInitStart(t *testing.T) {
+	le := new(LogEvent)
+	jsonBytes := []byte(`{
+		"time": "2022-10-12T00:00:15.064Z",
+		"type": "platform.initStart",
+		"record": {
+			"initializationType": "on-demand",
+			"phase": "init",
+			"runtimeVersion": "nodejs-14.v3",
+			"runtimeVersionArn": "arn",
+			"functionName": "my-function",
+			"functionVersion": "$LATEST"
+		}
+	}`)
+
+	require.NoError(t, le.UnmarshalJSON(jsonBytes))
+	assert.Equal(t, PlatformInitStart, le.Type)
+	assert.Equal(t, LogEventRecord{
+		InitializationType: "on-demand",
+		Phase:              "init",
+		RuntimeVersion:     "nodejs-14.v3",
+		RuntimeVersionArn:  "arn",
+		FunctionName:       "my-function",
+		FunctionVersion:    "$LATEST",
+	}, le.Record)
+}
+
+func TestLogEventUnmarshalJSONFunctionLog(t *testing.T) {
+	le := new(LogEvent)
+	jsonBytes := []byte(`{
+		"time": "2022-10-12T00:03:50.000Z",
+		"type": "function",
+		"record": {"timestamp": "2022-10-12T00:03:50.000Z", "level": "INFO", "requestId": "79b4f56e", "message": "hello"}
+	}`)
+
+	require.NoError(t, le.UnmarshalJSON(jsonBytes))
+	assert.Equal(t, FunctionLog, le.Type)
+	assert.Equal(t, `{"timestamp": "2022-10-12T00:03:50.000Z", "level": "INFO", "requestId": "79b4f56e", "message": "hello"}`, le.StringRecord)
+	assert.Equal(t, LogEventRecord{}, le.Record)
+}
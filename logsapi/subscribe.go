@@ -43,6 +43,10 @@ type SchemaVersion string
 const (
 	SchemaVersion20210318 = "2021-03-18"
 	SchemaVersionLatest   = SchemaVersion20210318
+
+	// TelemetrySchemaVersion20221213 is the schema version of the
+	// Telemetry API events.
+	TelemetrySchemaVersion20221213 = "2022-12-13"
 )
 
 // BufferingCfg is the configuration set for receiving logs from Logs API. Whichever of the conditions below is met first, the logs will be sent
@@ -59,8 +63,8 @@ type BufferingCfg struct {
 type Destination struct {
 	Protocol   string `json:"protocol"`
 	URI        string `json:"URI"`
-	HTTPMethod string `json:"method"`
-	Encoding   string `json:"encoding"`
+	HTTPMethod string `json:"method,omitempty"`
+	Encoding   string `json:"encoding,omitempty"`
 }
 
 func (lc *Client) startHTTPServer() (string, error) {
@@ -82,7 +86,21 @@ func (lc *Client) startHTTPServer() (string, error) {
 	return addr, nil
 }
 
+// subscribe subscribes to the Telemetry API if enabled, falling back to
+// the Logs API if the Telemetry API is not available.
 func (lc *Client) subscribe(types []SubscriptionType, extensionID, uri string) error {
+	if lc.telemetryAPIEnabled {
+		err := lc.subscribeTelemetryAPI(types, extensionID, uri)
+		if err == nil {
+			lc.logger.Info("Subscribed to the Lambda Telemetry API")
+			return nil
+		}
+		lc.logger.Warnf("Failed to subscribe to the Telemetry API, falling back to the Logs API: %v", err)
+	}
+	return lc.subscribeLogsAPI(types, extensionID, uri)
+}
+
+func (lc *Client) subscribeLogsAPI(types []SubscriptionType, extensionID, uri string) error {
 	data, err := json.Marshal(&SubscribeRequest{
 		SchemaVersion: SchemaVersionLatest,
 		LogTypes:      types,
@@ -102,7 +120,31 @@ func (lc *Client) subscribe(types []SubscriptionType, extensionID, uri string) e
 		return fmt.Errorf("failed to marshal SubscribeRequest: %w", err)
 	}
 
-	url := lc.logsAPIBaseURL + "/2020-08-15/logs"
+	return lc.sendSubscribeRequest(lc.logsAPIBaseURL+"/2020-08-15/logs", data, extensionID, "logs API")
+}
+
+func (lc *Client) subscribeTelemetryAPI(types []SubscriptionType, extensionID, uri string) error {
+	data, err := json.Marshal(&SubscribeRequest{
+		SchemaVersion: TelemetrySchemaVersion20221213,
+		LogTypes:      types,
+		BufferingCfg: BufferingCfg{
+			MaxItems:  10000,
+			MaxBytes:  1024 * 1024,
+			TimeoutMS: 100,
+		},
+		Destination: Destination{
+			Protocol: "HTTP",
+			URI:      uri,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal SubscribeRequest: %w", err)
+	}
+
+	return lc.sendSubscribeRequest(lc.logsAPIBaseURL+"/2022-07-01/telemetry", data, extensionID, "telemetry API")
+}
+
+func (lc *Client) sendSubscribeRequest(url string, data []byte, extensionID, api string) error {
 	resp, err := lc.sendRequest(url, data, extensionID)
 	if err != nil {
 		return err
@@ -110,7 +152,7 @@ func (lc *Client) subscribe(types []SubscriptionType, extensionID, uri string) e
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusAccepted {
-		return errors.New("logs API is not supported in this environment")
+		return fmt.Errorf("%s is not supported in this environment", api)
 	}
 
 	if resp.StatusCode != http.StatusOK {
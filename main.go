@@ -75,6 +75,19 @@ func mainWithError() error {
 		appConfigs = append(appConfigs, app.WithFunctionLogSubscription())
 	}
 
+	// ELASTIC_APM_LAMBDA_CAPTURE_EXTENSION_LOGS indicate if the lambda
+	// extension should capture the logs of the other extensions, the
+	// value defaults to false
+	rawCaptureExtensionLogs := os.Getenv("ELASTIC_APM_LAMBDA_CAPTURE_EXTENSION_LOGS")
+	captureExtensionLogs, err := strconv.ParseBool(rawCaptureExtensionLogs)
+	if err != nil && rawCaptureExtensionLogs != "" {
+		log.Printf("failed to parse env var ELASTIC_APM_LAMBDA_CAPTURE_EXTENSION_LOGS, defaulting to false")
+	}
+
+	if captureExtensionLogs {
+		appConfigs = append(appConfigs, app.WithExtensionLogSubscription())
+	}
+
 	application, err := app.New(ctx, appConfigs...)
 	if err != nil {
 		return fmt.Errorf("failed to create the app: %v", err)
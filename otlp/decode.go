@@ -0,0 +1,179 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// ContentTypeProtobuf is the content type of binary encoded OTLP requests.
+	ContentTypeProtobuf = "application/x-protobuf"
+	// ContentTypeJSON is the content type of JSON encoded OTLP requests.
+	ContentTypeJSON = "application/json"
+)
+
+// ErrUnsupportedContentType is returned when a request is neither protobuf
+// nor JSON encoded.
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// MediaType returns the OTLP encoding of a Content-Type header value.
+func MediaType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnsupportedContentType, err)
+	}
+	switch mediaType {
+	case ContentTypeProtobuf, ContentTypeJSON:
+		return mediaType, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedContentType, mediaType)
+}
+
+// DecodeTraces decodes the body of a request to the `/v1/traces` endpoint.
+// The message is wire compatible with ExportTraceServiceRequest.
+func DecodeTraces(body []byte, contentType string) (*tracepb.TracesData, error) {
+	var td tracepb.TracesData
+	var ids traceIDs
+	if err := unmarshal(body, contentType, &td, &ids); err != nil {
+		return nil, err
+	}
+	for i, rs := range ids.ResourceSpans {
+		for j, ss := range rs.ScopeSpans {
+			for k, sIDs := range ss.Spans {
+				s := td.GetResourceSpans()[i].GetScopeSpans()[j].GetSpans()[k]
+				s.TraceId, s.SpanId, s.ParentSpanId = sIDs.TraceID, sIDs.SpanID, sIDs.ParentSpanID
+				for l, lIDs := range sIDs.Links {
+					s.GetLinks()[l].TraceId, s.GetLinks()[l].SpanId = lIDs.TraceID, lIDs.SpanID
+				}
+			}
+		}
+	}
+	return &td, nil
+}
+
+// DecodeMetrics decodes the body of a request to the `/v1/metrics` endpoint.
+// The message is wire compatible with ExportMetricsServiceRequest.
+func DecodeMetrics(body []byte, contentType string) (*metricspb.MetricsData, error) {
+	var md metricspb.MetricsData
+	if err := unmarshal(body, contentType, &md, nil); err != nil {
+		return nil, err
+	}
+	return &md, nil
+}
+
+// DecodeLogs decodes the body of a request to the `/v1/logs` endpoint.
+// The message is wire compatible with ExportLogsServiceRequest.
+func DecodeLogs(body []byte, contentType string) (*logspb.LogsData, error) {
+	var ld logspb.LogsData
+	var ids logIDs
+	if err := unmarshal(body, contentType, &ld, &ids); err != nil {
+		return nil, err
+	}
+	for i, rl := range ids.ResourceLogs {
+		for j, sl := range rl.ScopeLogs {
+			for k, lrIDs := range sl.LogRecords {
+				lr := ld.GetResourceLogs()[i].GetScopeLogs()[j].GetLogRecords()[k]
+				lr.TraceId, lr.SpanId = lrIDs.TraceID, lrIDs.SpanID
+			}
+		}
+	}
+	return &ld, nil
+}
+
+// unmarshal decodes a protobuf or JSON encoded message. For JSON the
+// trace and span IDs are decoded into ids, if not nil, as the protobuf
+// JSON mapping does not decode them.
+func unmarshal(body []byte, contentType string, m proto.Message, ids interface{}) error {
+	mediaType, err := MediaType(contentType)
+	if err != nil {
+		return err
+	}
+	if mediaType == ContentTypeJSON {
+		if ids != nil {
+			if err := json.Unmarshal(body, ids); err != nil {
+				return fmt.Errorf("failed to decode OTLP/JSON request: %w", err)
+			}
+		}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, m); err != nil {
+			return fmt.Errorf("failed to decode OTLP/JSON request: %w", err)
+		}
+		return nil
+	}
+	if err := proto.Unmarshal(body, m); err != nil {
+		return fmt.Errorf("failed to decode OTLP/protobuf request: %w", err)
+	}
+	return nil
+}
+
+// hexID is a trace or span ID of an OTLP/JSON request. OTLP/JSON encodes
+// IDs as hex strings, while the protobuf JSON mapping expects base64 for
+// bytes fields.
+type hexID []byte
+
+func (id *hexID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("invalid trace or span ID %q: %w", s, err)
+	}
+	*id = b
+	return nil
+}
+
+// traceIDs and logIDs hold the IDs of OTLP/JSON requests, in the order of
+// the messages holding them.
+type traceIDs struct {
+	ResourceSpans []struct {
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID      hexID `json:"traceId"`
+				SpanID       hexID `json:"spanId"`
+				ParentSpanID hexID `json:"parentSpanId"`
+				Links        []struct {
+					TraceID hexID `json:"traceId"`
+					SpanID  hexID `json:"spanId"`
+				} `json:"links"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type logIDs struct {
+	ResourceLogs []struct {
+		ScopeLogs []struct {
+			LogRecords []struct {
+				TraceID hexID `json:"traceId"`
+				SpanID  hexID `json:"spanId"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"go.elastic.co/fastjson"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// LogsToIntake translates OTLP log records into intake v2 log events,
+// one payload per resource.
+func LogsToIntake(ld *logspb.LogsData) ([][]byte, error) {
+	payloads := make([][]byte, 0, len(ld.GetResourceLogs()))
+	for _, rl := range ld.GetResourceLogs() {
+		var w fastjson.Writer
+		var records int
+		for _, sl := range rl.GetScopeLogs() {
+			for _, lr := range sl.GetLogRecords() {
+				if records == 0 {
+					metadata := translateResource(rl.GetResource())
+					if err := encodeMetadata(&w, &metadata); err != nil {
+						return nil, err
+					}
+				}
+				records++
+				lc := model.LogContainer{Log: translateLogRecord(sl.GetScope().GetName(), lr)}
+				w.RawByte('\n')
+				if err := lc.MarshalFastJSON(&w); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if records > 0 {
+			payloads = append(payloads, w.Bytes())
+		}
+	}
+	return payloads, nil
+}
+
+func translateLogRecord(logger string, lr *logspb.LogRecord) *model.LogLine {
+	ts := lr.GetTimeUnixNano()
+	if ts == 0 {
+		ts = lr.GetObservedTimeUnixNano()
+	}
+	log := &model.LogLine{
+		Message:   logMessage(lr),
+		Timestamp: toTime(ts),
+		Level:     logLevel(lr),
+		Logger:    logger,
+		TraceID:   hex.EncodeToString(lr.GetTraceId()),
+		SpanID:    hex.EncodeToString(lr.GetSpanId()),
+	}
+	for k, v := range attributeMap(lr.GetAttributes()) {
+		setLabel(&log.Labels, k, v)
+	}
+	return log
+}
+
+func logMessage(lr *logspb.LogRecord) string {
+	switch body := anyValue(lr.GetBody()).(type) {
+	case nil:
+		return ""
+	case string:
+		return body
+	default:
+		b, err := json.Marshal(body)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
+
+// logLevel returns the severity text of the record, falling back to the
+// name of the severity number range.
+func logLevel(lr *logspb.LogRecord) string {
+	if text := lr.GetSeverityText(); text != "" {
+		return strings.ToLower(text)
+	}
+	switch n := lr.GetSeverityNumber(); {
+	case n == logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED:
+		return ""
+	case n < logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG:
+		return "trace"
+	case n < logspb.SeverityNumber_SEVERITY_NUMBER_INFO:
+		return "debug"
+	case n < logspb.SeverityNumber_SEVERITY_NUMBER_WARN:
+		return "info"
+	case n < logspb.SeverityNumber_SEVERITY_NUMBER_ERROR:
+		return "warn"
+	case n < logspb.SeverityNumber_SEVERITY_NUMBER_FATAL:
+		return "error"
+	}
+	return "fatal"
+}
@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+const logsJSON = `{"resourceLogs":[{
+	"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"my-function"}}]},
+	"scopeLogs":[{
+		"scope":{"name":"my.logger"},
+		"logRecords":[
+			{
+				"timeUnixNano":"1544712660000000000",
+				"severityNumber":17,
+				"body":{"stringValue":"something failed"},
+				"traceId":"5b8efff798038103d269b633813fc60c",
+				"spanId":"eee19b7ec3c1b174",
+				"attributes":[{"key":"user.id","value":{"intValue":"42"}}]
+			},
+			{
+				"observedTimeUnixNano":"1544712661000000000",
+				"severityText":"INFO",
+				"body":{"kvlistValue":{"values":[{"key":"a","value":{"boolValue":true}}]}}
+			}
+		]
+	}]
+}]}`
+
+func TestLogsToIntake(t *testing.T) {
+	ld, err := DecodeLogs([]byte(logsJSON), ContentTypeJSON)
+	require.NoError(t, err)
+
+	payloads, err := LogsToIntake(ld)
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+
+	lines := bytes.Split(payloads[0], []byte("\n"))
+	require.Len(t, lines, 3)
+
+	first := gjson.ParseBytes(lines[1])
+	assert.Equal(t, "something failed", first.Get("log.message").String())
+	assert.Equal(t, "error", first.Get(`log.log\.level`).String())
+	assert.Equal(t, "my.logger", first.Get(`log.log\.logger`).String())
+	assert.Equal(t, "5b8efff798038103d269b633813fc60c", first.Get(`log.trace\.id`).String())
+	assert.Equal(t, "eee19b7ec3c1b174", first.Get(`log.span\.id`).String())
+	assert.Equal(t, int64(42), first.Get("log.labels.user_id").Int())
+	assert.Equal(t, int64(1544712660000000), first.Get("log.@timestamp").Int())
+
+	second := gjson.ParseBytes(lines[2])
+	assert.Equal(t, `{"a":true}`, second.Get("log.message").String())
+	assert.Equal(t, "info", second.Get(`log.log\.level`).String())
+	assert.Equal(t, int64(1544712661000000), second.Get("log.@timestamp").Int())
+	assert.False(t, second.Get(`log.trace\.id`).Exists())
+}
@@ -0,0 +1,256 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"go.elastic.co/fastjson"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// MetricsToIntake translates OTLP metrics into intake v2 payloads, one per
+// resource. Data points sharing the same timestamp and attributes are
+// grouped into a single metricset. Histograms are translated to the
+// intake v2 histogram representation using the midpoint of each bucket,
+// summaries are translated to their sum and count.
+func MetricsToIntake(md *metricspb.MetricsData) ([][]byte, error) {
+	payloads := make([][]byte, 0, len(md.GetResourceMetrics()))
+	for _, rm := range md.GetResourceMetrics() {
+		var ms metricsets
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				ms.addMetric(m)
+			}
+		}
+		if len(ms.containers) == 0 {
+			continue
+		}
+		metadata := translateResource(rm.GetResource())
+		var w fastjson.Writer
+		if err := encodeMetadata(&w, &metadata); err != nil {
+			return nil, err
+		}
+		for _, mc := range ms.containers {
+			w.RawByte('\n')
+			if err := mc.MarshalFastJSON(&w); err != nil {
+				return nil, err
+			}
+		}
+		payloads = append(payloads, w.Bytes())
+	}
+	return payloads, nil
+}
+
+type metricsets struct {
+	containers []model.MetricsContainer
+	index      map[string]int
+}
+
+func (ms *metricsets) addMetric(m *metricspb.Metric) {
+	name, unit := m.GetName(), m.GetUnit()
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range data.Gauge.GetDataPoints() {
+			ms.add(dp.GetTimeUnixNano(), dp.GetAttributes(), name, model.Metric{
+				Type:  "gauge",
+				Unit:  unit,
+				Value: numberValue(dp),
+			})
+		}
+	case *metricspb.Metric_Sum:
+		typ := "gauge"
+		if data.Sum.GetIsMonotonic() {
+			typ = "counter"
+		}
+		for _, dp := range data.Sum.GetDataPoints() {
+			ms.add(dp.GetTimeUnixNano(), dp.GetAttributes(), name, model.Metric{
+				Type:  typ,
+				Unit:  unit,
+				Value: numberValue(dp),
+			})
+		}
+	case *metricspb.Metric_Histogram:
+		for _, dp := range data.Histogram.GetDataPoints() {
+			values, counts, ok := histogramBuckets(dp)
+			if !ok {
+				continue
+			}
+			ms.add(dp.GetTimeUnixNano(), dp.GetAttributes(), name, model.Metric{
+				Type:   "histogram",
+				Unit:   unit,
+				Values: values,
+				Counts: counts,
+			})
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		for _, dp := range data.ExponentialHistogram.GetDataPoints() {
+			values, counts := exponentialHistogramBuckets(dp)
+			ms.add(dp.GetTimeUnixNano(), dp.GetAttributes(), name, model.Metric{
+				Type:   "histogram",
+				Unit:   unit,
+				Values: values,
+				Counts: counts,
+			})
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range data.Summary.GetDataPoints() {
+			ms.add(dp.GetTimeUnixNano(), dp.GetAttributes(), name+".count", model.Metric{
+				Type:  "counter",
+				Value: float64(dp.GetCount()),
+			})
+			ms.add(dp.GetTimeUnixNano(), dp.GetAttributes(), name+".sum", model.Metric{
+				Type:  "counter",
+				Unit:  unit,
+				Value: dp.GetSum(),
+			})
+		}
+	}
+}
+
+func (ms *metricsets) add(ts uint64, attributes []*commonpb.KeyValue, name string, metric model.Metric) {
+	if math.IsNaN(metric.Value) || math.IsInf(metric.Value, 0) {
+		return
+	}
+	if metric.Type == "histogram" && len(metric.Counts) == 0 {
+		return
+	}
+	var labels model.Labels
+	for k, v := range attributeMap(attributes) {
+		setLabel(&labels, k, v)
+	}
+	key := metricsetKey(ts, labels)
+	i, ok := ms.index[key]
+	if !ok {
+		if ms.index == nil {
+			ms.index = make(map[string]int)
+		}
+		i = len(ms.containers)
+		ms.index[key] = i
+		ms.containers = append(ms.containers, model.MetricsContainer{
+			Metrics: &model.Metrics{
+				Timestamp: toTime(ts),
+				Labels:    labels,
+			},
+		})
+	}
+	mc := ms.containers[i]
+	if mc.Metrics.Samples == nil {
+		mc.Metrics.Samples = make(map[string]model.Metric)
+	}
+	mc.Metrics.Samples[name] = metric
+}
+
+func metricsetKey(ts uint64, labels model.Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d", ts)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "\x00%s=%v", k, labels[k])
+	}
+	return sb.String()
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) float64 {
+	if v, ok := dp.GetValue().(*metricspb.NumberDataPoint_AsInt); ok {
+		return float64(v.AsInt)
+	}
+	return dp.GetAsDouble()
+}
+
+// histogramBuckets converts explicit bucket histograms into values and
+// counts. Each value is the midpoint of its bucket, the lowest and the
+// highest buckets use their only bound. A histogram with a single bucket
+// has no bounds, its value is the mean of the data point if it has a sum.
+func histogramBuckets(dp *metricspb.HistogramDataPoint) ([]float64, []uint64, bool) {
+	bounds, bucketCounts := dp.GetExplicitBounds(), dp.GetBucketCounts()
+	if len(bucketCounts) == 0 || len(bounds) != len(bucketCounts)-1 {
+		return nil, nil, false
+	}
+	if len(bounds) == 0 {
+		if dp.Sum == nil || bucketCounts[0] == 0 {
+			return nil, nil, false
+		}
+		return []float64{dp.GetSum() / float64(bucketCounts[0])}, bucketCounts, true
+	}
+	values := make([]float64, 0, len(bucketCounts))
+	counts := make([]uint64, 0, len(bucketCounts))
+	for i, count := range bucketCounts {
+		if count == 0 {
+			continue
+		}
+		var value float64
+		switch i {
+		case 0:
+			value = bounds[0]
+			if value > 0 {
+				value /= 2
+			}
+		case len(bucketCounts) - 1:
+			value = bounds[i-1]
+		default:
+			value = bounds[i-1] + (bounds[i]-bounds[i-1])/2
+		}
+		values = append(values, value)
+		counts = append(counts, count)
+	}
+	return values, counts, true
+}
+
+// exponentialHistogramBuckets converts exponential histograms into values
+// and counts using the midpoint of each bucket.
+func exponentialHistogramBuckets(dp *metricspb.ExponentialHistogramDataPoint) ([]float64, []uint64) {
+	base := math.Pow(2, math.Pow(2, -float64(dp.GetScale())))
+	var values []float64
+	var counts []uint64
+	negative := dp.GetNegative()
+	for i := len(negative.GetBucketCounts()) - 1; i >= 0; i-- {
+		if count := negative.GetBucketCounts()[i]; count != 0 {
+			values = append(values, -bucketMidpoint(base, int(negative.GetOffset())+i))
+			counts = append(counts, count)
+		}
+	}
+	if dp.GetZeroCount() != 0 {
+		values = append(values, 0)
+		counts = append(counts, dp.GetZeroCount())
+	}
+	positive := dp.GetPositive()
+	for i, count := range positive.GetBucketCounts() {
+		if count != 0 {
+			values = append(values, bucketMidpoint(base, int(positive.GetOffset())+i))
+			counts = append(counts, count)
+		}
+	}
+	return values, counts
+}
+
+// bucketMidpoint returns the midpoint of the exponential bucket at the
+// given index, the bucket covers the range (base^index, base^(index+1)].
+func bucketMidpoint(base float64, index int) float64 {
+	lower := math.Pow(base, float64(index))
+	return lower + (lower*base-lower)/2
+}
@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+const metricsJSON = `{"resourceMetrics":[{
+	"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"my-function"}}]},
+	"scopeMetrics":[{"metrics":[
+		{
+			"name":"requests",
+			"sum":{"isMonotonic":true,"dataPoints":[
+				{"timeUnixNano":"1544712660000000000","asInt":"3","attributes":[{"key":"http.route","value":{"stringValue":"/"}}]},
+				{"timeUnixNano":"1544712660000000000","asInt":"5","attributes":[{"key":"http.route","value":{"stringValue":"/users"}}]}
+			]}
+		},
+		{
+			"name":"memory",
+			"unit":"By",
+			"gauge":{"dataPoints":[
+				{"timeUnixNano":"1544712660000000000","asDouble":1024,"attributes":[{"key":"http.route","value":{"stringValue":"/"}}]}
+			]}
+		},
+		{
+			"name":"latency",
+			"histogram":{"dataPoints":[
+				{"timeUnixNano":"1544712660000000000","bucketCounts":["1","0","2","3"],"explicitBounds":[10,20,40]}
+			]}
+		}
+	]}]
+}]}`
+
+func TestMetricsToIntake(t *testing.T) {
+	md, err := DecodeMetrics([]byte(metricsJSON), ContentTypeJSON)
+	require.NoError(t, err)
+
+	payloads, err := MetricsToIntake(md)
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+
+	lines := bytes.Split(payloads[0], []byte("\n"))
+	require.Len(t, lines, 4)
+	assert.Equal(t, "my-function", gjson.GetBytes(lines[0], "metadata.service.name").String())
+
+	root := gjson.ParseBytes(lines[1])
+	assert.Equal(t, "/", root.Get("metricset.tags.http_route").String())
+	assert.Equal(t, int64(1544712660000000), root.Get("metricset.timestamp").Int())
+	assert.Equal(t, 3.0, root.Get("metricset.samples.requests.value").Float())
+	assert.Equal(t, "counter", root.Get("metricset.samples.requests.type").String())
+	assert.Equal(t, 1024.0, root.Get("metricset.samples.memory.value").Float())
+	assert.Equal(t, "By", root.Get("metricset.samples.memory.unit").String())
+
+	users := gjson.ParseBytes(lines[2])
+	assert.Equal(t, "/users", users.Get("metricset.tags.http_route").String())
+	assert.Equal(t, 5.0, users.Get("metricset.samples.requests.value").Float())
+
+	histogram := gjson.ParseBytes(lines[3])
+	assert.False(t, histogram.Get("metricset.tags").Exists())
+	assert.Equal(t, "histogram", histogram.Get("metricset.samples.latency.type").String())
+	assert.False(t, histogram.Get("metricset.samples.latency.value").Exists())
+	assert.JSONEq(t, `[5,30,40]`, histogram.Get("metricset.samples.latency.values").Raw)
+	assert.JSONEq(t, `[1,2,3]`, histogram.Get("metricset.samples.latency.counts").Raw)
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	_, _, ok := histogramBuckets(&metricspb.HistogramDataPoint{
+		ExplicitBounds: []float64{1, 2},
+		BucketCounts:   []uint64{1, 2},
+	})
+	assert.False(t, ok)
+
+	values, counts, ok := histogramBuckets(&metricspb.HistogramDataPoint{
+		ExplicitBounds: []float64{-1, 1},
+		BucketCounts:   []uint64{1, 1, 1},
+	})
+	require.True(t, ok)
+	assert.Equal(t, []float64{-1, 0, 1}, values)
+	assert.Equal(t, []uint64{1, 1, 1}, counts)
+
+	// A single bucket without bounds uses the mean.
+	sum := 12.0
+	values, counts, ok = histogramBuckets(&metricspb.HistogramDataPoint{
+		BucketCounts: []uint64{4},
+		Sum:          &sum,
+	})
+	require.True(t, ok)
+	assert.Equal(t, []float64{3}, values)
+	assert.Equal(t, []uint64{4}, counts)
+
+	_, _, ok = histogramBuckets(&metricspb.HistogramDataPoint{BucketCounts: []uint64{4}})
+	assert.False(t, ok)
+}
@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"go.elastic.co/fastjson"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	defaultServiceName  = "unknown_service"
+	defaultAgentName    = "opentelemetry"
+	defaultAgentVersion = "unknown"
+)
+
+// resourceAttributes lists the resource attributes that are mapped to
+// metadata fields, all other attributes are recorded as global labels.
+var resourceAttributes = map[string]struct{}{
+	"service.name":                {},
+	"service.version":             {},
+	"deployment.environment":      {},
+	"deployment.environment.name": {},
+	"telemetry.sdk.name":          {},
+	"telemetry.sdk.language":      {},
+	"telemetry.sdk.version":       {},
+	"process.runtime.name":        {},
+	"process.runtime.version":     {},
+	"cloud.provider":              {},
+	"cloud.region":                {},
+	"cloud.account.id":            {},
+	"cloud.platform":              {},
+}
+
+// translateResource builds the intake v2 metadata event for an OTLP resource.
+func translateResource(resource *resourcepb.Resource) model.Metadata {
+	attrs := attributeMap(resource.GetAttributes())
+	metadata := model.Metadata{
+		Service: model.Service{
+			Name:    stringAttr(attrs, "service.name"),
+			Version: stringAttr(attrs, "service.version"),
+			Agent: model.Agent{
+				Name:    defaultAgentName,
+				Version: stringAttr(attrs, "telemetry.sdk.version"),
+			},
+		},
+	}
+	if metadata.Service.Name == "" {
+		metadata.Service.Name = defaultServiceName
+	}
+	if metadata.Service.Agent.Version == "" {
+		metadata.Service.Agent.Version = defaultAgentVersion
+	}
+	metadata.Service.Environment = stringAttr(attrs, "deployment.environment.name")
+	if metadata.Service.Environment == "" {
+		metadata.Service.Environment = stringAttr(attrs, "deployment.environment")
+	}
+	if lang := stringAttr(attrs, "telemetry.sdk.language"); lang != "" {
+		metadata.Service.Agent.Name += "/" + lang
+		metadata.Service.Language = &model.Language{Name: lang}
+	}
+	if name := stringAttr(attrs, "process.runtime.name"); name != "" {
+		metadata.Service.Runtime = &model.Runtime{
+			Name:    name,
+			Version: stringAttr(attrs, "process.runtime.version"),
+		}
+	}
+	if provider := stringAttr(attrs, "cloud.provider"); provider != "" {
+		metadata.Cloud = &model.Cloud{
+			Provider: provider,
+			Region:   stringAttr(attrs, "cloud.region"),
+		}
+		if id := stringAttr(attrs, "cloud.account.id"); id != "" {
+			metadata.Cloud.Account = &model.CloudAccount{ID: id}
+		}
+		if platform := stringAttr(attrs, "cloud.platform"); platform != "" {
+			metadata.Cloud.Service = &model.CloudService{Name: platform}
+		}
+	}
+	for k, v := range attrs {
+		if _, ok := resourceAttributes[k]; ok {
+			continue
+		}
+		setLabel(&metadata.Labels, k, v)
+	}
+	return metadata
+}
+
+// encodeMetadata writes the metadata event as the first line of an intake
+// v2 payload.
+func encodeMetadata(w *fastjson.Writer, metadata *model.Metadata) error {
+	mc := model.MetadataContainer{Metadata: metadata}
+	return mc.MarshalFastJSON(w)
+}
+
+// attributeMap converts OTLP attributes to a map of plain Go values.
+func attributeMap(kvs []*commonpb.KeyValue) map[string]interface{} {
+	if len(kvs) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		if v := anyValue(kv.GetValue()); v != nil {
+			m[kv.GetKey()] = v
+		}
+	}
+	return m
+}
+
+func anyValue(v *commonpb.AnyValue) interface{} {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]interface{}, 0, len(v.ArrayValue.GetValues()))
+		for _, elem := range v.ArrayValue.GetValues() {
+			if elem := anyValue(elem); elem != nil {
+				values = append(values, elem)
+			}
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		return attributeMap(v.KvlistValue.GetValues())
+	}
+	return nil
+}
+
+func stringAttr(attrs map[string]interface{}, key string) string {
+	s, _ := attrs[key].(string)
+	return s
+}
+
+// setLabel records an attribute as a label. Labels only support scalar
+// values so any other value is dropped.
+func setLabel(labels *model.Labels, key string, value interface{}) {
+	switch value.(type) {
+	case string, bool, int64, float64:
+	default:
+		return
+	}
+	if *labels == nil {
+		*labels = make(model.Labels)
+	}
+	labels.Set(key, value)
+}
+
+func toTime(unixNano uint64) model.Time {
+	return model.Time(time.Unix(0, int64(unixNano)))
+}
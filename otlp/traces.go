@@ -0,0 +1,309 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"go.elastic.co/fastjson"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// TracesToIntake translates OTLP traces into intake v2 payloads, one per
+// resource. Each payload starts with the metadata event describing the
+// resource. Root spans, server spans and consumer spans are translated
+// to transactions, all other spans are translated to spans. Exception
+// span events are translated to errors.
+func TracesToIntake(td *tracepb.TracesData) ([][]byte, error) {
+	payloads := make([][]byte, 0, len(td.GetResourceSpans()))
+	for _, rs := range td.GetResourceSpans() {
+		var spans []*tracepb.Span
+		for _, ss := range rs.GetScopeSpans() {
+			spans = append(spans, ss.GetSpans()...)
+		}
+		if len(spans) == 0 {
+			continue
+		}
+		metadata := translateResource(rs.GetResource())
+		var w fastjson.Writer
+		if err := encodeMetadata(&w, &metadata); err != nil {
+			return nil, err
+		}
+		if err := newTraceTranslator(spans).encode(&w); err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, w.Bytes())
+	}
+	return payloads, nil
+}
+
+// RootSpanEnded returns true if the traces contain the root span of the
+// invocation identified by the request ID. Root spans without the faas
+// invocation attributes are assumed to belong to the current invocation.
+func RootSpanEnded(td *tracepb.TracesData, requestID string) bool {
+	for _, rs := range td.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, s := range ss.GetSpans() {
+				if len(s.GetParentSpanId()) != 0 {
+					continue
+				}
+				attrs := attributeMap(s.GetAttributes())
+				id := stringAttr(attrs, "faas.invocation_id")
+				if id == "" {
+					id = stringAttr(attrs, "faas.execution")
+				}
+				if id == "" || id == requestID {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+type traceTranslator struct {
+	spans []*tracepb.Span
+	byID  map[string]*tracepb.Span
+}
+
+func newTraceTranslator(spans []*tracepb.Span) *traceTranslator {
+	t := &traceTranslator{
+		spans: spans,
+		byID:  make(map[string]*tracepb.Span, len(spans)),
+	}
+	for _, s := range spans {
+		t.byID[hex.EncodeToString(s.GetSpanId())] = s
+	}
+	return t
+}
+
+func (t *traceTranslator) encode(w *fastjson.Writer) error {
+	started := make(map[string]int)
+	for _, s := range t.spans {
+		if !isTransaction(s) {
+			if txnID := t.transactionID(s); txnID != "" {
+				started[txnID]++
+			}
+		}
+	}
+	for _, s := range t.spans {
+		attrs := attributeMap(s.GetAttributes())
+		id := hex.EncodeToString(s.GetSpanId())
+		w.RawByte('\n')
+		if isTransaction(s) {
+			txn := t.translateTransaction(s, attrs)
+			txn.SpanCount.Started = started[id]
+			tc := model.TransactionContainer{Transaction: txn}
+			if err := tc.MarshalFastJSON(w); err != nil {
+				return err
+			}
+		} else {
+			sc := model.SpanContainer{Span: t.translateSpan(s, attrs)}
+			if err := sc.MarshalFastJSON(w); err != nil {
+				return err
+			}
+		}
+		for _, e := range s.GetEvents() {
+			if e.GetName() != "exception" {
+				continue
+			}
+			ec := model.ErrorContainer{Error: t.translateException(s, e)}
+			w.RawByte('\n')
+			if err := ec.MarshalFastJSON(w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *traceTranslator) translateTransaction(s *tracepb.Span, attrs map[string]interface{}) *model.Transaction {
+	txn := &model.Transaction{
+		ID:        hex.EncodeToString(s.GetSpanId()),
+		TraceID:   hex.EncodeToString(s.GetTraceId()),
+		ParentID:  hex.EncodeToString(s.GetParentSpanId()),
+		Name:      s.GetName(),
+		Type:      transactionType(s, attrs),
+		Timestamp: toTime(s.GetStartTimeUnixNano()),
+		Duration:  duration(s),
+		Result:    transactionResult(s, attrs),
+		Outcome:   outcome(s),
+		OTel:      otel(s, attrs),
+		Links:     links(s),
+	}
+	return txn
+}
+
+func (t *traceTranslator) translateSpan(s *tracepb.Span, attrs map[string]interface{}) *model.Span {
+	span := &model.Span{
+		ID:            hex.EncodeToString(s.GetSpanId()),
+		TransactionID: t.transactionID(s),
+		TraceID:       hex.EncodeToString(s.GetTraceId()),
+		ParentID:      hex.EncodeToString(s.GetParentSpanId()),
+		Name:          s.GetName(),
+		Timestamp:     toTime(s.GetStartTimeUnixNano()),
+		Duration:      duration(s),
+		Outcome:       outcome(s),
+		OTel:          otel(s, attrs),
+		Links:         links(s),
+	}
+	span.Type, span.Subtype = spanType(s, attrs)
+	return span
+}
+
+func (t *traceTranslator) translateException(s *tracepb.Span, e *tracepb.Span_Event) *model.Error {
+	attrs := attributeMap(e.GetAttributes())
+	txnID := t.transactionID(s)
+	if isTransaction(s) {
+		txnID = hex.EncodeToString(s.GetSpanId())
+	}
+	exception := &model.Exception{
+		Message: stringAttr(attrs, "exception.message"),
+		Type:    stringAttr(attrs, "exception.type"),
+	}
+	if escaped, ok := attrs["exception.escaped"].(bool); ok {
+		handled := !escaped
+		exception.Handled = &handled
+	}
+	if exception.Message == "" && exception.Type == "" {
+		exception.Message = s.GetName()
+	}
+	return &model.Error{
+		ID:            model.NewID(16),
+		TraceID:       hex.EncodeToString(s.GetTraceId()),
+		TransactionID: txnID,
+		ParentID:      hex.EncodeToString(s.GetSpanId()),
+		Timestamp:     toTime(e.GetTimeUnixNano()),
+		Exception:     exception,
+	}
+}
+
+// transactionID returns the ID of the closest ancestor of the span that
+// is translated to a transaction. An empty string is returned if the
+// ancestor is not part of the same request.
+func (t *traceTranslator) transactionID(s *tracepb.Span) string {
+	for i := 0; i < len(t.spans); i++ {
+		parent, ok := t.byID[hex.EncodeToString(s.GetParentSpanId())]
+		if !ok {
+			return ""
+		}
+		if isTransaction(parent) {
+			return hex.EncodeToString(parent.GetSpanId())
+		}
+		s = parent
+	}
+	return ""
+}
+
+func isTransaction(s *tracepb.Span) bool {
+	switch s.GetKind() {
+	case tracepb.Span_SPAN_KIND_SERVER, tracepb.Span_SPAN_KIND_CONSUMER:
+		return true
+	}
+	return len(s.GetParentSpanId()) == 0
+}
+
+func transactionType(s *tracepb.Span, attrs map[string]interface{}) string {
+	switch {
+	case s.GetKind() == tracepb.Span_SPAN_KIND_CONSUMER, attrs["messaging.system"] != nil:
+		return "messaging"
+	case attrs["http.request.method"] != nil, attrs["http.method"] != nil,
+		attrs["rpc.system"] != nil, stringAttr(attrs, "faas.trigger") == "http":
+		return "request"
+	}
+	return "unknown"
+}
+
+func transactionResult(s *tracepb.Span, attrs map[string]interface{}) string {
+	statusCode, ok := attrs["http.response.status_code"].(int64)
+	if !ok {
+		statusCode, ok = attrs["http.status_code"].(int64)
+	}
+	if ok {
+		return fmt.Sprintf("HTTP %dxx", statusCode/100)
+	}
+	switch s.GetStatus().GetCode() {
+	case tracepb.Status_STATUS_CODE_OK:
+		return "Success"
+	case tracepb.Status_STATUS_CODE_ERROR:
+		return "Error"
+	}
+	return ""
+}
+
+func spanType(s *tracepb.Span, attrs map[string]interface{}) (string, string) {
+	if system := stringAttr(attrs, "db.system"); system != "" {
+		return "db", system
+	}
+	if system := stringAttr(attrs, "messaging.system"); system != "" {
+		return "messaging", system
+	}
+	if system := stringAttr(attrs, "rpc.system"); system != "" {
+		return "external", system
+	}
+	if attrs["http.request.method"] != nil || attrs["http.method"] != nil {
+		return "external", "http"
+	}
+	if s.GetKind() == tracepb.Span_SPAN_KIND_INTERNAL {
+		return "app", "internal"
+	}
+	return "unknown", ""
+}
+
+func outcome(s *tracepb.Span) string {
+	switch s.GetStatus().GetCode() {
+	case tracepb.Status_STATUS_CODE_OK:
+		return "success"
+	case tracepb.Status_STATUS_CODE_ERROR:
+		return "failure"
+	}
+	return "unknown"
+}
+
+func otel(s *tracepb.Span, attrs map[string]interface{}) *model.OTel {
+	o := &model.OTel{Attributes: attrs}
+	if s.GetKind() != tracepb.Span_SPAN_KIND_UNSPECIFIED {
+		o.SpanKind = strings.TrimPrefix(s.GetKind().String(), "SPAN_KIND_")
+	}
+	return o
+}
+
+func links(s *tracepb.Span) []model.Link {
+	if len(s.GetLinks()) == 0 {
+		return nil
+	}
+	links := make([]model.Link, 0, len(s.GetLinks()))
+	for _, l := range s.GetLinks() {
+		links = append(links, model.Link{
+			TraceID: hex.EncodeToString(l.GetTraceId()),
+			SpanID:  hex.EncodeToString(l.GetSpanId()),
+		})
+	}
+	return links
+}
+
+// duration returns the duration of the span in milliseconds.
+func duration(s *tracepb.Span) float64 {
+	if s.GetEndTimeUnixNano() < s.GetStartTimeUnixNano() {
+		return 0
+	}
+	return float64(s.GetEndTimeUnixNano()-s.GetStartTimeUnixNano()) / 1e6
+}
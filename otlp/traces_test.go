@@ -0,0 +1,202 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const tracesJSON = `{"resourceSpans":[{
+	"resource":{"attributes":[
+		{"key":"service.name","value":{"stringValue":"my-function"}},
+		{"key":"telemetry.sdk.language","value":{"stringValue":"python"}},
+		{"key":"telemetry.sdk.version","value":{"stringValue":"1.20.0"}},
+		{"key":"cloud.provider","value":{"stringValue":"aws"}},
+		{"key":"cloud.platform","value":{"stringValue":"aws_lambda"}},
+		{"key":"faas.name","value":{"stringValue":"my-function"}}
+	]},
+	"scopeSpans":[{"spans":[
+		{
+			"traceId":"5b8efff798038103d269b633813fc60c",
+			"spanId":"eee19b7ec3c1b174",
+			"name":"my-function",
+			"kind":"SPAN_KIND_SERVER",
+			"startTimeUnixNano":"1544712660000000000",
+			"endTimeUnixNano":"1544712661000000000",
+			"attributes":[{"key":"faas.invocation_id","value":{"stringValue":"req-1"}}],
+			"status":{"code":"STATUS_CODE_ERROR"},
+			"events":[{
+				"name":"exception",
+				"timeUnixNano":"1544712660500000000",
+				"attributes":[
+					{"key":"exception.type","value":{"stringValue":"ValueError"}},
+					{"key":"exception.message","value":{"stringValue":"boom"}}
+				]
+			}]
+		},
+		{
+			"traceId":"5b8efff798038103d269b633813fc60c",
+			"spanId":"eee19b7ec3c1b175",
+			"parentSpanId":"eee19b7ec3c1b174",
+			"name":"SELECT",
+			"kind":"SPAN_KIND_CLIENT",
+			"startTimeUnixNano":"1544712660100000000",
+			"endTimeUnixNano":"1544712660200000000",
+			"attributes":[{"key":"db.system","value":{"stringValue":"postgresql"}}]
+		}
+	]}]
+}]}`
+
+func TestTracesToIntake(t *testing.T) {
+	td, err := DecodeTraces([]byte(tracesJSON), "application/json; charset=utf-8")
+	require.NoError(t, err)
+
+	payloads, err := TracesToIntake(td)
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+
+	lines := bytes.Split(payloads[0], []byte("\n"))
+	require.Len(t, lines, 4)
+
+	metadata := gjson.ParseBytes(lines[0])
+	assert.Equal(t, "my-function", metadata.Get("metadata.service.name").String())
+	assert.Equal(t, "opentelemetry/python", metadata.Get("metadata.service.agent.name").String())
+	assert.Equal(t, "1.20.0", metadata.Get("metadata.service.agent.version").String())
+	assert.Equal(t, "aws_lambda", metadata.Get("metadata.cloud.service.name").String())
+	assert.Equal(t, "my-function", metadata.Get("metadata.labels.faas_name").String())
+
+	txn := gjson.ParseBytes(lines[1])
+	assert.Equal(t, "eee19b7ec3c1b174", txn.Get("transaction.id").String())
+	assert.Equal(t, "5b8efff798038103d269b633813fc60c", txn.Get("transaction.trace_id").String())
+	assert.False(t, txn.Get("transaction.parent_id").Exists())
+	assert.Equal(t, 1000.0, txn.Get("transaction.duration").Float())
+	assert.Equal(t, int64(1544712660000000), txn.Get("transaction.timestamp").Int())
+	assert.Equal(t, "failure", txn.Get("transaction.outcome").String())
+	assert.Equal(t, int64(1), txn.Get("transaction.span_count.started").Int())
+	assert.Equal(t, "SERVER", txn.Get("transaction.otel.span_kind").String())
+	assert.Equal(t, "req-1", txn.Get(`transaction.otel.attributes.faas\.invocation_id`).String())
+
+	errEvent := gjson.ParseBytes(lines[2])
+	assert.Equal(t, "eee19b7ec3c1b174", errEvent.Get("error.transaction_id").String())
+	assert.Equal(t, "eee19b7ec3c1b174", errEvent.Get("error.parent_id").String())
+	assert.Equal(t, "ValueError", errEvent.Get("error.exception.type").String())
+	assert.Equal(t, "boom", errEvent.Get("error.exception.message").String())
+
+	span := gjson.ParseBytes(lines[3])
+	assert.Equal(t, "eee19b7ec3c1b175", span.Get("span.id").String())
+	assert.Equal(t, "eee19b7ec3c1b174", span.Get("span.parent_id").String())
+	assert.Equal(t, "eee19b7ec3c1b174", span.Get("span.transaction_id").String())
+	assert.Equal(t, "db", span.Get("span.type").String())
+	assert.Equal(t, "postgresql", span.Get("span.subtype").String())
+	assert.Equal(t, 100.0, span.Get("span.duration").Float())
+	assert.Equal(t, "unknown", span.Get("span.outcome").String())
+}
+
+func TestDecodeTracesProtobuf(t *testing.T) {
+	traceID := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	spanID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	body, err := proto.Marshal(&tracepb.TracesData{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{},
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Spans: []*tracepb.Span{{TraceId: traceID, SpanId: spanID, Name: "root"}},
+			}},
+		}},
+	})
+	require.NoError(t, err)
+
+	td, err := DecodeTraces(body, ContentTypeProtobuf)
+	require.NoError(t, err)
+	span := td.GetResourceSpans()[0].GetScopeSpans()[0].GetSpans()[0]
+	assert.Equal(t, traceID, span.GetTraceId())
+	assert.Equal(t, spanID, span.GetSpanId())
+
+	payloads, err := TracesToIntake(td)
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+	lines := bytes.Split(payloads[0], []byte("\n"))
+	require.Len(t, lines, 2)
+	assert.Equal(t, "unknown_service", gjson.GetBytes(lines[0], "metadata.service.name").String())
+	assert.Equal(t, "unknown", gjson.GetBytes(lines[1], "transaction.type").String())
+
+	_, err = DecodeTraces(body, "text/plain")
+	assert.ErrorIs(t, err, ErrUnsupportedContentType)
+	_, err = DecodeTraces([]byte("{"), ContentTypeJSON)
+	assert.Error(t, err)
+}
+
+func TestDecodeTracesJSONIDs(t *testing.T) {
+	td, err := DecodeTraces([]byte(`{"resourceSpans":[{"scopeSpans":[{"spans":[{
+		"traceId":"000102030405060708090a0b0c0d0e0f",
+		"spanId":"0001020304050607",
+		"parentSpanId":"",
+		"links":[{"traceId":"0f0e0d0c0b0a09080706050403020100","spanId":"0706050403020100"}]
+	}]}]}]}`), ContentTypeJSON)
+	require.NoError(t, err)
+	span := td.GetResourceSpans()[0].GetScopeSpans()[0].GetSpans()[0]
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, span.GetTraceId())
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7}, span.GetSpanId())
+	assert.Empty(t, span.GetParentSpanId())
+	require.Len(t, span.GetLinks(), 1)
+	assert.Equal(t, "0f0e0d0c0b0a09080706050403020100", hex.EncodeToString(span.GetLinks()[0].GetTraceId()))
+	assert.Equal(t, "0706050403020100", hex.EncodeToString(span.GetLinks()[0].GetSpanId()))
+
+	_, err = DecodeTraces([]byte(`{"resourceSpans":[{"scopeSpans":[{"spans":[{"traceId":"not-hex"}]}]}]}`), ContentTypeJSON)
+	assert.Error(t, err)
+}
+
+func TestRootSpanEnded(t *testing.T) {
+	traces := func(parentID []byte, attrs ...*commonpb.KeyValue) *tracepb.TracesData {
+		return &tracepb.TracesData{ResourceSpans: []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Spans: []*tracepb.Span{{ParentSpanId: parentID, Attributes: attrs}},
+			}},
+		}}}
+	}
+	invocationID := func(id string) *commonpb.KeyValue {
+		return &commonpb.KeyValue{
+			Key:   "faas.invocation_id",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: id}},
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		td       *tracepb.TracesData
+		expected bool
+	}{
+		"root-span-current-request": {td: traces(nil, invocationID("req-1")), expected: true},
+		"root-span-other-request":   {td: traces(nil, invocationID("req-0")), expected: false},
+		"root-span-no-request":      {td: traces(nil), expected: true},
+		"child-span":                {td: traces([]byte{1, 2, 3, 4, 5, 6, 7, 8}, invocationID("req-1")), expected: false},
+		"empty":                     {td: &tracepb.TracesData{}, expected: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, RootSpanEnded(tc.td, "req-1"))
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package recorder records the inputs of the extension, with the time
+// they were received, so that they can be replayed against a local build
+// of the extension. The requests sent to the APM Server are recorded too,
+// as the expected output of a replay.
+package recorder
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elastic/apm-aws-lambda/accumulator"
+)
+
+// Sources of the recorded entries.
+const (
+	// NextEvent is an event returned by the Extensions API.
+	NextEvent = "extension.next"
+	// LogsPush is a batch of events pushed by the Logs or Telemetry API.
+	LogsPush = "logs"
+	// Intake is an intake request of the APM agent.
+	Intake = "intake"
+	// Registration is a transaction registration request of the APM agent.
+	Registration = "registration"
+	// OTLP is an export request of an OpenTelemetry SDK.
+	OTLP = "otlp"
+	// XRay is a segment document datagram of an X-Ray SDK.
+	XRay = "xray"
+	// StatsD is a StatsD datagram.
+	StatsD = "statsd"
+	// Config is the configuration of the extension, recorded first.
+	Config = "config"
+	// APMServer is the data sent to the APM Server.
+	APMServer = "apm_server"
+)
+
+// Entry is a recorded input or output of the extension. Compressed bodies
+// are recorded decompressed, and bodies that are not valid UTF-8, such as
+// protobuf OTLP requests, are base64 encoded.
+type Entry struct {
+	Time     time.Time         `json:"time"`
+	Source   string            `json:"source"`
+	Path     string            `json:"path,omitempty"`
+	Header   map[string]string `json:"header,omitempty"`
+	Encoding string            `json:"encoding,omitempty"`
+	Body     string            `json:"body"`
+}
+
+// Data returns the body of the entry, decoded if needed.
+func (e Entry) Data() ([]byte, error) {
+	switch e.Encoding {
+	case "":
+		return []byte(e.Body), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(e.Body)
+	default:
+		return nil, fmt.Errorf("unknown %s entry encoding %q", e.Source, e.Encoding)
+	}
+}
+
+func (e *Entry) setBody(body []byte) {
+	if utf8.Valid(body) {
+		e.Body = string(body)
+		return
+	}
+	e.Encoding = "base64"
+	e.Body = base64.StdEncoding.EncodeToString(body)
+}
+
+// ExtensionConfig is the configuration of the recorded extension: the
+// log subscriptions it was created with and the environment variables
+// configuring it.
+type ExtensionConfig struct {
+	FunctionLogs  bool              `json:"function_logs,omitempty"`
+	ExtensionLogs bool              `json:"extension_logs,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+}
+
+// recordedAWSVariables are the variables set by the Lambda service that
+// are kept in the recording.
+var recordedAWSVariables = []string{
+	"AWS_EXECUTION_ENV",
+	"AWS_LAMBDA_FUNCTION_NAME",
+	"AWS_LAMBDA_FUNCTION_VERSION",
+	"AWS_REGION",
+}
+
+// Environ returns the environment variables configuring the extension.
+// The credentials and the certificates, as well as the variables
+// referencing them, are not returned.
+func Environ() map[string]string {
+	env := make(map[string]string)
+	for _, key := range recordedAWSVariables {
+		if v, ok := os.LookupEnv(key); ok {
+			env[key] = v
+		}
+	}
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, "ELASTIC_APM_") ||
+			strings.Contains(key, "SECRET") ||
+			strings.Contains(key, "API_KEY") ||
+			strings.Contains(key, "CERT") {
+			continue
+		}
+		env[key] = value
+	}
+	return env
+}
+
+// recordedHeaders are the request headers kept in the recording.
+var recordedHeaders = []string{
+	"Content-Type",
+	"User-Agent",
+	"X-Elastic-Aws-Request-Id",
+}
+
+// Recorder writes the recorded entries as newline delimited JSON. It is
+// safe for concurrent use. A nil Recorder records nothing.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// New returns a Recorder writing to w.
+func New(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Record records the body received or sent from the source.
+func (r *Recorder) Record(source string, body []byte) error {
+	if r == nil {
+		return nil
+	}
+	entry := Entry{Time: time.Now(), Source: source}
+	entry.setBody(body)
+	return r.write(entry)
+}
+
+// RecordConfig records the configuration of the extension.
+func (r *Recorder) RecordConfig(cfg ExtensionConfig) error {
+	if r == nil {
+		return nil
+	}
+	body, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode the configuration: %w", err)
+	}
+	return r.Record(Config, body)
+}
+
+// RecordRequest records the request received from the source. The body
+// has already been read from the request and is decompressed according to
+// its Content-Encoding header.
+func (r *Recorder) RecordRequest(source string, req *http.Request, body []byte) error {
+	if r == nil {
+		return nil
+	}
+	entry := Entry{Time: time.Now(), Source: source, Path: req.URL.RequestURI()}
+	for _, key := range recordedHeaders {
+		if v := req.Header.Get(key); v != "" {
+			if entry.Header == nil {
+				entry.Header = make(map[string]string)
+			}
+			entry.Header[key] = v
+		}
+	}
+	uncompressed, err := accumulator.GetUncompressedBytes(body, req.Header.Get("Content-Encoding"))
+	if err != nil {
+		return fmt.Errorf("failed to decompress %s request: %w", source, err)
+	}
+	entry.setBody(uncompressed)
+	return r.write(entry)
+}
+
+func (r *Recorder) write(entry Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(entry); err != nil {
+		return fmt.Errorf("failed to record %s entry: %w", entry.Source, err)
+	}
+	return nil
+}
+
+// Read reads the entries of a recording.
+func Read(rd io.Reader) ([]Entry, error) {
+	var entries []Entry
+	dec := json.NewDecoder(bufio.NewReader(rd))
+	for dec.More() {
+		var entry Entry
+		if err := dec.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("failed to read recording entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package recorder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	var buf bytes.Buffer
+	rec := New(&buf)
+
+	require.NoError(t, rec.Record(NextEvent, []byte(`{"eventType":"INVOKE"}`)))
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err := gw.Write([]byte(`{"metadata":{}}`))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	req := httptest.NewRequest("POST", "/intake/v2/events?flushed=true", nil)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Authorization", "Bearer secret")
+	require.NoError(t, rec.RecordRequest(Intake, req, compressed.Bytes()))
+
+	entries, err := Read(&buf)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, NextEvent, entries[0].Source)
+	assert.Equal(t, `{"eventType":"INVOKE"}`, entries[0].Body)
+	assert.False(t, entries[0].Time.IsZero())
+
+	assert.Equal(t, Intake, entries[1].Source)
+	assert.Equal(t, "/intake/v2/events?flushed=true", entries[1].Path)
+	assert.Equal(t, `{"metadata":{}}`, entries[1].Body)
+	assert.Equal(t, map[string]string{"Content-Type": "application/x-ndjson"}, entries[1].Header)
+}
+
+func TestRecordBinary(t *testing.T) {
+	var buf bytes.Buffer
+	rec := New(&buf)
+	body := []byte{0x0a, 0xff, 0x00, 0x12}
+	req := httptest.NewRequest("POST", "/v1/traces", nil)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	require.NoError(t, rec.RecordRequest(OTLP, req, body))
+	require.NoError(t, rec.Record(StatsD, []byte("orders.processed:3|c")))
+
+	entries, err := Read(&buf)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "base64", entries[0].Encoding)
+	data, err := entries[0].Data()
+	require.NoError(t, err)
+	assert.Equal(t, body, data)
+	assert.Empty(t, entries[1].Encoding)
+	data, err = entries[1].Data()
+	require.NoError(t, err)
+	assert.Equal(t, "orders.processed:3|c", string(data))
+}
+
+func TestRecordConfig(t *testing.T) {
+	t.Setenv("ELASTIC_APM_LAMBDA_LOG_MIN_LEVEL", "warn")
+	t.Setenv("ELASTIC_APM_SECRET_TOKEN", "secret")
+	t.Setenv("ELASTIC_APM_SECRETS_MANAGER_API_KEY_ID", "arn")
+	t.Setenv("ELASTIC_APM_LAMBDA_SERVER_CA_CERT_PEM", "pem")
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "my-function")
+
+	var buf bytes.Buffer
+	rec := New(&buf)
+	require.NoError(t, rec.RecordConfig(ExtensionConfig{FunctionLogs: true, Env: Environ()}))
+
+	entries, err := Read(&buf)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, Config, entries[0].Source)
+	var cfg ExtensionConfig
+	require.NoError(t, json.Unmarshal([]byte(entries[0].Body), &cfg))
+	assert.True(t, cfg.FunctionLogs)
+	assert.False(t, cfg.ExtensionLogs)
+	assert.Equal(t, "warn", cfg.Env["ELASTIC_APM_LAMBDA_LOG_MIN_LEVEL"])
+	assert.Equal(t, "my-function", cfg.Env["AWS_LAMBDA_FUNCTION_NAME"])
+	assert.NotContains(t, cfg.Env, "ELASTIC_APM_SECRET_TOKEN")
+	assert.NotContains(t, cfg.Env, "ELASTIC_APM_SECRETS_MANAGER_API_KEY_ID")
+	assert.NotContains(t, cfg.Env, "ELASTIC_APM_LAMBDA_SERVER_CA_CERT_PEM")
+}
+
+func TestNilRecorder(t *testing.T) {
+	var rec *Recorder
+	assert.NoError(t, rec.Record(LogsPush, []byte("[]")))
+	assert.NoError(t, rec.RecordRequest(LogsPush, httptest.NewRequest("POST", "/", nil), []byte("[]")))
+}
+
+func TestReadInvalid(t *testing.T) {
+	_, err := Read(strings.NewReader("{\"source\":\"logs\"}\nnot json\n"))
+	assert.ErrorContains(t, err, "entry 2")
+}
@@ -0,0 +1,634 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package replay feeds a recording of the extension inputs back through
+// the extension, against a stand-in Lambda Runtime API and a stand-in APM
+// Server, and compares the events sent to the APM Server with the ones of
+// the recording.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/accumulator"
+	"github.com/elastic/apm-aws-lambda/app"
+	"github.com/elastic/apm-aws-lambda/extension"
+	"github.com/elastic/apm-aws-lambda/recorder"
+)
+
+// DefaultIgnoredFields are the fields removed from the events before they
+// are compared: the identifiers generated by the extension, and the
+// timestamps and durations measured during the replay.
+var DefaultIgnoredFields = []string{
+	"id",
+	"trace_id",
+	"parent_id",
+	"transaction_id",
+	"span_id",
+	"trace.id",
+	"transaction.id",
+	"timestamp",
+	"duration",
+	"faas.timeout",
+}
+
+// Option configures a replay.
+type Option func(*config)
+
+type config struct {
+	ignoredFields []string
+	logLevel      string
+	timeout       time.Duration
+}
+
+// WithIgnoredFields replaces the fields removed from the events before
+// they are compared.
+func WithIgnoredFields(fields ...string) Option {
+	return func(c *config) {
+		c.ignoredFields = fields
+	}
+}
+
+// WithLogLevel sets the log level of the replayed extension.
+func WithLogLevel(level string) Option {
+	return func(c *config) {
+		c.logLevel = level
+	}
+}
+
+// WithTimeout sets how long the replay may run past the end of the
+// recording before it is canceled.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeout = timeout
+	}
+}
+
+// Result is the outcome of a replay. Events are normalized by removing the
+// ignored fields, metadata events are not compared.
+type Result struct {
+	// Expected are the events sent to the APM Server in the recording.
+	Expected []string
+	// Actual are the events sent to the APM Server during the replay.
+	Actual []string
+	// Missing are the expected events that were not sent.
+	Missing []string
+	// Unexpected are the events sent that were not expected.
+	Unexpected []string
+}
+
+// Matches returns true if the replay sent the events of the recording.
+func (r *Result) Matches() bool {
+	return len(r.Missing) == 0 && len(r.Unexpected) == 0
+}
+
+// Run replays the recorded entries through an app.App and returns the
+// comparison of its output with the recording. The inputs are sent with
+// the timing of the recording. The extension is configured from the
+// environment, like in Lambda, with the log subscriptions and the
+// variables of the recorded configuration if any. Run sets the APM Server
+// URL, the receiver port and the addresses of the X-Ray and StatsD
+// listeners for the duration of the replay, so replays cannot run
+// concurrently. Recordings with X-Ray or StatsD datagrams are rejected if
+// the corresponding listener is not configured.
+func Run(ctx context.Context, entries []recorder.Entry, opts ...Option) (*Result, error) {
+	cfg := config{
+		ignoredFields: DefaultIgnoredFields,
+		logLevel:      "info",
+		timeout:       30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("recording is empty")
+	}
+
+	entries = append([]recorder.Entry(nil), entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	recordStart := entries[0].Time
+	recordEnd := entries[len(entries)-1].Time
+
+	var extensionConfig *recorder.ExtensionConfig
+	var nextEvents, inputs []recorder.Entry
+	var expected []string
+	for _, entry := range entries {
+		switch entry.Source {
+		case recorder.Config:
+			if extensionConfig != nil {
+				return nil, errors.New("recording has more than one configuration")
+			}
+			extensionConfig = &recorder.ExtensionConfig{}
+			if err := json.Unmarshal([]byte(entry.Body), extensionConfig); err != nil {
+				return nil, fmt.Errorf("failed to decode recorded configuration: %w", err)
+			}
+		case recorder.NextEvent:
+			nextEvents = append(nextEvents, entry)
+		case recorder.LogsPush, recorder.Intake, recorder.Registration, recorder.OTLP, recorder.XRay, recorder.StatsD:
+			inputs = append(inputs, entry)
+		case recorder.APMServer:
+			expected = append(expected, splitEvents([]byte(entry.Body))...)
+		default:
+			return nil, fmt.Errorf("unknown recording source %q", entry.Source)
+		}
+	}
+
+	apmServer := newAPMServer()
+	defer apmServer.Close()
+
+	receiverPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	sender := inputSender{
+		receiverURL: "http://127.0.0.1:" + strconv.Itoa(receiverPort),
+	}
+	appOpts := []app.ConfigOption{
+		app.WithExtensionName("apm-lambda-extension"),
+		app.WithLogLevel(cfg.logLevel),
+		app.WithLogsapiAddress("127.0.0.1:0"),
+	}
+	env := make(map[string]string)
+	if extensionConfig != nil {
+		for key, value := range extensionConfig.Env {
+			env[key] = value
+		}
+		if extensionConfig.FunctionLogs {
+			appOpts = append(appOpts, app.WithFunctionLogSubscription())
+		}
+		if extensionConfig.ExtensionLogs {
+			appOpts = append(appOpts, app.WithExtensionLogSubscription())
+		}
+	}
+	if env["ELASTIC_APM_LAMBDA_XRAY_LISTENER_ADDRESS"] != "" {
+		if sender.xrayAddr, err = freeUDPAddr(); err != nil {
+			return nil, err
+		}
+		env["ELASTIC_APM_LAMBDA_XRAY_LISTENER_ADDRESS"] = sender.xrayAddr
+		env["ELASTIC_APM_LAMBDA_XRAY_RELAY"] = "false"
+	}
+	if env["ELASTIC_APM_LAMBDA_STATSD_LISTENER_ADDRESS"] != "" {
+		if sender.statsdAddr, err = freeUDPAddr(); err != nil {
+			return nil, err
+		}
+		env["ELASTIC_APM_LAMBDA_STATSD_LISTENER_ADDRESS"] = sender.statsdAddr
+	}
+	for _, entry := range inputs {
+		if entry.Source == recorder.XRay && sender.xrayAddr == "" {
+			return nil, errors.New("recording has X-Ray datagrams but no recorded X-Ray listener")
+		}
+		if entry.Source == recorder.StatsD && sender.statsdAddr == "" {
+			return nil, errors.New("recording has StatsD datagrams but no recorded StatsD listener")
+		}
+	}
+	env["ELASTIC_APM_LAMBDA_APM_SERVER"] = apmServer.URL
+	env["ELASTIC_APM_DATA_RECEIVER_SERVER_PORT"] = strconv.Itoa(receiverPort)
+	env["ELASTIC_APM_LAMBDA_OUTPUT"] = ""
+	env["ELASTIC_APM_LAMBDA_RECORD_FILE"] = ""
+	restoreEnv, err := setenv(env)
+	if err != nil {
+		return nil, err
+	}
+	defer restoreEnv()
+
+	ctx, cancel := context.WithTimeout(ctx, recordEnd.Sub(recordStart)+cfg.timeout)
+	defer cancel()
+
+	runtimeAPI := newRuntimeAPI(nextEvents, recordStart)
+	defer runtimeAPI.Close()
+
+	appOpts = append(appOpts, app.WithLambdaRuntimeAPI(strings.TrimPrefix(runtimeAPI.URL, "http://")))
+	application, err := app.New(ctx, appOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the extension: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- application.Run(ctx)
+	}()
+
+	sender.logsURL = runtimeAPI.logsURL
+	sendErr := make(chan error, 1)
+	go func() {
+		start, err := runtimeAPI.startTime(ctx)
+		if err != nil {
+			sendErr <- err
+			return
+		}
+		sendErr <- sender.send(ctx, inputs, recordStart, start)
+	}()
+
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("replayed extension failed: %w", err)
+	}
+	cancel()
+	if err := <-sendErr; err != nil && !errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	return compare(expected, apmServer.events(), cfg.ignoredFields)
+}
+
+// runtimeAPI is a stand-in for the Lambda Runtime API. It returns the
+// recorded next events with their recorded timing, followed by a SHUTDOWN
+// event if the recording has none. The replay starts with the first next
+// event request, once the extension is ready to receive data.
+type runtimeAPI struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	nextEvents  []recorder.Entry
+	recordStart time.Time
+
+	startOnce sync.Once
+	start     time.Time
+	started   chan struct{}
+
+	logsOnce sync.Once
+	logsCh   chan string
+}
+
+func newRuntimeAPI(nextEvents []recorder.Entry, recordStart time.Time) *runtimeAPI {
+	api := &runtimeAPI{
+		nextEvents:  nextEvents,
+		recordStart: recordStart,
+		started:     make(chan struct{}),
+		logsCh:      make(chan string, 1),
+	}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.handle))
+	return api
+}
+
+func (api *runtimeAPI) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/extension/register"):
+		w.Header().Set("Lambda-Extension-Identifier", "replay")
+		_ = json.NewEncoder(w).Encode(extension.RegisterResponse{
+			FunctionName:    os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+			FunctionVersion: os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"),
+		})
+	case strings.HasSuffix(r.URL.Path, "/extension/event/next"):
+		api.startOnce.Do(func() {
+			api.start = time.Now()
+			close(api.started)
+		})
+		body, err := api.nextEvent(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(body)
+	case strings.HasSuffix(r.URL.Path, "/logs") || strings.HasSuffix(r.URL.Path, "/telemetry"):
+		var subscription struct {
+			Destination struct {
+				URI string `json:"URI"`
+			} `json:"destination"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		api.logsOnce.Do(func() { api.logsCh <- subscription.Destination.URI })
+	}
+}
+
+// nextEvent returns the next recorded event once its recorded time is
+// reached. Deadlines are shifted by the offset of the replay.
+func (api *runtimeAPI) nextEvent(ctx context.Context) ([]byte, error) {
+	api.mu.Lock()
+	var entry *recorder.Entry
+	if len(api.nextEvents) > 0 {
+		entry = &api.nextEvents[0]
+		api.nextEvents = api.nextEvents[1:]
+	}
+	api.mu.Unlock()
+
+	if entry == nil {
+		return json.Marshal(extension.NextEventResponse{
+			EventType:      extension.Shutdown,
+			ShutdownReason: "spindown",
+			DeadlineMs:     time.Now().Add(2 * time.Second).UnixMilli(),
+		})
+	}
+	if err := waitUntil(ctx, entry.Time, api.recordStart, api.start); err != nil {
+		return nil, err
+	}
+	var event extension.NextEventResponse
+	if err := json.Unmarshal([]byte(entry.Body), &event); err != nil {
+		return nil, fmt.Errorf("failed to decode recorded next event: %w", err)
+	}
+	event.Timestamp = time.Time{}
+	if event.DeadlineMs > 0 {
+		event.DeadlineMs += api.start.Sub(api.recordStart).Milliseconds()
+	}
+	return json.Marshal(event)
+}
+
+// startTime waits for the first next event request and returns its time.
+func (api *runtimeAPI) startTime(ctx context.Context) (time.Time, error) {
+	select {
+	case <-api.started:
+		return api.start, nil
+	case <-ctx.Done():
+		return time.Time{}, ctx.Err()
+	}
+}
+
+// logsURL waits for the subscription to the Logs or Telemetry API and
+// returns the URL of the listener of the extension.
+func (api *runtimeAPI) logsURL(ctx context.Context) (string, error) {
+	select {
+	case uri := <-api.logsCh:
+		api.logsCh <- uri
+		return uri, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// inputSender sends the recorded Logs API pushes, agent and OTLP requests,
+// and X-Ray and StatsD datagrams to the extension.
+type inputSender struct {
+	receiverURL string
+	xrayAddr    string
+	statsdAddr  string
+	logsURL     func(context.Context) (string, error)
+}
+
+func (s *inputSender) send(ctx context.Context, inputs []recorder.Entry, recordStart, start time.Time) error {
+	for _, entry := range inputs {
+		if err := waitUntil(ctx, entry.Time, recordStart, start); err != nil {
+			return err
+		}
+		body, err := entry.Data()
+		if err != nil {
+			return err
+		}
+		switch entry.Source {
+		case recorder.XRay:
+			if err := sendDatagram(s.xrayAddr, body); err != nil {
+				return err
+			}
+			continue
+		case recorder.StatsD:
+			if err := sendDatagram(s.statsdAddr, body); err != nil {
+				return err
+			}
+			continue
+		}
+		url := s.receiverURL + entry.Path
+		if entry.Source == recorder.LogsPush {
+			logsURL, err := s.logsURL(ctx)
+			if err != nil {
+				return err
+			}
+			url = logsURL
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create %s request: %w", entry.Source, err)
+		}
+		for key, value := range entry.Header {
+			req.Header.Set(key, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to send %s request: %w", entry.Source, err)
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func sendDatagram(addr string, datagram []byte) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to send datagram to %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(datagram); err != nil {
+		return fmt.Errorf("failed to send datagram to %s: %w", addr, err)
+	}
+	return nil
+}
+
+// apmServer is a stand-in for the APM Server collecting the intake events.
+type apmServer struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	data []string
+}
+
+func newAPMServer() *apmServer {
+	s := &apmServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/intake/v2/events" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"version":"8.0.0"}`))
+			return
+		}
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, err := accumulator.GetUncompressedBytes(buf.Bytes(), r.Header.Get("Content-Encoding"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.data = append(s.data, splitEvents(body)...)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return s
+}
+
+func (s *apmServer) events() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.data...)
+}
+
+// compare normalizes the expected and actual events and matches them
+// regardless of their order.
+func compare(expected, actual []string, ignoredFields []string) (*Result, error) {
+	ignored := make(map[string]bool, len(ignoredFields))
+	for _, field := range ignoredFields {
+		ignored[field] = true
+	}
+	result := &Result{}
+	var err error
+	if result.Expected, err = normalize(expected, ignored); err != nil {
+		return nil, fmt.Errorf("failed to normalize the recorded events: %w", err)
+	}
+	if result.Actual, err = normalize(actual, ignored); err != nil {
+		return nil, fmt.Errorf("failed to normalize the replayed events: %w", err)
+	}
+
+	remaining := make(map[string]int, len(result.Actual))
+	for _, event := range result.Actual {
+		remaining[event]++
+	}
+	for _, event := range result.Expected {
+		if remaining[event] > 0 {
+			remaining[event]--
+			continue
+		}
+		result.Missing = append(result.Missing, event)
+	}
+	for _, event := range result.Actual {
+		if remaining[event] > 0 {
+			remaining[event]--
+			result.Unexpected = append(result.Unexpected, event)
+		}
+	}
+	return result, nil
+}
+
+func normalize(events []string, ignored map[string]bool) ([]string, error) {
+	normalized := make([]string, 0, len(events))
+	for _, event := range events {
+		var v map[string]interface{}
+		if err := json.Unmarshal([]byte(event), &v); err != nil {
+			return nil, err
+		}
+		if _, ok := v["metadata"]; ok {
+			continue
+		}
+		removeFields(v, ignored)
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, string(b))
+	}
+	return normalized, nil
+}
+
+func removeFields(v interface{}, ignored map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if ignored[key] {
+				delete(v, key)
+				continue
+			}
+			removeFields(value, ignored)
+		}
+	case []interface{}:
+		for _, value := range v {
+			removeFields(value, ignored)
+		}
+	}
+}
+
+// splitEvents splits ndjson data into its events.
+func splitEvents(data []byte) []string {
+	var events []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 10*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			events = append(events, line)
+		}
+	}
+	return events
+}
+
+// waitUntil waits until the offset of the recorded time from the start of
+// the recording has elapsed since the start of the replay.
+func waitUntil(ctx context.Context, recorded, recordStart, start time.Time) error {
+	timer := time.NewTimer(time.Until(start.Add(recorded.Sub(recordStart))))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func freeUDPAddr() (string, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().String(), nil
+}
+
+// setenv sets the environment variables, unsetting the empty ones, and
+// returns a function restoring their previous values.
+func setenv(vars map[string]string) (func(), error) {
+	previous := make(map[string]*string, len(vars))
+	restore := func() {
+		for key, value := range previous {
+			if value == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *value)
+			}
+		}
+	}
+	for key, value := range vars {
+		if old, ok := os.LookupEnv(key); ok {
+			previous[key] = &old
+		} else {
+			previous[key] = nil
+		}
+		var err error
+		if value == "" {
+			err = os.Unsetenv(key)
+		} else {
+			err = os.Setenv(key, value)
+		}
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	return restore, nil
+}
@@ -0,0 +1,153 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package replay
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/apmservertest"
+	"github.com/elastic/apm-aws-lambda/app"
+	"github.com/elastic/apm-aws-lambda/emulator"
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	f, err := os.Open("testdata/invocation.ndjson")
+	require.NoError(t, err)
+	defer f.Close()
+	entries, err := recorder.Read(f)
+	require.NoError(t, err)
+
+	result, err := Run(context.Background(), entries)
+	require.NoError(t, err)
+	assert.Len(t, result.Expected, 3)
+	assert.True(t, result.Matches(), "missing: %v\nunexpected: %v", result.Missing, result.Unexpected)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := apmservertest.NewServer()
+	defer server.Close()
+	emu := emulator.New(emulator.WithFunction("replay-test", "1"))
+	defer emu.Close()
+
+	receiverPort, err := freePort()
+	require.NoError(t, err)
+	receiverURL := "http://127.0.0.1:" + strconv.Itoa(receiverPort)
+	recordPath := filepath.Join(t.TempDir(), "record.ndjson")
+	t.Setenv("ELASTIC_APM_LAMBDA_APM_SERVER", server.URL)
+	t.Setenv("ELASTIC_APM_DATA_RECEIVER_SERVER_PORT", strconv.Itoa(receiverPort))
+	t.Setenv("ELASTIC_APM_LAMBDA_RECORD_FILE", recordPath)
+	xrayAddr, err := freeUDPAddr()
+	require.NoError(t, err)
+	t.Setenv("ELASTIC_APM_LAMBDA_XRAY_LISTENER_ADDRESS", xrayAddr)
+	t.Setenv("ELASTIC_APM_LAMBDA_XRAY_RELAY", "false")
+	statsdAddr, err := freeUDPAddr()
+	require.NoError(t, err)
+	t.Setenv("ELASTIC_APM_LAMBDA_STATSD_LISTENER_ADDRESS", statsdAddr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	application, err := app.New(ctx,
+		app.WithExtensionName("apm-lambda-extension"),
+		app.WithLambdaRuntimeAPI(emu.RuntimeAPI()),
+		app.WithLogLevel("info"),
+		app.WithLogsapiAddress("127.0.0.1:0"),
+		app.WithFunctionLogSubscription(),
+	)
+	require.NoError(t, err)
+
+	emu.Invoke(emulator.Invocation{
+		RequestID: "req-1",
+		Duration:  50 * time.Millisecond,
+		Logs:      []string{"hello from the recording"},
+		Handler: func(ctx context.Context, inv emulator.InvocationContext) {
+			assert.NoError(t, sendDatagram(xrayAddr, []byte(`{"format": "json", "version": 1}`+"\n"+
+				`{"name": "segment", "id": "70de5b6f19ff9a0a", "trace_id": "1-581cf771-a006649127e371903a2de979", "start_time": 1478293361.271, "end_time": 1478293361.449}`)))
+			assert.NoError(t, sendDatagram(statsdAddr, []byte("orders.processed:3|c")))
+			body := `{"metadata":{"service":{"name":"replay-test","agent":{"name":"nodejs","version":"4.0.0"}}}}` + "\n" +
+				`{"transaction":{"id":"c5ea9ba7dbfcd6ee","trace_id":"0af7651916cd43dd8448eb211c80319c","name":"GET /hello","type":"request","duration":40,"outcome":"success","sampled":true,"span_count":{"started":0}}}` + "\n"
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, receiverURL+"/intake/v2/events?flushed=true", strings.NewReader(body))
+			if !assert.NoError(t, err) {
+				return
+			}
+			req.Header.Set("Content-Type", "application/x-ndjson")
+			resp, err := http.DefaultClient.Do(req)
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+			}
+		},
+	})
+	emu.Shutdown(emulator.Shutdown{})
+	require.NoError(t, application.Run(ctx))
+
+	// The recording of the extension replays to the same output.
+	f, err := os.Open(recordPath)
+	require.NoError(t, err)
+	defer f.Close()
+	entries, err := recorder.Read(f)
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+
+	result, err := Run(context.Background(), entries)
+	require.NoError(t, err)
+	recorded := strings.Join(result.Expected, "\n")
+	assert.Contains(t, recorded, `"name":"GET /hello"`)
+	assert.Contains(t, recorded, `"name":"segment"`)
+	assert.Contains(t, recorded, `"message":"hello from the recording"`)
+	assert.Contains(t, recorded, `"orders.processed"`)
+	assert.True(t, result.Matches(), "missing: %v\nunexpected: %v", result.Missing, result.Unexpected)
+}
+
+func TestRunUnrecordedListener(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := Run(context.Background(), []recorder.Entry{
+		{Time: ts, Source: recorder.Config, Body: `{"env":{"ELASTIC_APM_LAMBDA_LOG_MIN_LEVEL":"info"}}`},
+		{Time: ts, Source: recorder.StatsD, Body: "orders.processed:3|c"},
+	})
+	assert.ErrorContains(t, err, "no recorded StatsD listener")
+}
+
+func TestCompare(t *testing.T) {
+	expected := []string{
+		`{"metadata":{"service":{"name":"a"}}}`,
+		`{"transaction":{"id":"1","name":"a"}}`,
+		`{"log":{"message":"a"}}`,
+		`{"log":{"message":"a"}}`,
+	}
+	actual := []string{
+		`{"log":{"message":"a"}}`,
+		`{"metadata":{"service":{"name":"b"}}}`,
+		`{"transaction":{"id":"2","name":"a"}}`,
+		`{"log":{"message":"b"}}`,
+	}
+
+	result, err := compare(expected, actual, DefaultIgnoredFields)
+	require.NoError(t, err)
+	assert.False(t, result.Matches())
+	assert.Equal(t, []string{`{"log":{"message":"a"}}`}, result.Missing)
+	assert.Equal(t, []string{`{"log":{"message":"b"}}`}, result.Unexpected)
+}
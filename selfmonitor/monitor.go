@@ -0,0 +1,227 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package selfmonitor collects metrics about the extension itself, such
+// as dropped events and requests to the APM Server, and reports them as
+// intake v2 metricsets.
+package selfmonitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"github.com/elastic/apm-aws-lambda/version"
+	"go.elastic.co/fastjson"
+)
+
+// Names of the self-monitoring metrics. Counters are reset when they are
+// reported.
+const (
+	// AgentDataChannelDropped counts the agent requests dropped because
+	// the agent data channel was full.
+	AgentDataChannelDropped = "extension.agent_data.channel_dropped"
+	// OTLPDataChannelDropped counts the OTLP payloads dropped because the
+	// agent data channel was full.
+	OTLPDataChannelDropped = "extension.otlp_data.channel_dropped"
+	// BatchFull counts the events dropped because the batch was full.
+	BatchFull = "extension.batch.full"
+	// BatchMetadataUnavailable counts the events dropped because no
+	// metadata was available.
+	BatchMetadataUnavailable = "extension.batch.metadata_unavailable"
+	// ProxyTransactions, SyntheticTransactions and InvocationErrors count
+	// the events created by the extension for the invocations.
+	ProxyTransactions     = "extension.batch.proxy_transactions"
+	SyntheticTransactions = "extension.batch.synthetic_transactions"
+	InvocationErrors      = "extension.batch.invocation_errors"
+	// APMServerRequests and APMServerRequestFailures count the requests
+	// to the APM Server and the requests that failed.
+	APMServerRequests        = "extension.apm_server.requests"
+	APMServerRequestFailures = "extension.apm_server.request_failures"
+	// APMServerLatency is the histogram of the latency of the requests to
+	// the APM Server, in milliseconds.
+	APMServerLatency = "extension.apm_server.latency"
+	// APMServerBytesSent is the number of bytes sent to the APM Server,
+	// after compression.
+	APMServerBytesSent = "extension.apm_server.bytes_sent"
+	// APMServerGracePeriods counts the grace periods entered after
+	// failures of the APM Server.
+	APMServerGracePeriods = "extension.apm_server.grace_periods"
+	// APMServerStatusPrefix prefixes the counters of the transitions of
+	// the transport status, e.g. extension.apm_server.status.failing.
+	APMServerStatusPrefix = "extension.apm_server.status."
+	// LogEventsReceived counts the events received from the Logs or
+	// Telemetry API.
+	LogEventsReceived = "extension.logs.received"
+	// LogEventsRejected counts the events rejected because they could not
+	// be enqueued, the Lambda service retries them.
+	LogEventsRejected = "extension.logs.rejected"
+	// LogEventsFiltered counts the log lines dropped below the minimum
+	// log level.
+	LogEventsFiltered = "extension.logs.filtered"
+	// LogEventsFilteredPrefix prefixes the counters of the log lines
+	// dropped below the minimum log level per level, e.g.
+	// extension.logs.filtered.debug.
+	LogEventsFilteredPrefix = "extension.logs.filtered."
+	// LogEventsLimited counts the log lines dropped by the log limits.
+	LogEventsLimited = "extension.logs.limited"
+	// LogEventsPlatformDropped counts the log records dropped by the
+	// Lambda service because the extension fell behind.
+	LogEventsPlatformDropped = "extension.logs.platform_dropped"
+)
+
+// versionLabel is the label holding the version of the extension.
+const versionLabel = "extension_version"
+
+// latencyBounds are the upper bounds of the buckets of the latency
+// histograms, in milliseconds.
+var latencyBounds = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 30000}
+
+// Monitor collects the self-monitoring metrics of the extension. A nil
+// Monitor discards all the metrics so that components can record metrics
+// unconditionally.
+type Monitor struct {
+	mu         sync.Mutex
+	interval   time.Duration
+	lastFlush  time.Time
+	counters   map[string]float64
+	histograms map[string][]uint64
+}
+
+// New returns a Monitor reporting its metrics at most once per interval.
+func New(interval time.Duration) *Monitor {
+	return &Monitor{
+		interval:   interval,
+		counters:   make(map[string]float64),
+		histograms: make(map[string][]uint64),
+	}
+}
+
+// Inc increments the counter by one.
+func (m *Monitor) Inc(name string) {
+	m.Add(name, 1)
+}
+
+// Add adds delta to the counter.
+func (m *Monitor) Add(name string, delta float64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += delta
+}
+
+// ObserveDuration records a duration in the histogram.
+func (m *Monitor) ObserveDuration(name string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	ms := float64(d) / float64(time.Millisecond)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts, ok := m.histograms[name]
+	if !ok {
+		counts = make([]uint64, len(latencyBounds)+1)
+		m.histograms[name] = counts
+	}
+	counts[sort.SearchFloat64s(latencyBounds, ms)]++
+}
+
+// FlushMetrics returns the metrics collected since the last flush as an
+// intake v2 metricset, tagged with the version of the extension. Nothing
+// is returned if the interval has not elapsed since the last flush.
+func (m *Monitor) FlushMetrics(ts time.Time) ([][]byte, error) {
+	return m.flush(ts, false)
+}
+
+// Flush returns the metrics collected since the last flush regardless of
+// the interval, for instance at shutdown.
+func (m *Monitor) Flush(ts time.Time) ([][]byte, error) {
+	return m.flush(ts, true)
+}
+
+func (m *Monitor) flush(ts time.Time, force bool) ([][]byte, error) {
+	if m == nil {
+		return nil, nil
+	}
+	counters, histograms := m.take(ts, force)
+	if len(counters) == 0 && len(histograms) == 0 {
+		return nil, nil
+	}
+	mc := model.MetricsContainer{
+		Metrics: &model.Metrics{
+			Timestamp: model.Time(ts),
+			Labels:    model.Labels{versionLabel: version.Version},
+		},
+	}
+	for name, v := range counters {
+		mc.Add(name, v)
+	}
+	for name, counts := range histograms {
+		values, nonZero := histogramValues(counts)
+		mc.AddHistogram(name, "ms", values, nonZero)
+	}
+	var w fastjson.Writer
+	if err := mc.MarshalFastJSON(&w); err != nil {
+		return nil, err
+	}
+	return [][]byte{w.Bytes()}, nil
+}
+
+// take returns and resets the collected metrics if the interval has
+// elapsed since the last flush, or if force is true.
+func (m *Monitor) take(ts time.Time, force bool) (map[string]float64, map[string][]uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lastFlush.IsZero() {
+		m.lastFlush = ts
+	}
+	if !force && ts.Sub(m.lastFlush) < m.interval {
+		return nil, nil
+	}
+	counters, histograms := m.counters, m.histograms
+	m.counters = make(map[string]float64)
+	m.histograms = make(map[string][]uint64)
+	m.lastFlush = ts
+	return counters, histograms
+}
+
+// histogramValues returns the midpoints and counts of the non empty
+// buckets. Values above the last bound are reported as the last bound.
+func histogramValues(counts []uint64) ([]float64, []uint64) {
+	var values []float64
+	var nonZero []uint64
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		var value float64
+		switch {
+		case i == len(latencyBounds):
+			value = latencyBounds[i-1]
+		case i == 0:
+			value = latencyBounds[0] / 2
+		default:
+			value = (latencyBounds[i-1] + latencyBounds[i]) / 2
+		}
+		values = append(values, value)
+		nonZero = append(nonZero, count)
+	}
+	return values, nonZero
+}
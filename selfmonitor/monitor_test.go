@@ -0,0 +1,85 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package selfmonitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func sample(metricset []byte, name string) gjson.Result {
+	return gjson.GetBytes(metricset, "metricset.samples."+strings.ReplaceAll(name, ".", "\\."))
+}
+
+func TestMonitor(t *testing.T) {
+	ts := time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC)
+	m := New(time.Minute)
+	m.Inc(BatchFull)
+	m.Inc(BatchFull)
+	m.Add(APMServerBytesSent, 1024)
+	m.ObserveDuration(APMServerLatency, 30*time.Millisecond)
+	m.ObserveDuration(APMServerLatency, 40*time.Millisecond)
+	m.ObserveDuration(APMServerLatency, time.Minute)
+
+	// The first flush starts the interval.
+	metricsets, err := m.FlushMetrics(ts)
+	require.NoError(t, err)
+	assert.Empty(t, metricsets)
+	metricsets, err = m.FlushMetrics(ts.Add(30 * time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, metricsets)
+
+	metricsets, err = m.FlushMetrics(ts.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, metricsets, 1)
+	ms := metricsets[0]
+	assert.Equal(t, ts.Add(time.Minute).UnixMicro(), gjson.GetBytes(ms, "metricset.timestamp").Int())
+	assert.Equal(t, version.Version, gjson.GetBytes(ms, "metricset.tags.extension_version").String())
+	assert.Equal(t, 2.0, sample(ms, BatchFull).Get("value").Float())
+	assert.Equal(t, 1024.0, sample(ms, APMServerBytesSent).Get("value").Float())
+	latency := sample(ms, APMServerLatency)
+	assert.Equal(t, "histogram", latency.Get("type").String())
+	assert.Equal(t, "[35,30000]", latency.Get("values").Raw)
+	assert.Equal(t, "[2,1]", latency.Get("counts").Raw)
+
+	// The metrics are reset once reported.
+	metricsets, err = m.Flush(ts.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, metricsets)
+
+	m.Inc(LogEventsReceived)
+	metricsets, err = m.Flush(ts.Add(time.Minute + time.Second))
+	require.NoError(t, err)
+	require.Len(t, metricsets, 1)
+	assert.Equal(t, 1.0, sample(metricsets[0], LogEventsReceived).Get("value").Float())
+}
+
+func TestNilMonitor(t *testing.T) {
+	var m *Monitor
+	m.Inc(BatchFull)
+	m.ObserveDuration(APMServerLatency, time.Second)
+	metricsets, err := m.Flush(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, metricsets)
+}
@@ -0,0 +1,252 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package statsd
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"go.elastic.co/fastjson"
+)
+
+// Aggregator aggregates StatsD metrics until they are flushed. Counters
+// are summed, gauges keep their last value, sets count their distinct
+// values and timers, histograms and distributions are encoded as intake
+// v2 histograms.
+type Aggregator struct {
+	mu         sync.Mutex
+	metricsets map[string]*metricset
+	// gauges holds the last value of the gauges by tag set. It is kept
+	// across flushes as relative updates apply to the last value.
+	gauges map[string]map[string]float64
+}
+
+type metricset struct {
+	tags       map[string]string
+	counters   map[string]float64
+	gauges     map[string]float64
+	sets       map[string]map[string]struct{}
+	histograms map[string]*histogram
+}
+
+// bucketsPerPowerOfTwo sets the resolution of the histograms. Values are
+// counted in exponential buckets 2^(1/8), or about 9%, wider than the
+// previous one, so that the number of buckets is bounded whatever the
+// number of distinct values.
+const bucketsPerPowerOfTwo = 8
+
+type histogram struct {
+	unit    string
+	buckets map[int]*bucket
+}
+
+// bucket counts the values of a histogram bucket. The bucket is
+// reported as the mean of its values, which is exact for buckets
+// holding a single distinct value.
+type bucket struct {
+	count uint64
+	sum   float64
+}
+
+// NewAggregator returns an empty Aggregator.
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		metricsets: make(map[string]*metricset),
+		gauges:     make(map[string]map[string]float64),
+	}
+}
+
+// Add aggregates a metric.
+func (a *Aggregator) Add(m Metric) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := tagsKey(m.Tags)
+	ms, ok := a.metricsets[key]
+	if !ok {
+		ms = &metricset{tags: m.Tags}
+		a.metricsets[key] = ms
+	}
+	switch m.Type {
+	case Counter:
+		if ms.counters == nil {
+			ms.counters = make(map[string]float64)
+		}
+		for _, v := range m.Values {
+			ms.counters[m.Name] += v / m.SampleRate
+		}
+	case Gauge:
+		if ms.gauges == nil {
+			ms.gauges = make(map[string]float64)
+		}
+		gauges, ok := a.gauges[key]
+		if !ok {
+			gauges = make(map[string]float64)
+			a.gauges[key] = gauges
+		}
+		for _, v := range m.Values {
+			if m.Relative {
+				gauges[m.Name] += v
+			} else {
+				gauges[m.Name] = v
+			}
+		}
+		ms.gauges[m.Name] = gauges[m.Name]
+	case Set:
+		if ms.sets == nil {
+			ms.sets = make(map[string]map[string]struct{})
+		}
+		if ms.sets[m.Name] == nil {
+			ms.sets[m.Name] = make(map[string]struct{})
+		}
+		ms.sets[m.Name][m.SetValue] = struct{}{}
+	case Timer, Histogram, Distribution:
+		if ms.histograms == nil {
+			ms.histograms = make(map[string]*histogram)
+		}
+		h, ok := ms.histograms[m.Name]
+		if !ok {
+			h = &histogram{buckets: make(map[int]*bucket)}
+			if m.Type == Timer {
+				h.unit = "ms"
+			}
+			ms.histograms[m.Name] = h
+		}
+		count := uint64(math.Max(1, math.Round(1/m.SampleRate)))
+		for _, v := range m.Values {
+			h.observe(v, count)
+		}
+	}
+}
+
+// Flush returns the aggregated metrics as intake v2 metricset events, one
+// per tag set, and resets the aggregator. The gauges updated since the
+// last flush are reported, their last value is kept. The timestamp is
+// used for all the metricsets.
+func (a *Aggregator) Flush(ts time.Time) ([][]byte, error) {
+	a.mu.Lock()
+	metricsets := a.metricsets
+	a.metricsets = make(map[string]*metricset)
+	a.mu.Unlock()
+
+	keys := make([]string, 0, len(metricsets))
+	for k := range metricsets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	events := make([][]byte, 0, len(metricsets))
+	for _, k := range keys {
+		ms := metricsets[k]
+		mc := model.MetricsContainer{
+			Metrics: &model.Metrics{Timestamp: model.Time(ts)},
+		}
+		for name, tagValue := range ms.tags {
+			if mc.Metrics.Labels == nil {
+				mc.Metrics.Labels = make(model.Labels)
+			}
+			mc.Metrics.Labels.Set(name, tagValue)
+		}
+		for name, v := range ms.counters {
+			mc.Add(name, v)
+		}
+		for name, v := range ms.gauges {
+			mc.Add(name, v)
+		}
+		for name, values := range ms.sets {
+			mc.Add(name, float64(len(values)))
+		}
+		for name, h := range ms.histograms {
+			values, counts := h.values()
+			mc.AddHistogram(name, h.unit, values, counts)
+		}
+		var w fastjson.Writer
+		if err := mc.MarshalFastJSON(&w); err != nil {
+			return nil, err
+		}
+		events = append(events, w.Bytes())
+	}
+	return events, nil
+}
+
+// observe counts a value in its bucket. Infinite and NaN values are
+// ignored.
+func (h *histogram) observe(v float64, count uint64) {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return
+	}
+	index := bucketIndex(v)
+	b, ok := h.buckets[index]
+	if !ok {
+		b = &bucket{}
+		h.buckets[index] = b
+	}
+	b.count += count
+	b.sum += v * float64(count)
+}
+
+// bucketIndex returns the index of the bucket of a value. Zero has its
+// own bucket, the indexes of positive values are positive, as the
+// smallest float64 is 2^-1074, and negative values have the opposite
+// index of their absolute value, so that indexes sort as the values.
+func bucketIndex(v float64) int {
+	if v == 0 {
+		return 0
+	}
+	index := 1 + int(math.Ceil(math.Log2(math.Abs(v))*bucketsPerPowerOfTwo)) + 1074*bucketsPerPowerOfTwo
+	if v < 0 {
+		return -index
+	}
+	return index
+}
+
+func (h *histogram) values() ([]float64, []uint64) {
+	indexes := make([]int, 0, len(h.buckets))
+	for i := range h.buckets {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	values := make([]float64, len(indexes))
+	counts := make([]uint64, len(indexes))
+	for i, index := range indexes {
+		b := h.buckets[index]
+		values[i] = b.sum / float64(b.count)
+		counts[i] = b.count
+	}
+	return values, counts
+}
+
+func tagsKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(tags[k])
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package statsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator()
+	for _, line := range []string{
+		"orders:1|c",
+		"orders:2|c|@0.5",
+		"queue:10|g",
+		"queue:+5|g",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+		"latency:20|ms",
+		"latency:10:20|ms",
+		"orders:1|c|#region:eu",
+	} {
+		m, err := ParseLine(line)
+		require.NoError(t, err)
+		a.Add(m)
+	}
+
+	ts := time.Unix(1665532800, 0)
+	events, err := a.Flush(ts)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	assert.JSONEq(t, `{"metricset":{
+		"timestamp":1665532800000000,
+		"samples":{
+			"orders":{"value":5},
+			"queue":{"value":15},
+			"users":{"value":2},
+			"latency":{"type":"histogram","unit":"ms","values":[10,20],"counts":[1,2]}
+		}
+	}}`, string(events[0]))
+	assert.JSONEq(t, `{"metricset":{
+		"timestamp":1665532800000000,
+		"samples":{"orders":{"value":1}},
+		"tags":{"region":"eu"}
+	}}`, string(events[1]))
+
+	events, err = a.Flush(ts)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestAggregatorGauges(t *testing.T) {
+	a := NewAggregator()
+	add := func(line string) {
+		m, err := ParseLine(line)
+		require.NoError(t, err)
+		a.Add(m)
+	}
+	ts := time.Unix(1665532800, 0)
+
+	add("queue:10|g")
+	events, err := a.Flush(ts)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.JSONEq(t, `{"metricset":{"timestamp":1665532800000000,"samples":{"queue":{"value":10}}}}`, string(events[0]))
+
+	// Relative updates apply to the value of the previous flush.
+	add("queue:-3|g")
+	add("queue:+1|g")
+	events, err = a.Flush(ts)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.JSONEq(t, `{"metricset":{"timestamp":1665532800000000,"samples":{"queue":{"value":8}}}}`, string(events[0]))
+
+	// Gauges that were not updated are not reported again.
+	events, err = a.Flush(ts)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestAggregatorHistogramBuckets(t *testing.T) {
+	a := NewAggregator()
+	for i := 0; i < 100000; i++ {
+		a.Add(Metric{Name: "latency", Type: Timer, Values: []float64{float64(i) / 10}, SampleRate: 1})
+	}
+	a.Add(Metric{Name: "latency", Type: Timer, Values: []float64{-5, 0}, SampleRate: 1})
+
+	h := a.metricsets[""].histograms["latency"]
+	assert.Less(t, len(h.buckets), 200)
+	values, counts := h.values()
+	assert.Equal(t, -5.0, values[0])
+	assert.Equal(t, uint64(1), counts[0])
+	assert.Equal(t, 0.0, values[1])
+	assert.Equal(t, uint64(2), counts[1])
+	assert.IsIncreasing(t, values)
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	assert.Equal(t, uint64(100002), total)
+}
@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package statsd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultListenerAddr = "127.0.0.1:8125"
+	// maxDatagramSize is the maximum size of an UDP datagram.
+	maxDatagramSize = 64 * 1024
+)
+
+// Listener receives StatsD and DogStatsD lines over UDP and aggregates
+// them until they are flushed.
+type Listener struct {
+	addr       string
+	recorder   *recorder.Recorder
+	logger     *zap.SugaredLogger
+	aggregator *Aggregator
+
+	conn net.PacketConn
+	wg   sync.WaitGroup
+}
+
+// NewListener returns a new Listener configured with the given options.
+func NewListener(opts ...Option) (*Listener, error) {
+	l := Listener{
+		addr:       defaultListenerAddr,
+		aggregator: NewAggregator(),
+	}
+
+	for _, opt := range opts {
+		opt(&l)
+	}
+
+	if l.logger == nil {
+		return nil, errors.New("logger cannot be nil")
+	}
+
+	return &l, nil
+}
+
+// Start starts listening for metrics.
+func (l *Listener) Start() error {
+	conn, err := net.ListenPacket("udp", l.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on addr %s: %w", l.addr, err)
+	}
+	l.conn = conn
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		l.logger.Infof("Extension listening for StatsD metrics on %s", conn.LocalAddr())
+		l.serve()
+	}()
+	return nil
+}
+
+// Addr returns the address the listener is listening on.
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Shutdown stops the listener.
+func (l *Listener) Shutdown() error {
+	err := l.conn.Close()
+	l.wg.Wait()
+	return err
+}
+
+// FlushMetrics returns the metrics aggregated since the last flush as
+// intake v2 metricset events.
+func (l *Listener) FlushMetrics(ts time.Time) ([][]byte, error) {
+	return l.aggregator.Flush(ts)
+}
+
+func (l *Listener) serve() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.logger.Errorf("Failed to read StatsD datagram: %v", err)
+			}
+			return
+		}
+		if err := l.recorder.Record(recorder.StatsD, buf[:n]); err != nil {
+			l.logger.Warnf("Failed to record StatsD datagram: %v", err)
+		}
+		for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			m, err := ParseLine(string(line))
+			if err != nil {
+				l.logger.Debugf("Dropping StatsD metric: %v", err)
+				continue
+			}
+			l.aggregator.Add(m)
+		}
+	}
+}
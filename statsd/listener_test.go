@@ -0,0 +1,59 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package statsd_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/statsd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestListener(t *testing.T) {
+	l, err := statsd.NewListener(
+		statsd.WithListenerAddress("127.0.0.1:0"),
+		statsd.WithLogger(zaptest.NewLogger(t).Sugar()),
+	)
+	require.NoError(t, err)
+	require.NoError(t, l.Start())
+	defer func() {
+		require.NoError(t, l.Shutdown())
+	}()
+
+	conn, err := net.Dial("udp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("invalid\norders:1:2|c\n"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		events, err := l.FlushMetrics(time.Now())
+		require.NoError(t, err)
+		if len(events) == 0 {
+			return false
+		}
+		assert.Equal(t, 3.0, gjson.GetBytes(events[0], "metricset.samples.orders.value").Float())
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,114 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MetricType is the type of a StatsD metric.
+type MetricType string
+
+const (
+	Counter      MetricType = "c"
+	Gauge        MetricType = "g"
+	Timer        MetricType = "ms"
+	Histogram    MetricType = "h"
+	Distribution MetricType = "d"
+	Set          MetricType = "s"
+)
+
+// Metric is a single StatsD line. DogStatsD lines can hold more than one
+// value for the same metric.
+type Metric struct {
+	Name       string
+	Type       MetricType
+	Values     []float64
+	SampleRate float64
+	Tags       map[string]string
+	// Relative is true for gauges updated with a signed value.
+	Relative bool
+	// SetValue holds the raw value of set metrics.
+	SetValue string
+}
+
+// ParseLine parses a StatsD line of the form `<name>:<value>|<type>`,
+// with the optional DogStatsD `|@<sample rate>` and `|#<tag>:<value>,...`
+// sections.
+func ParseLine(line string) (Metric, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return Metric{}, fmt.Errorf("invalid statsd line %q: missing name", line)
+	}
+	sections := strings.Split(rest, "|")
+	if len(sections) < 2 {
+		return Metric{}, fmt.Errorf("invalid statsd line %q: missing type", line)
+	}
+	m := Metric{
+		Name:       name,
+		Type:       MetricType(sections[1]),
+		SampleRate: 1,
+	}
+	switch m.Type {
+	case Counter, Gauge, Timer, Histogram, Distribution, Set:
+	default:
+		return Metric{}, fmt.Errorf("invalid statsd line %q: unsupported type %q", line, m.Type)
+	}
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Metric{}, fmt.Errorf("invalid statsd line %q: invalid sample rate", line)
+			}
+			m.SampleRate = rate
+		case strings.HasPrefix(section, "#"):
+			m.Tags = parseTags(section[1:])
+		}
+	}
+	if m.Type == Set {
+		m.SetValue = sections[0]
+		return m, nil
+	}
+	if m.Type == Gauge && (strings.HasPrefix(sections[0], "+") || strings.HasPrefix(sections[0], "-")) {
+		m.Relative = true
+	}
+	for _, raw := range strings.Split(sections[0], ":") {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Metric{}, fmt.Errorf("invalid statsd line %q: %w", line, errors.Unwrap(err))
+		}
+		m.Values = append(m.Values, v)
+	}
+	return m, nil
+}
+
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(tag, ":")
+		tags[k] = v
+	}
+	return tags
+}
@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	testCases := map[string]struct {
+		line     string
+		expected Metric
+	}{
+		"counter": {
+			line:     "orders.placed:1|c",
+			expected: Metric{Name: "orders.placed", Type: Counter, Values: []float64{1}, SampleRate: 1},
+		},
+		"sampled counter with tags": {
+			line: "orders.placed:2|c|@0.5|#region:eu,premium",
+			expected: Metric{
+				Name: "orders.placed", Type: Counter, Values: []float64{2}, SampleRate: 0.5,
+				Tags: map[string]string{"region": "eu", "premium": ""},
+			},
+		},
+		"relative gauge": {
+			line:     "queue.size:-3|g",
+			expected: Metric{Name: "queue.size", Type: Gauge, Values: []float64{-3}, SampleRate: 1, Relative: true},
+		},
+		"multi value timer": {
+			line:     "db.latency:12.5:20|ms",
+			expected: Metric{Name: "db.latency", Type: Timer, Values: []float64{12.5, 20}, SampleRate: 1},
+		},
+		"set": {
+			line:     "users:alice|s",
+			expected: Metric{Name: "users", Type: Set, SampleRate: 1, SetValue: "alice"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			m, err := ParseLine(tc.line)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, m)
+		})
+	}
+}
+
+func TestParseLineInvalid(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"orders.placed",
+		"orders.placed:1",
+		"orders.placed:1|x",
+		"orders.placed:abc|c",
+		"orders.placed:1|c|@2",
+	} {
+		_, err := ParseLine(line)
+		assert.Error(t, err, line)
+	}
+}
@@ -0,0 +1,85 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package xray
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidTraceID is returned for trace IDs not following the X-Ray
+// `1-<8 hex digits>-<24 hex digits>` format.
+var ErrInvalidTraceID = errors.New("invalid X-Ray trace ID")
+
+// TraceHeader holds the fields of an X-Ray tracing header, as found in
+// the `X-Amzn-Trace-Id` HTTP header and in the tracing value of Lambda
+// invoke events.
+type TraceHeader struct {
+	// Root is the X-Ray trace ID.
+	Root string
+	// Parent is the ID of the parent segment, in Lambda this is the
+	// ID of the function segment created by the Lambda service.
+	Parent string
+	// Sampled reports the sampling decision.
+	Sampled bool
+}
+
+// ParseTraceHeader parses a tracing header of the form
+// `Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1`.
+func ParseTraceHeader(value string) (TraceHeader, error) {
+	var h TraceHeader
+	for _, part := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "Root":
+			h.Root = v
+		case "Parent":
+			h.Parent = v
+		case "Sampled":
+			h.Sampled = v == "1"
+		}
+	}
+	if h.Root == "" {
+		return TraceHeader{}, fmt.Errorf("missing root in trace header %q", value)
+	}
+	return h, nil
+}
+
+// TraceID returns the W3C trace ID of the header's X-Ray trace ID.
+func (h TraceHeader) TraceID() (string, error) {
+	return TraceID(h.Root)
+}
+
+// TraceID converts an X-Ray trace ID to a W3C trace ID by dropping the
+// version and the separators, e.g. `1-5759e988-bd862e3fe1be46a994272793`
+// becomes `5759e988bd862e3fe1be46a994272793`. This is the mapping used by
+// the OpenTelemetry X-Ray propagator, so traces started by X-Ray keep
+// their identity in Elastic APM.
+func TraceID(xrayID string) (string, error) {
+	parts := strings.Split(xrayID, "-")
+	if len(parts) != 3 || parts[0] != "1" || len(parts[1]) != 8 || len(parts[2]) != 24 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTraceID, xrayID)
+	}
+	id := strings.ToLower(parts[1] + parts[2])
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTraceID, xrayID)
+	}
+	return id, nil
+}
@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package xray
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceHeader(t *testing.T) {
+	h, err := ParseTraceHeader("Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1")
+	require.NoError(t, err)
+	assert.Equal(t, TraceHeader{
+		Root:    "1-5759e988-bd862e3fe1be46a994272793",
+		Parent:  "53995c3f42cd8ad8",
+		Sampled: true,
+	}, h)
+
+	traceID, err := h.TraceID()
+	require.NoError(t, err)
+	assert.Equal(t, "5759e988bd862e3fe1be46a994272793", traceID)
+
+	h, err = ParseTraceHeader("Root=1-5759e988-bd862e3fe1be46a994272793;Lineage=a87bd80c:0")
+	require.NoError(t, err)
+	assert.False(t, h.Sampled)
+	assert.Empty(t, h.Parent)
+
+	_, err = ParseTraceHeader("Parent=53995c3f42cd8ad8")
+	assert.Error(t, err)
+}
+
+func TestTraceID(t *testing.T) {
+	for _, id := range []string{
+		"",
+		"5759e988bd862e3fe1be46a994272793",
+		"2-5759e988-bd862e3fe1be46a994272793",
+		"1-5759e988-bd862e3fe1be46a99427279",
+		"1-5759e988-bd862e3fe1be46a99427279z",
+	} {
+		_, err := TraceID(id)
+		assert.ErrorIs(t, err, ErrInvalidTraceID, id)
+	}
+}
+
+func TestDaemonAddress(t *testing.T) {
+	assert.Equal(t, "169.254.79.129:2000", DaemonAddress("169.254.79.129:2000"))
+	assert.Equal(t, "127.0.0.2:2001", DaemonAddress("tcp:127.0.0.1:2000 udp:127.0.0.2:2001"))
+	assert.Empty(t, DaemonAddress(""))
+}
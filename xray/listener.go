@@ -0,0 +1,177 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package xray
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultListenerAddr = "127.0.0.1:2000"
+	// maxDatagramSize is the maximum size of an UDP datagram.
+	maxDatagramSize = 64 * 1024
+)
+
+// Listener receives the segment documents sent by the X-Ray SDKs to the
+// X-Ray daemon over UDP, translates them into intake v2 events and queues
+// them as extension data. The events are sent with the metadata of the
+// batch and, unlike the APM agent data, the transactions are not taken
+// into account to know whether the invocation was observed by an agent.
+// The datagrams can optionally be relayed to the X-Ray daemon so that
+// traces are still reported to X-Ray.
+type Listener struct {
+	addr        string
+	relayAddr   string
+	dataChannel chan<- []byte
+	recorder    *recorder.Recorder
+	logger      *zap.SugaredLogger
+
+	conn  net.PacketConn
+	relay net.Conn
+	wg    sync.WaitGroup
+}
+
+// NewListener returns a new Listener configured with the given options.
+func NewListener(opts ...Option) (*Listener, error) {
+	l := Listener{
+		addr: defaultListenerAddr,
+	}
+
+	for _, opt := range opts {
+		opt(&l)
+	}
+
+	if l.dataChannel == nil {
+		return nil, errors.New("lambda data channel cannot be nil")
+	}
+
+	if l.logger == nil {
+		return nil, errors.New("logger cannot be nil")
+	}
+
+	return &l, nil
+}
+
+// Start starts listening for segment documents.
+func (l *Listener) Start() error {
+	conn, err := net.ListenPacket("udp", l.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on addr %s: %w", l.addr, err)
+	}
+	if l.relayAddr != "" {
+		relay, err := net.Dial("udp", l.relayAddr)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to connect to X-Ray daemon at %s: %w", l.relayAddr, err)
+		}
+		l.relay = relay
+	}
+	l.conn = conn
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		l.logger.Infof("Extension listening for X-Ray segments on %s", conn.LocalAddr())
+		l.serve()
+	}()
+	return nil
+}
+
+// Addr returns the address the listener is listening on.
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Shutdown stops the listener.
+func (l *Listener) Shutdown() error {
+	err := l.conn.Close()
+	l.wg.Wait()
+	if l.relay != nil {
+		if relayErr := l.relay.Close(); err == nil {
+			err = relayErr
+		}
+	}
+	return err
+}
+
+func (l *Listener) serve() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.logger.Errorf("Failed to read X-Ray datagram: %v", err)
+			}
+			return
+		}
+		datagram := buf[:n]
+		if err := l.recorder.Record(recorder.XRay, datagram); err != nil {
+			l.logger.Warnf("Failed to record X-Ray datagram: %v", err)
+		}
+		if l.relay != nil {
+			if _, err := l.relay.Write(datagram); err != nil {
+				l.logger.Warnf("Failed to relay X-Ray datagram: %v", err)
+			}
+		}
+		l.handleDatagram(datagram)
+	}
+}
+
+func (l *Listener) handleDatagram(datagram []byte) {
+	segment, err := ParseDatagram(datagram)
+	if err != nil {
+		if !errors.Is(err, ErrInProgress) {
+			l.logger.Warnf("Dropping X-Ray datagram: %v", err)
+		}
+		return
+	}
+	events, err := ToIntake(segment)
+	if err != nil {
+		l.logger.Warnf("Failed to translate X-Ray segment: %v", err)
+		return
+	}
+	for _, event := range events {
+		select {
+		case l.dataChannel <- event:
+		default:
+			l.logger.Warnf("Channel full: dropping X-Ray event")
+		}
+	}
+}
+
+// DaemonAddress returns the UDP address of the X-Ray daemon from the value
+// of the AWS_XRAY_DAEMON_ADDRESS environment variable. The value is either
+// a single address or a `tcp:<addr> udp:<addr>` pair.
+func DaemonAddress(value string) string {
+	for _, field := range strings.Fields(value) {
+		if addr, ok := strings.CutPrefix(field, "udp:"); ok {
+			return addr
+		}
+		if !strings.HasPrefix(field, "tcp:") {
+			return field
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package xray_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/xray"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestListener(t *testing.T) {
+	daemon, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer daemon.Close()
+
+	dataChannel := make(chan []byte, 10)
+	l, err := xray.NewListener(
+		xray.WithListenerAddress("127.0.0.1:0"),
+		xray.WithRelayAddress(daemon.LocalAddr().String()),
+		xray.WithLambdaDataChannel(dataChannel),
+		xray.WithLogger(zaptest.NewLogger(t).Sugar()),
+	)
+	require.NoError(t, err)
+	require.NoError(t, l.Start())
+	defer func() {
+		require.NoError(t, l.Shutdown())
+	}()
+
+	conn, err := net.Dial("udp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	datagram := `{"format": "json", "version": 1}` + "\n" +
+		`{"name": "fn", "id": "70de5b6f19ff9a0a", "trace_id": "1-581cf771-a006649127e371903a2de979", "start_time": 1478293361.271, "end_time": 1478293361.449}`
+	_, err = conn.Write([]byte(datagram))
+	require.NoError(t, err)
+
+	select {
+	case data := <-dataChannel:
+		assert.Contains(t, string(data), `"trace_id":"581cf771a006649127e371903a2de979"`)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the translated segment")
+	}
+
+	buf := make([]byte, 1024)
+	require.NoError(t, daemon.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := daemon.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, datagram, string(buf[:n]))
+}
+
+func TestNewListener(t *testing.T) {
+	_, err := xray.NewListener(xray.WithLogger(zaptest.NewLogger(t).Sugar()))
+	assert.Error(t, err)
+
+	_, err = xray.NewListener(xray.WithLambdaDataChannel(make(chan []byte)))
+	assert.Error(t, err)
+}
@@ -0,0 +1,63 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package xray
+
+import (
+	"github.com/elastic/apm-aws-lambda/recorder"
+	"go.uber.org/zap"
+)
+
+// Option is a config option for a Listener.
+type Option func(*Listener)
+
+// WithListenerAddress sets the UDP address to listen on.
+func WithListenerAddress(addr string) Option {
+	return func(l *Listener) {
+		l.addr = addr
+	}
+}
+
+// WithRelayAddress sets the address of the X-Ray daemon the received
+// datagrams are relayed to.
+func WithRelayAddress(addr string) Option {
+	return func(l *Listener) {
+		l.relayAddr = addr
+	}
+}
+
+// WithLambdaDataChannel sets the channel the events translated from the
+// segments are queued to.
+func WithLambdaDataChannel(ch chan<- []byte) Option {
+	return func(l *Listener) {
+		l.dataChannel = ch
+	}
+}
+
+// WithRecorder sets the recorder of the received datagrams.
+func WithRecorder(rec *recorder.Recorder) Option {
+	return func(l *Listener) {
+		l.recorder = rec
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(logger *zap.SugaredLogger) Option {
+	return func(l *Listener) {
+		l.logger = logger
+	}
+}
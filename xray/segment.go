@@ -0,0 +1,319 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package xray
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/elastic/apm-aws-lambda/logsapi/model"
+	"go.elastic.co/fastjson"
+)
+
+// ErrInProgress is returned for segments that have not ended yet. The
+// X-Ray SDKs send the completed segment again once it ends.
+var ErrInProgress = errors.New("segment is in progress")
+
+// Segment is a subset of the X-Ray segment document, see
+// https://docs.aws.amazon.com/xray/latest/devguide/xray-api-segmentdocuments.html.
+// Subsegments use the same document structure.
+type Segment struct {
+	Name        string                 `json:"name"`
+	ID          string                 `json:"id"`
+	TraceID     string                 `json:"trace_id"`
+	ParentID    string                 `json:"parent_id"`
+	Type        string                 `json:"type"`
+	StartTime   float64                `json:"start_time"`
+	EndTime     float64                `json:"end_time"`
+	InProgress  bool                   `json:"in_progress"`
+	Namespace   string                 `json:"namespace"`
+	Error       bool                   `json:"error"`
+	Fault       bool                   `json:"fault"`
+	Throttle    bool                   `json:"throttle"`
+	Cause       json.RawMessage        `json:"cause"`
+	HTTP        *HTTP                  `json:"http"`
+	AWS         *AWS                   `json:"aws"`
+	SQL         *SQL                   `json:"sql"`
+	Annotations map[string]interface{} `json:"annotations"`
+	Subsegments []Segment              `json:"subsegments"`
+}
+
+type HTTP struct {
+	Request *struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	} `json:"request"`
+	Response *struct {
+		Status int `json:"status"`
+	} `json:"response"`
+}
+
+type AWS struct {
+	Operation string `json:"operation"`
+	Region    string `json:"region"`
+	XRay      *struct {
+		SDK        string `json:"sdk"`
+		SDKVersion string `json:"sdk_version"`
+	} `json:"xray"`
+}
+
+type SQL struct {
+	DatabaseType   string `json:"database_type"`
+	SanitizedQuery string `json:"sanitized_query"`
+}
+
+// Cause holds the exceptions recorded for a segment. The cause field of a
+// segment can also be the ID of an exception recorded in another segment,
+// in which case it is ignored.
+type Cause struct {
+	Exceptions []Exception `json:"exceptions"`
+}
+
+type Exception struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Remote  bool   `json:"remote"`
+}
+
+// ParseDatagram splits an X-Ray daemon datagram, composed of a JSON header
+// and a segment document separated by a new line, and decodes the segment.
+func ParseDatagram(datagram []byte) (*Segment, error) {
+	header, doc, ok := bytes.Cut(datagram, []byte("\n"))
+	if !ok {
+		return nil, errors.New("missing datagram header")
+	}
+	var h struct {
+		Format string `json:"format"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil {
+		return nil, fmt.Errorf("failed to decode datagram header: %w", err)
+	}
+	if h.Format != "json" {
+		return nil, fmt.Errorf("unsupported datagram format %q", h.Format)
+	}
+	var s Segment
+	if err := json.Unmarshal(doc, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode segment document: %w", err)
+	}
+	if s.InProgress {
+		return nil, ErrInProgress
+	}
+	return &s, nil
+}
+
+// ToIntake translates a segment document into intake v2 events. Segments
+// are translated to transactions, and their subsegments to spans.
+// Independent subsegment documents are translated to spans without a
+// transaction ID as their segment is reported separately, usually by the
+// Lambda service. Exceptions are translated to errors. The events have no
+// metadata: they are sent with the metadata of the batch.
+func ToIntake(s *Segment) ([][]byte, error) {
+	traceID, err := TraceID(s.TraceID)
+	if err != nil {
+		return nil, err
+	}
+	t := translator{traceID: traceID}
+	if s.Type == "subsegment" {
+		err = t.span(s, "", s.ParentID)
+	} else {
+		err = t.transaction(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.events, nil
+}
+
+type translator struct {
+	events  [][]byte
+	traceID string
+}
+
+func (t *translator) add(event fastjson.Marshaler) error {
+	var w fastjson.Writer
+	if err := event.MarshalFastJSON(&w); err != nil {
+		return err
+	}
+	t.events = append(t.events, w.Bytes())
+	return nil
+}
+
+func (t *translator) transaction(s *Segment) error {
+	txn := &model.Transaction{
+		ID:        s.ID,
+		TraceID:   t.traceID,
+		ParentID:  s.ParentID,
+		Name:      s.Name,
+		Type:      "unknown",
+		Timestamp: toTime(s.StartTime),
+		Duration:  duration(s),
+		Outcome:   outcome(s),
+		SpanCount: model.SpanCount{Started: countSubsegments(s.Subsegments)},
+		Context:   segmentContext(s),
+	}
+	if s.HTTP != nil {
+		txn.Type = "request"
+		if s.HTTP.Response != nil && s.HTTP.Response.Status > 0 {
+			txn.Result = fmt.Sprintf("HTTP %dxx", s.HTTP.Response.Status/100)
+		}
+	}
+	if err := t.add(&model.TransactionContainer{Transaction: txn}); err != nil {
+		return err
+	}
+	if err := t.exceptions(s, s.ID); err != nil {
+		return err
+	}
+	for i := range s.Subsegments {
+		if err := t.span(&s.Subsegments[i], s.ID, s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *translator) span(s *Segment, txnID, parentID string) error {
+	if s.InProgress {
+		return nil
+	}
+	span := &model.Span{
+		ID:            s.ID,
+		TransactionID: txnID,
+		TraceID:       t.traceID,
+		ParentID:      parentID,
+		Name:          s.Name,
+		Timestamp:     toTime(s.StartTime),
+		Duration:      duration(s),
+		Outcome:       outcome(s),
+		Context:       segmentContext(s),
+	}
+	span.Type, span.Subtype, span.Action = spanType(s)
+	if err := t.add(&model.SpanContainer{Span: span}); err != nil {
+		return err
+	}
+	if err := t.exceptions(s, txnID); err != nil {
+		return err
+	}
+	for i := range s.Subsegments {
+		if err := t.span(&s.Subsegments[i], txnID, s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *translator) exceptions(s *Segment, txnID string) error {
+	if len(s.Cause) == 0 || s.Cause[0] != '{' {
+		return nil
+	}
+	var cause Cause
+	if err := json.Unmarshal(s.Cause, &cause); err != nil {
+		return nil
+	}
+	for _, e := range cause.Exceptions {
+		ec := model.ErrorContainer{Error: &model.Error{
+			ID:            model.NewID(16),
+			TraceID:       t.traceID,
+			TransactionID: txnID,
+			ParentID:      s.ID,
+			Timestamp:     toTime(s.EndTime),
+			Exception: &model.Exception{
+				Message: e.Message,
+				Type:    e.Type,
+			},
+		}}
+		if err := t.add(&ec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func spanType(s *Segment) (string, string, string) {
+	switch {
+	case s.SQL != nil:
+		subtype := strings.ToLower(s.SQL.DatabaseType)
+		if subtype == "" {
+			subtype = "sql"
+		}
+		return "db", subtype, "query"
+	case s.Namespace == "aws":
+		var action string
+		if s.AWS != nil {
+			action = s.AWS.Operation
+		}
+		subtype := strings.ToLower(s.Name)
+		switch subtype {
+		case "dynamodb":
+			return "db", subtype, action
+		case "s3":
+			return "storage", subtype, action
+		case "sqs", "sns":
+			return "messaging", subtype, action
+		}
+		return "external", subtype, action
+	case s.HTTP != nil:
+		return "external", "http", ""
+	}
+	return "app", "", ""
+}
+
+func outcome(s *Segment) string {
+	if s.Error || s.Fault || s.Throttle {
+		return "failure"
+	}
+	return "success"
+}
+
+func segmentContext(s *Segment) *model.Context {
+	if len(s.Annotations) == 0 {
+		return nil
+	}
+	labels := make(model.Labels, len(s.Annotations))
+	for k, v := range s.Annotations {
+		labels.Set(k, v)
+	}
+	return &model.Context{Labels: labels}
+}
+
+func countSubsegments(subsegments []Segment) int {
+	n := len(subsegments)
+	for _, s := range subsegments {
+		n += countSubsegments(s.Subsegments)
+	}
+	return n
+}
+
+// duration returns the duration of the segment in milliseconds.
+func duration(s *Segment) float64 {
+	if s.EndTime < s.StartTime {
+		return 0
+	}
+	return (s.EndTime - s.StartTime) * 1000
+}
+
+// toTime converts the epoch seconds of a segment to a time, rounded to
+// the microsecond which is the precision of the X-Ray timestamps.
+func toTime(epochSeconds float64) model.Time {
+	return model.Time(time.UnixMicro(int64(math.Round(epochSeconds * 1e6))))
+}
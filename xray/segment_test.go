@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package xray
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+const datagramHeader = `{"format": "json", "version": 1}` + "\n"
+
+func TestSegmentToIntake(t *testing.T) {
+	segment, err := ParseDatagram([]byte(datagramHeader + `{
+		"name": "my-api",
+		"id": "70de5b6f19ff9a0a",
+		"trace_id": "1-581cf771-a006649127e371903a2de979",
+		"start_time": 1478293361.271,
+		"end_time": 1478293361.449,
+		"http": {"request": {"method": "GET", "url": "https://example.com"}, "response": {"status": 200}},
+		"annotations": {"customer.id": "42"},
+		"aws": {"xray": {"sdk": "X-Ray for Go", "sdk_version": "1.8.0"}},
+		"subsegments": [{
+			"name": "DynamoDB",
+			"id": "53995c3f42cd8ad8",
+			"start_time": 1478293361.3,
+			"end_time": 1478293361.4,
+			"namespace": "aws",
+			"aws": {"operation": "GetItem"},
+			"fault": true,
+			"cause": {"exceptions": [{"id": "0ba7c6b7b1d4e3e8", "type": "ResourceNotFoundException", "message": "table not found"}]},
+			"subsegments": [{
+				"name": "marshal",
+				"id": "53995c3f42cd8ad9",
+				"start_time": 1478293361.31,
+				"end_time": 1478293361.32
+			}]
+		}]
+	}`))
+	require.NoError(t, err)
+
+	events, err := ToIntake(segment)
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+
+	txn := gjson.ParseBytes(events[0])
+	assert.Equal(t, "70de5b6f19ff9a0a", txn.Get("transaction.id").String())
+	assert.Equal(t, "581cf771a006649127e371903a2de979", txn.Get("transaction.trace_id").String())
+	assert.Equal(t, "request", txn.Get("transaction.type").String())
+	assert.Equal(t, "HTTP 2xx", txn.Get("transaction.result").String())
+	assert.Equal(t, "success", txn.Get("transaction.outcome").String())
+	assert.Equal(t, int64(2), txn.Get("transaction.span_count.started").Int())
+	assert.Equal(t, int64(1478293361271000), txn.Get("transaction.timestamp").Int())
+	assert.InDelta(t, 178.0, txn.Get("transaction.duration").Float(), 0.001)
+	assert.Equal(t, "42", txn.Get("transaction.context.tags.customer_id").String())
+
+	span := gjson.ParseBytes(events[1])
+	assert.Equal(t, "53995c3f42cd8ad8", span.Get("span.id").String())
+	assert.Equal(t, "70de5b6f19ff9a0a", span.Get("span.parent_id").String())
+	assert.Equal(t, "70de5b6f19ff9a0a", span.Get("span.transaction_id").String())
+	assert.Equal(t, "db", span.Get("span.type").String())
+	assert.Equal(t, "dynamodb", span.Get("span.subtype").String())
+	assert.Equal(t, "GetItem", span.Get("span.action").String())
+	assert.Equal(t, "failure", span.Get("span.outcome").String())
+
+	errEvent := gjson.ParseBytes(events[2])
+	assert.Equal(t, "53995c3f42cd8ad8", errEvent.Get("error.parent_id").String())
+	assert.Equal(t, "70de5b6f19ff9a0a", errEvent.Get("error.transaction_id").String())
+	assert.Equal(t, "ResourceNotFoundException", errEvent.Get("error.exception.type").String())
+
+	child := gjson.ParseBytes(events[3])
+	assert.Equal(t, "53995c3f42cd8ad8", child.Get("span.parent_id").String())
+	assert.Equal(t, "app", child.Get("span.type").String())
+}
+
+func TestIndependentSubsegmentToIntake(t *testing.T) {
+	segment, err := ParseDatagram([]byte(datagramHeader + `{
+		"name": "S3",
+		"id": "53995c3f42cd8ad8",
+		"type": "subsegment",
+		"trace_id": "1-581cf771-a006649127e371903a2de979",
+		"parent_id": "70de5b6f19ff9a0a",
+		"namespace": "aws",
+		"start_time": 1478293361.3,
+		"end_time": 1478293361.4,
+		"cause": "0ba7c6b7b1d4e3e8"
+	}`))
+	require.NoError(t, err)
+
+	events, err := ToIntake(segment)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	span := gjson.ParseBytes(events[0])
+	assert.Equal(t, "70de5b6f19ff9a0a", span.Get("span.parent_id").String())
+	assert.False(t, span.Get("span.transaction_id").Exists())
+	assert.Equal(t, "storage", span.Get("span.type").String())
+	assert.Equal(t, "s3", span.Get("span.subtype").String())
+}
+
+func TestParseDatagram(t *testing.T) {
+	_, err := ParseDatagram([]byte(datagramHeader + `{"id": "70de5b6f19ff9a0a", "in_progress": true}`))
+	assert.ErrorIs(t, err, ErrInProgress)
+
+	_, err = ParseDatagram([]byte(`{"id": "70de5b6f19ff9a0a"}`))
+	assert.Error(t, err)
+
+	_, err = ParseDatagram([]byte(`{"format": "binary"}` + "\n{}"))
+	assert.Error(t, err)
+}